@@ -2,12 +2,14 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
-
-	"golang.org/x/sync/errgroup"
+	"time"
 )
 
 // IServer server interface
@@ -17,6 +19,11 @@ type IServer interface {
 	String() string
 }
 
+// IReadiness 可选接口，实现了该接口的服务在Ready返回nil后才启动下一个服务
+type IReadiness interface {
+	Ready(ctx context.Context) error
+}
+
 // Close app close
 type Close func() error
 
@@ -24,70 +31,189 @@ type Close func() error
 type App struct {
 	servers []IServer
 	closes  []Close
+	opts    *options
+
+	errCh      chan error     // 服务运行错误
+	quit       chan struct{}  // 主动停止
+	signals    chan os.Signal // 退出信号
+	quitOnce   sync.Once
+	registered bool // 服务实例是否已注册
 }
 
-// New create an app
-func New(servers []IServer, closes []Close) *App {
+// New create an app, servers are started in order and stopped in reverse order,
+// the closes are called in order after all servers are stopped
+func New(servers []IServer, closes []Close, opts ...Option) *App {
+	o := defaultOptions()
+	o.apply(opts...)
+
 	return &App{
 		servers: servers,
 		closes:  closes,
+		opts:    o,
+		errCh:   make(chan error, len(servers)),
+		quit:    make(chan struct{}),
+		signals: make(chan os.Signal, 1),
+	}
+}
+
+// Run 按顺序启动服务，每个服务就绪后才启动下一个服务，所有服务就绪后注册服务实例并执行OnStart，
+// 收到退出信号、调用Stop或服务运行出错时优雅停止，返回启动、运行或停止过程中的错误
+func (a *App) Run() error {
+	// 启动服务前监听退出信号，启动过程中收到信号时也能优雅停止已经启动的服务
+	signal.Notify(a.signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(a.signals)
+
+	started, err := a.start()
+	if err == nil {
+		err = a.wait()
+	}
+
+	if stopErr := a.shutdown(started); stopErr != nil {
+		if err == nil {
+			return stopErr
+		}
+		return fmt.Errorf("%v; %v", err, stopErr)
+	}
+	if err == nil {
+		fmt.Println("stop app successfully")
 	}
+	return err
 }
 
-// Run servers
-func (a *App) Run() {
-	// ctx will be notified whenever an error occurs in one of the goroutines
-	eg, ctx := errgroup.WithContext(context.Background())
+// Stop 主动停止app，Run在优雅停止后返回
+func (a *App) Stop() {
+	a.quitOnce.Do(func() {
+		close(a.quit)
+	})
+}
 
-	// start all servers
+// 按顺序启动服务，返回已经启动的服务
+func (a *App) start() ([]IServer, error) {
+	var started []IServer
 	for _, server := range a.servers {
 		s := server
-		eg.Go(func() error {
-			fmt.Println(s.String())
+		fmt.Println(s.String())
+		go func() {
 			if err := s.Start(); err != nil {
-				return err
+				a.errCh <- fmt.Errorf("server '%s' error: %v", s.String(), err)
 			}
-			return nil
-		})
-	}
+		}()
+		started = append(started, s)
 
-	// watch and stop app
-	eg.Go(func() error {
-		return a.watch(ctx)
-	})
+		if err := a.waitReady(s); err != nil {
+			return started, err
+		}
+	}
 
-	if err := eg.Wait(); err != nil {
-		panic(err)
+	ctx, cancel := context.WithTimeout(context.Background(), a.opts.startTimeout)
+	defer cancel()
+	if a.opts.registry != nil && a.opts.instance != nil {
+		if err := a.opts.registry.Register(ctx, a.opts.instance); err != nil {
+			return started, fmt.Errorf("register service instance '%s' error: %v", a.opts.instance.ID, err)
+		}
+		a.registered = true
+	}
+	for _, hook := range a.opts.onStart {
+		if err := hook(ctx); err != nil {
+			return started, fmt.Errorf("on start hook error: %v", err)
+		}
 	}
+
+	return started, nil
 }
 
-// watch the os signal and the ctx signal from the errgroup, and stop the service if either signal is triggered
-func (a *App) watch(ctx context.Context) error {
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+// 等待服务就绪，没有实现IReadiness的服务视为立即就绪
+func (a *App) waitReady(s IServer) error {
+	r, ok := s.(IReadiness)
+	if !ok {
+		return nil
+	}
 
+	ctx, cancel := context.WithTimeout(context.Background(), a.opts.startTimeout)
+	defer cancel()
+	ticker := time.NewTicker(time.Millisecond * 100)
+	defer ticker.Stop()
 	for {
-		select {
-		case <-ctx.Done(): // service error signals
-			_ = a.stop()
-			return ctx.Err()
-		case s := <-quit: // system notification signal
-			fmt.Printf("quit signal: %s\n", s.String())
-			if err := a.stop(); err != nil {
-				return err
-			}
-			fmt.Println("stop app successfully")
+		err := r.Ready(ctx)
+		if err == nil {
 			return nil
 		}
+
+		select {
+		case err := <-a.errCh:
+			return err
+		case <-a.quit:
+			return fmt.Errorf("app stopped while waiting for server '%s' to be ready", s.String())
+		case sig := <-a.signals:
+			return fmt.Errorf("quit signal '%s' received while waiting for server '%s' to be ready", sig.String(), s.String())
+		case <-ctx.Done():
+			return fmt.Errorf("server '%s' is not ready after %s: %v", s.String(), a.opts.startTimeout, err)
+		case <-ticker.C:
+		}
+	}
+}
+
+// watch the os signal, the Stop call and the server errors
+func (a *App) wait() error {
+	select {
+	case err := <-a.errCh: // service error signals
+		return err
+	case s := <-a.signals: // system notification signal
+		fmt.Printf("quit signal: %s\n", s.String())
+		return nil
+	case <-a.quit:
+		return nil
+	}
+}
+
+// 在超时时间内依次注销服务实例，执行OnStop，倒序停止服务，执行closes
+func (a *App) shutdown(started []IServer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), a.opts.stopTimeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- a.stop(ctx, started)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("stop app timeout after %s", a.opts.stopTimeout)
 	}
 }
 
-// stopping services and releasing resources
-func (a *App) stop() error {
+// stopping services and releasing resources, continue on error and return all errors
+func (a *App) stop(ctx context.Context, started []IServer) error {
+	var errs []string
+
+	if a.registered {
+		if err := a.opts.registry.Deregister(ctx, a.opts.instance); err != nil {
+			errs = append(errs, fmt.Sprintf("deregister service instance '%s' error: %v", a.opts.instance.ID, err))
+		}
+	}
+
+	for _, hook := range a.opts.onStop {
+		if err := hook(ctx); err != nil {
+			errs = append(errs, fmt.Sprintf("on stop hook error: %v", err))
+		}
+	}
+
+	for i := len(started) - 1; i >= 0; i-- {
+		if err := started[i].Stop(); err != nil {
+			errs = append(errs, fmt.Sprintf("stop server '%s' error: %v", started[i].String(), err))
+		}
+	}
+
 	for _, closeFn := range a.closes {
 		if err := closeFn(); err != nil {
-			return err
+			errs = append(errs, err.Error())
 		}
 	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
 	return nil
 }
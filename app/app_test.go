@@ -4,9 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
+	"github.com/zhufuyi/pkg/servicerd/registry"
+
 	"github.com/stretchr/testify/assert"
 )
 
@@ -64,24 +69,20 @@ func TestApp(t *testing.T) {
 
 		closes = []Close{
 			func() error {
-				return s.Stop()
-			},
-			func() error {
-				return s2.Stop()
+				fmt.Println("close resource")
+				return nil
 			},
 		}
 	)
 
 	a := New(servers, closes)
-	go a.Run()
-	time.Sleep(time.Second)
-
-	// test watch
-	ctx, _ := context.WithTimeout(context.Background(), time.Millisecond*100)
-	assert.Error(t, a.watch(ctx))
-
-	time.Sleep(time.Second)
-	t.Log(a.stop())
+	go func() {
+		time.Sleep(time.Millisecond * 500)
+		a.Stop()
+	}()
+	err := a.Run()
+	assert.Error(t, err) // mock stop http server error
+	t.Log(err)
 }
 
 func TestAppError(t *testing.T) {
@@ -89,19 +90,213 @@ func TestAppError(t *testing.T) {
 	servers := []IServer{s3}
 	closes := []Close{
 		func() error {
-			return s3.Stop()
+			return nil
 		},
 	}
 
 	a := New(servers, closes)
+	err := a.Run()
+	assert.Error(t, err)
+	t.Log(err)
+}
+
+type orderServer struct {
+	name    string
+	events  *[]string
+	mu      *sync.Mutex
+	ready   int32
+	stopped chan struct{}
+}
+
+func newOrderServer(name string, events *[]string, mu *sync.Mutex) *orderServer {
+	return &orderServer{name: name, events: events, mu: mu, stopped: make(chan struct{})}
+}
+
+func (s *orderServer) record(event string) {
+	s.mu.Lock()
+	*s.events = append(*s.events, event)
+	s.mu.Unlock()
+}
+
+func (s *orderServer) Start() error {
+	s.record("start " + s.name)
 	go func() {
-		defer func() {
-			if e := recover(); e != nil {
-				t.Log(e)
-			}
-		}()
-		a.Run()
+		time.Sleep(time.Millisecond * 200)
+		atomic.StoreInt32(&s.ready, 1)
 	}()
+	<-s.stopped
+	return nil
+}
+
+func (s *orderServer) Stop() error {
+	s.record("stop " + s.name)
+	close(s.stopped)
+	return nil
+}
+
+func (s *orderServer) String() string {
+	return s.name
+}
+
+func (s *orderServer) Ready(ctx context.Context) error {
+	if atomic.LoadInt32(&s.ready) == 1 {
+		s.record("ready " + s.name)
+		return nil
+	}
+	return errors.New("not ready")
+}
+
+func TestAppLifecycle(t *testing.T) {
+	var events []string
+	mu := &sync.Mutex{}
+	record := func(event string) {
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	}
+
+	s1 := newOrderServer("s1", &events, mu)
+	s2 := newOrderServer("s2", &events, mu)
+	closes := []Close{
+		func() error {
+			record("close")
+			return nil
+		},
+	}
+	a := New([]IServer{s1, s2}, closes,
+		WithStartTimeout(time.Second),
+		WithStopTimeout(time.Second),
+		WithOnStart(func(ctx context.Context) error {
+			record("on start")
+			return nil
+		}),
+		WithOnStop(func(ctx context.Context) error {
+			record("on stop")
+			return nil
+		}),
+	)
+
+	go func() {
+		time.Sleep(time.Millisecond * 800)
+		a.Stop()
+	}()
+	err := a.Run()
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"start s1", "ready s1",
+		"start s2", "ready s2",
+		"on start",
+		"on stop",
+		"stop s2", "stop s1",
+		"close",
+	}, events)
+}
+
+type blockServer struct{}
+
+func (s *blockServer) Start() error {
+	select {}
+}
+
+func (s *blockServer) Stop() error {
 	time.Sleep(time.Second)
-	t.Log(a.stop())
+	return nil
+}
+
+func (s *blockServer) String() string {
+	return "block"
+}
+
+func (s *blockServer) Ready(ctx context.Context) error {
+	return errors.New("not ready")
+}
+
+func TestAppTimeout(t *testing.T) {
+	// 服务没有就绪
+	a := New([]IServer{&blockServer{}}, nil,
+		WithStartTimeout(time.Millisecond*200),
+		WithStopTimeout(time.Millisecond*200),
+	)
+	err := a.Run()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "not ready")
+	// 停止超时
+	assert.Contains(t, err.Error(), "timeout")
+
+	// OnStart出错
+	s := newOrderServer("s", &[]string{}, &sync.Mutex{})
+	a = New([]IServer{s}, nil, WithOnStart(func(ctx context.Context) error {
+		return errors.New("mock register error")
+	}))
+	err = a.Run()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "mock register error")
+}
+
+func TestAppSignalBeforeReady(t *testing.T) {
+	// 等待服务就绪时收到退出信号
+	a := New([]IServer{&blockServer{}}, nil,
+		WithStartTimeout(time.Second*10),
+		WithStopTimeout(time.Second*2),
+	)
+	go func() {
+		time.Sleep(time.Millisecond * 300)
+		_ = syscall.Kill(syscall.Getpid(), syscall.SIGTERM)
+	}()
+	start := time.Now()
+	err := a.Run()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "quit signal")
+	assert.Less(t, time.Since(start), time.Second*5)
+}
+
+type mockRegistry struct {
+	record func(event string)
+	err    error
+}
+
+func (r *mockRegistry) Register(ctx context.Context, service *registry.ServiceInstance) error {
+	r.record("register " + service.ID)
+	return r.err
+}
+
+func (r *mockRegistry) Deregister(ctx context.Context, service *registry.ServiceInstance) error {
+	r.record("deregister " + service.ID)
+	return nil
+}
+
+func TestAppRegistry(t *testing.T) {
+	var events []string
+	mu := &sync.Mutex{}
+	record := func(event string) {
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	}
+
+	s1 := newOrderServer("s1", &events, mu)
+	instance := registry.NewServiceInstance("1", "demo", []string{"http://127.0.0.1:8080"})
+	a := New([]IServer{s1}, nil,
+		WithRegistry(&mockRegistry{record: record}, instance),
+		WithOnStop(func(ctx context.Context) error {
+			record("on stop")
+			return nil
+		}),
+	)
+	go func() {
+		time.Sleep(time.Millisecond * 500)
+		a.Stop()
+	}()
+	err := a.Run()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"start s1", "ready s1", "register 1", "deregister 1", "on stop", "stop s1"}, events)
+
+	// 注册失败时停止服务，不注销
+	events = nil
+	s2 := newOrderServer("s2", &events, mu)
+	a = New([]IServer{s2}, nil, WithRegistry(&mockRegistry{record: record, err: errors.New("mock error")}, instance))
+	err = a.Run()
+	assert.Error(t, err)
+	assert.Equal(t, []string{"start s2", "ready s2", "register 1", "stop s2"}, events)
 }
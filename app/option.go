@@ -0,0 +1,85 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/zhufuyi/pkg/servicerd/registry"
+)
+
+var (
+	// DefaultStartTimeout 每个服务等待就绪和执行OnStart的默认超时时间
+	DefaultStartTimeout = time.Second * 30
+	// DefaultStopTimeout 优雅停止的默认超时时间
+	DefaultStopTimeout = time.Second * 30
+)
+
+// Hook 生命周期钩子
+type Hook func(ctx context.Context) error
+
+// Option set the app options.
+type Option func(*options)
+
+type options struct {
+	startTimeout time.Duration
+	stopTimeout  time.Duration
+	onStart      []Hook
+	onStop       []Hook
+
+	registry registry.Registry
+	instance *registry.ServiceInstance
+}
+
+func (o *options) apply(opts ...Option) {
+	for _, opt := range opts {
+		opt(o)
+	}
+}
+
+func defaultOptions() *options {
+	return &options{
+		startTimeout: DefaultStartTimeout,
+		stopTimeout:  DefaultStopTimeout,
+	}
+}
+
+// WithStartTimeout set the timeout for each server to be ready, it is also the timeout of the OnStart hooks
+func WithStartTimeout(d time.Duration) Option {
+	return func(o *options) {
+		if d > 0 {
+			o.startTimeout = d
+		}
+	}
+}
+
+// WithStopTimeout set the deadline of graceful shutdown, including OnStop hooks, stopping servers and Close funcs
+func WithStopTimeout(d time.Duration) Option {
+	return func(o *options) {
+		if d > 0 {
+			o.stopTimeout = d
+		}
+	}
+}
+
+// WithOnStart add hooks that run in order after all servers are ready, e.g. service registration
+func WithOnStart(hooks ...Hook) Option {
+	return func(o *options) {
+		o.onStart = append(o.onStart, hooks...)
+	}
+}
+
+// WithOnStop add hooks that run in order before servers are stopped, e.g. service deregistration, flushing metrics
+func WithOnStop(hooks ...Hook) Option {
+	return func(o *options) {
+		o.onStop = append(o.onStop, hooks...)
+	}
+}
+
+// WithRegistry register the service instance after all servers are ready,
+// and deregister it before OnStop hooks and stopping servers, so clients stop routing to the instance before its listener closes
+func WithRegistry(r registry.Registry, instance *registry.ServiceInstance) Option {
+	return func(o *options) {
+		o.registry = r
+		o.instance = instance
+	}
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"errors"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// GRPCServer grpc服务，实现了app.IServer和app.IReadiness接口
+type GRPCServer struct {
+	listener
+	addr            string
+	server          *grpc.Server
+	shutdownTimeout time.Duration
+}
+
+// NewGRPCServer create a grpc server, the services should be registered to server before Start
+func NewGRPCServer(addr string, server *grpc.Server, opts ...Option) *GRPCServer {
+	o := defaultOptions()
+	o.apply(opts...)
+
+	return &GRPCServer{
+		addr:            addr,
+		server:          server,
+		shutdownTimeout: o.shutdownTimeout,
+	}
+}
+
+// Start listen and serve, return nil after Stop
+func (s *GRPCServer) Start() error {
+	ln, err := s.listen(s.addr)
+	if err != nil {
+		return err
+	}
+
+	err = s.server.Serve(ln)
+	if errors.Is(err, grpc.ErrServerStopped) {
+		return nil
+	}
+	return err
+}
+
+// Stop graceful stop, force stop after timeout
+func (s *GRPCServer) Stop() error {
+	gracefulStop(s.server, s.shutdownTimeout)
+	return nil
+}
+
+// String server info
+func (s *GRPCServer) String() string {
+	return "grpc server started on " + s.addr
+}
+
+// 等待正在处理的请求结束，超时后强制停止
+func gracefulStop(server *grpc.Server, timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(done)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		server.Stop()
+	}
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func newGRPCServer() *grpc.Server {
+	server := grpc.NewServer()
+	grpc_health_v1.RegisterHealthServer(server, health.NewServer())
+	return server
+}
+
+func checkHealth(addr string) error {
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err = grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	return err
+}
+
+func TestGRPCServer(t *testing.T) {
+	s := NewGRPCServer("127.0.0.1:0", newGRPCServer(), WithShutdownTimeout(time.Second))
+	assert.Contains(t, s.String(), "grpc")
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.Start()
+	}()
+	waitReady(t, s)
+
+	assert.NoError(t, checkHealth(s.Addr()))
+
+	assert.NoError(t, s.Stop())
+	assert.NoError(t, <-errCh)
+}
+
+func TestGracefulStopTimeout(t *testing.T) {
+	s := NewGRPCServer("127.0.0.1:0", newGRPCServer(), WithShutdownTimeout(time.Millisecond*100))
+	go func() {
+		_ = s.Start()
+	}()
+	waitReady(t, s)
+
+	// 保持一个打开的流，GracefulStop会一直等待，超时后强制停止
+	conn, err := grpc.Dial(s.Addr(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	defer conn.Close()
+	stream, err := grpc_health_v1.NewHealthClient(conn).Watch(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	assert.NoError(t, err)
+	_, err = stream.Recv()
+	assert.NoError(t, err)
+
+	start := time.Now()
+	assert.NoError(t, s.Stop())
+	assert.Less(t, time.Since(start), time.Second)
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HTTPServer http服务，实现了app.IServer和app.IReadiness接口
+type HTTPServer struct {
+	listener
+	addr            string
+	server          *http.Server
+	shutdownTimeout time.Duration
+}
+
+// NewHTTPServer create a http server for gin engine
+func NewHTTPServer(addr string, handler *gin.Engine, opts ...Option) *HTTPServer {
+	o := defaultOptions()
+	o.apply(opts...)
+
+	return &HTTPServer{
+		addr:            addr,
+		server:          newHTTPServer(addr, handler, o),
+		shutdownTimeout: o.shutdownTimeout,
+	}
+}
+
+func newHTTPServer(addr string, handler http.Handler, o *options) *http.Server {
+	return &http.Server{
+		Addr:         addr,
+		Handler:      handler,
+		ReadTimeout:  o.readTimeout,
+		WriteTimeout: o.writeTimeout,
+		IdleTimeout:  o.idleTimeout,
+	}
+}
+
+// Start listen and serve, return nil after Stop
+func (s *HTTPServer) Start() error {
+	ln, err := s.listen(s.addr)
+	if err != nil {
+		return err
+	}
+
+	err = s.server.Serve(ln)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Stop graceful shutdown, wait for active requests to finish until timeout
+func (s *HTTPServer) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+	return s.server.Shutdown(ctx)
+}
+
+// String server info
+func (s *HTTPServer) String() string {
+	return "http server started on " + s.addr
+}
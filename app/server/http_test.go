@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/zhufuyi/pkg/app"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newGinEngine() *gin.Engine {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.GET("/ping", func(c *gin.Context) {
+		c.String(http.StatusOK, "pong")
+	})
+	r.GET("/slow", func(c *gin.Context) {
+		time.Sleep(time.Millisecond * 300)
+		c.String(http.StatusOK, "done")
+	})
+	return r
+}
+
+func waitReady(t *testing.T, r app.IReadiness) {
+	for i := 0; i < 100; i++ {
+		if r.Ready(context.Background()) == nil {
+			return
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	t.Fatal("server is not ready")
+}
+
+func httpGet(url string) (string, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return string(body), err
+}
+
+func TestHTTPServer(t *testing.T) {
+	s := NewHTTPServer("127.0.0.1:0", newGinEngine(),
+		WithReadTimeout(time.Second),
+		WithWriteTimeout(time.Second),
+		WithIdleTimeout(time.Second),
+		WithShutdownTimeout(time.Second),
+	)
+	assert.Equal(t, ErrNotServing, s.Ready(context.Background()))
+	assert.Contains(t, s.String(), "127.0.0.1:0")
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.Start()
+	}()
+	waitReady(t, s)
+
+	body, err := httpGet("http://" + s.Addr() + "/ping")
+	assert.NoError(t, err)
+	assert.Equal(t, "pong", body)
+
+	// 优雅停止，等待正在处理的请求结束
+	done := make(chan string, 1)
+	go func() {
+		body, _ := httpGet("http://" + s.Addr() + "/slow")
+		done <- body
+	}()
+	time.Sleep(time.Millisecond * 100)
+	assert.NoError(t, s.Stop())
+	assert.Equal(t, "done", <-done)
+	assert.NoError(t, <-errCh)
+}
+
+func TestHTTPServerError(t *testing.T) {
+	s := NewHTTPServer("127.0.0.1:-1", newGinEngine())
+	assert.Error(t, s.Start())
+}
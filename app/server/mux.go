@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+)
+
+// MuxServer 在同一个端口同时提供http和grpc服务(HTTP/2 cleartext)，实现了app.IServer和app.IReadiness接口，
+// Content-Type为application/grpc的HTTP/2请求转发给grpc，其他请求转发给gin。
+// 注意WriteTimeout会中断grpc的流式请求，有流式接口时需要设置WithWriteTimeout(0)
+type MuxServer struct {
+	listener
+	addr            string
+	server          *http.Server
+	shutdownTimeout time.Duration
+
+	// 通过ServeHTTP处理的grpc请求不支持GracefulStop，自己跟踪正在处理的grpc请求
+	mu          sync.Mutex
+	stopping    bool
+	inflight    sync.WaitGroup
+	forceCtx    context.Context // 超时后取消，中断还没有结束的grpc请求
+	forceCancel context.CancelFunc
+}
+
+// NewMuxServer create a server that serves gin and grpc on one port
+func NewMuxServer(addr string, handler *gin.Engine, grpcServer *grpc.Server, opts ...Option) *MuxServer {
+	o := defaultOptions()
+	o.apply(opts...)
+
+	s := &MuxServer{
+		addr:            addr,
+		shutdownTimeout: o.shutdownTimeout,
+	}
+	s.forceCtx, s.forceCancel = context.WithCancel(context.Background())
+	mux := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isGRPCRequest(r) {
+			s.serveGRPC(grpcServer, w, r)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+
+	h2s := &http2.Server{IdleTimeout: o.idleTimeout}
+	s.server = newHTTPServer(addr, h2c.NewHandler(mux, h2s), o)
+	// 注册到http.Server，Shutdown时向h2c连接发送GOAWAY，不再接收新的请求
+	_ = http2.ConfigureServer(s.server, h2s)
+	return s
+}
+
+func (s *MuxServer) serveGRPC(grpcServer *grpc.Server, w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	if s.stopping {
+		s.mu.Unlock()
+		w.Header().Set("Connection", "close")
+		http.Error(w, "server is stopping", http.StatusServiceUnavailable)
+		return
+	}
+	s.inflight.Add(1)
+	s.mu.Unlock()
+	defer s.inflight.Done()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-s.forceCtx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	grpcServer.ServeHTTP(w, r.WithContext(ctx))
+}
+
+func isGRPCRequest(r *http.Request) bool {
+	return r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// Start listen and serve, return nil after Stop
+func (s *MuxServer) Start() error {
+	ln, err := s.listen(s.addr)
+	if err != nil {
+		return err
+	}
+
+	err = s.server.Serve(ln)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Stop graceful stop http and grpc, the unfinished grpc requests are canceled after the shutdown timeout
+func (s *MuxServer) Stop() error {
+	s.mu.Lock()
+	s.stopping = true
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+	err := s.server.Shutdown(ctx)
+
+	done := make(chan struct{})
+	go func() {
+		s.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		s.forceCancel()
+		<-done
+	}
+
+	if err != nil {
+		_ = s.server.Close()
+	}
+	return err
+}
+
+// String server info
+func (s *MuxServer) String() string {
+	return "http and grpc server started on " + s.addr
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zhufuyi/pkg/app"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestMuxServer(t *testing.T) {
+	s := NewMuxServer("127.0.0.1:0", newGinEngine(), newGRPCServer(), WithShutdownTimeout(time.Second))
+	assert.Contains(t, s.String(), "http and grpc")
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.Start()
+	}()
+	waitReady(t, s)
+
+	body, err := httpGet("http://" + s.Addr() + "/ping")
+	assert.NoError(t, err)
+	assert.Equal(t, "pong", body)
+	assert.NoError(t, checkHealth(s.Addr()))
+
+	assert.NoError(t, s.Stop())
+	assert.NoError(t, <-errCh)
+}
+
+func TestServersWithApp(t *testing.T) {
+	httpServer := NewHTTPServer("127.0.0.1:0", newGinEngine())
+	grpcServer := NewGRPCServer("127.0.0.1:0", newGRPCServer())
+	a := app.New([]app.IServer{httpServer, grpcServer}, nil, app.WithOnStart(func(ctx context.Context) error {
+		_, err := httpGet("http://" + httpServer.Addr() + "/ping")
+		if err != nil {
+			return err
+		}
+		return checkHealth(grpcServer.Addr())
+	}))
+
+	go func() {
+		time.Sleep(time.Millisecond * 300)
+		a.Stop()
+	}()
+	assert.NoError(t, a.Run())
+}
+
+func TestMuxServerStopWithStream(t *testing.T) {
+	s := NewMuxServer("127.0.0.1:0", newGinEngine(), newGRPCServer(), WithShutdownTimeout(time.Millisecond*200), WithWriteTimeout(0))
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.Start()
+	}()
+	waitReady(t, s)
+
+	// 保持一个打开的流，超时后取消流，停止时不能panic
+	conn, err := grpc.Dial(s.Addr(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	defer conn.Close()
+	stream, err := grpc_health_v1.NewHealthClient(conn).Watch(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	assert.NoError(t, err)
+	_, err = stream.Recv()
+	assert.NoError(t, err)
+
+	start := time.Now()
+	_ = s.Stop() // 超时返回context.DeadlineExceeded
+	assert.Less(t, time.Since(start), time.Second)
+	assert.NoError(t, <-errCh)
+
+	_, err = stream.Recv()
+	assert.Error(t, err)
+	assert.Error(t, checkHealth(s.Addr()))
+}
+
+func TestMuxServerStopWaitUnary(t *testing.T) {
+	gs := grpc.NewServer()
+	hs := &slowHealthServer{delay: time.Millisecond * 200}
+	grpc_health_v1.RegisterHealthServer(gs, hs)
+	s := NewMuxServer("127.0.0.1:0", newGinEngine(), gs, WithShutdownTimeout(time.Second))
+	go func() {
+		_ = s.Start()
+	}()
+	waitReady(t, s)
+
+	// 停止时等待正在处理的grpc请求结束
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- checkHealth(s.Addr())
+	}()
+	time.Sleep(time.Millisecond * 100)
+	assert.NoError(t, s.Stop())
+	assert.NoError(t, <-errCh)
+}
+
+type slowHealthServer struct {
+	grpc_health_v1.UnimplementedHealthServer
+	delay time.Duration
+}
+
+func (s *slowHealthServer) Check(ctx context.Context, req *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	time.Sleep(s.delay)
+	return &grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING}, nil
+}
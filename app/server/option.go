@@ -0,0 +1,69 @@
+package server
+
+import "time"
+
+var (
+	// DefaultReadTimeout http读取请求的默认超时时间
+	DefaultReadTimeout = time.Second * 30
+	// DefaultWriteTimeout http写响应的默认超时时间
+	DefaultWriteTimeout = time.Second * 60
+	// DefaultIdleTimeout http keep-alive连接的默认空闲时间
+	DefaultIdleTimeout = time.Second * 120
+	// DefaultShutdownTimeout 优雅停止的默认超时时间
+	DefaultShutdownTimeout = time.Second * 10
+)
+
+// Option set the server options.
+type Option func(*options)
+
+type options struct {
+	readTimeout     time.Duration
+	writeTimeout    time.Duration
+	idleTimeout     time.Duration
+	shutdownTimeout time.Duration
+}
+
+func (o *options) apply(opts ...Option) {
+	for _, opt := range opts {
+		opt(o)
+	}
+}
+
+func defaultOptions() *options {
+	return &options{
+		readTimeout:     DefaultReadTimeout,
+		writeTimeout:    DefaultWriteTimeout,
+		idleTimeout:     DefaultIdleTimeout,
+		shutdownTimeout: DefaultShutdownTimeout,
+	}
+}
+
+// WithReadTimeout set the http read timeout, 0 means no timeout
+func WithReadTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.readTimeout = d
+	}
+}
+
+// WithWriteTimeout set the http write timeout, 0 means no timeout
+func WithWriteTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.writeTimeout = d
+	}
+}
+
+// WithIdleTimeout set the http idle timeout of keep-alive connections
+func WithIdleTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.idleTimeout = d
+	}
+}
+
+// WithShutdownTimeout set the timeout of graceful shutdown, the grpc server is forced to stop after the timeout
+func WithShutdownTimeout(d time.Duration) Option {
+	return func(o *options) {
+		if d > 0 {
+			o.shutdownTimeout = d
+		}
+	}
+}
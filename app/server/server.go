@@ -0,0 +1,47 @@
+// Package server provides http, grpc and combined servers that implement app.IServer and app.IReadiness.
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+)
+
+// ErrNotServing 服务还没有开始监听
+var ErrNotServing = errors.New("server is not serving")
+
+// listener 记录监听状态，用于就绪检查
+type listener struct {
+	mutex sync.RWMutex
+	ln    net.Listener
+}
+
+func (l *listener) listen(addr string) (net.Listener, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	l.mutex.Lock()
+	l.ln = ln
+	l.mutex.Unlock()
+	return ln, nil
+}
+
+// Addr the listening address, empty if not serving
+func (l *listener) Addr() string {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	if l.ln == nil {
+		return ""
+	}
+	return l.ln.Addr().String()
+}
+
+// Ready return nil after the server starts listening
+func (l *listener) Ready(ctx context.Context) error {
+	if l.Addr() == "" {
+		return ErrNotServing
+	}
+	return nil
+}
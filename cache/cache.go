@@ -21,6 +21,8 @@ var (
 	ErrPlaceholder = errors.New("cache: placeholder")
 	// ErrSetMemoryWithNotFound .
 	ErrSetMemoryWithNotFound = errors.New("cache: set memory cache err for not found")
+	// ErrTagUnsupported .
+	ErrTagUnsupported = errors.New("cache: tag is unsupported")
 )
 
 // Cache 定义cache驱动接口
@@ -33,6 +35,26 @@ type Cache interface {
 	SetCacheWithNotFound(ctx context.Context, key string) error
 }
 
+// TagCache 支持按标签批量删除的缓存，memory缓存和redis缓存都实现了该接口
+type TagCache interface {
+	Cache
+	// SetWithTags 添加缓存，并给缓存打上一个或多个标签
+	SetWithTags(ctx context.Context, key string, val interface{}, expiration time.Duration, tags ...string) error
+	// InvalidateTag 删除带有标签的所有缓存
+	InvalidateTag(ctx context.Context, tags ...string) error
+}
+
+// SetNXCache 支持key不存在时才添加、比较后写入和删除的缓存，memory缓存、redis缓存和二级缓存都实现了该接口
+type SetNXCache interface {
+	Cache
+	// SetNX key不存在时添加缓存，返回是否添加成功
+	SetNX(ctx context.Context, key string, val interface{}, expiration time.Duration) (bool, error)
+	// CompareAndSet 缓存的值等于old时才写入val，返回是否写入成功
+	CompareAndSet(ctx context.Context, key string, old interface{}, val interface{}, expiration time.Duration) (bool, error)
+	// CompareAndDelete 缓存的值等于old时才删除，返回是否删除成功
+	CompareAndDelete(ctx context.Context, key string, old interface{}) (bool, error)
+}
+
 // Set 数据
 func Set(ctx context.Context, key string, val interface{}, expiration time.Duration) error {
 	return DefaultClient.Set(ctx, key, val, expiration)
@@ -62,3 +84,21 @@ func Del(ctx context.Context, keys ...string) error {
 func SetCacheWithNotFound(ctx context.Context, key string) error {
 	return DefaultClient.SetCacheWithNotFound(ctx, key)
 }
+
+// SetWithTags 添加缓存并打上标签，DefaultClient必须实现TagCache
+func SetWithTags(ctx context.Context, key string, val interface{}, expiration time.Duration, tags ...string) error {
+	tc, ok := DefaultClient.(TagCache)
+	if !ok {
+		return ErrTagUnsupported
+	}
+	return tc.SetWithTags(ctx, key, val, expiration, tags...)
+}
+
+// InvalidateTag 删除带有标签的所有缓存，DefaultClient必须实现TagCache
+func InvalidateTag(ctx context.Context, tags ...string) error {
+	tc, ok := DefaultClient.(TagCache)
+	if !ok {
+		return ErrTagUnsupported
+	}
+	return tc.InvalidateTag(ctx, tags...)
+}
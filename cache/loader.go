@@ -0,0 +1,426 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/zhufuyi/pkg/encoding"
+
+	"golang.org/x/sync/singleflight"
+)
+
+var (
+	// ErrNotFound 数据源中没有数据，可以通过WithNotFoundError替换为自定义错误，例如gorm.ErrRecordNotFound
+	ErrNotFound = errors.New("cache: not found")
+	// DefaultJitterRatio 过期时间随机增加的比例，防止大量缓存同时过期(缓存雪崩)
+	DefaultJitterRatio = 0.1
+	// DefaultRefreshTimeout 后台刷新缓存的超时时间
+	DefaultRefreshTimeout = time.Second * 10
+	// DefaultLoadTimeout GetOrLoad和MultiGetOrLoad从数据源加载数据的超时时间
+	DefaultLoadTimeout = time.Second * 10
+)
+
+// LoadFunc 缓存没有命中时从数据源(例如mysql)加载数据，数据不存在时返回not found错误
+type LoadFunc func(ctx context.Context) (interface{}, error)
+
+// MultiLoadFunc 批量从数据源加载数据，返回的map中不存在的key会写入占位符
+type MultiLoadFunc func(ctx context.Context, keys []string) (map[string]interface{}, error)
+
+// LoaderOption set the loader options.
+type LoaderOption func(*loaderOptions)
+
+type loaderOptions struct {
+	notFoundErr    error
+	jitterRatio    float64
+	xfetchBeta     float64
+	encoding       encoding.Encoding
+	refreshTimeout time.Duration
+	loadTimeout    time.Duration
+}
+
+func (o *loaderOptions) apply(opts ...LoaderOption) {
+	for _, opt := range opts {
+		opt(o)
+	}
+}
+
+func defaultLoaderOptions() *loaderOptions {
+	return &loaderOptions{
+		notFoundErr:    ErrNotFound,
+		jitterRatio:    DefaultJitterRatio,
+		encoding:       encoding.JSONEncoding{},
+		refreshTimeout: DefaultRefreshTimeout,
+		loadTimeout:    DefaultLoadTimeout,
+	}
+}
+
+// WithNotFoundError set the error returned by the loader when data is not found,
+// it is also returned when the cache hits the placeholder
+func WithNotFoundError(err error) LoaderOption {
+	return func(o *loaderOptions) {
+		o.notFoundErr = err
+	}
+}
+
+// WithJitterRatio set the ratio of random expiration time, 0 means no jitter
+func WithJitterRatio(ratio float64) LoaderOption {
+	return func(o *loaderOptions) {
+		o.jitterRatio = ratio
+	}
+}
+
+// WithXFetchBeta enable XFetch probabilistic early refresh in GetOrRefresh, the larger the beta, the earlier the refresh,
+// 1.0 is recommended, 0 means disable (default)
+func WithXFetchBeta(beta float64) LoaderOption {
+	return func(o *loaderOptions) {
+		if beta >= 0 {
+			o.xfetchBeta = beta
+		}
+	}
+}
+
+// WithRefreshEncoding set the encoding of the value saved by GetOrRefresh, the default is json
+func WithRefreshEncoding(enc encoding.Encoding) LoaderOption {
+	return func(o *loaderOptions) {
+		if enc != nil {
+			o.encoding = enc
+		}
+	}
+}
+
+// WithRefreshTimeout set the timeout of the background refresh in GetOrRefresh, the default is 10s
+func WithRefreshTimeout(d time.Duration) LoaderOption {
+	return func(o *loaderOptions) {
+		if d > 0 {
+			o.refreshTimeout = d
+		}
+	}
+}
+
+// WithLoadTimeout set the timeout of loading data in GetOrLoad and MultiGetOrLoad, the default is 10s,
+// the loader is shared by concurrent callers of the same key, it is not canceled when a caller's ctx is done
+func WithLoadTimeout(d time.Duration) LoaderOption {
+	return func(o *loaderOptions) {
+		if d > 0 {
+			o.loadTimeout = d
+		}
+	}
+}
+
+// Loader 缓存旁路加载，缓存没有命中时从数据源加载数据并写入缓存，
+// 同一个key的并发请求只会调用一次加载函数(防止缓存击穿)，
+// 数据不存在时自动写入占位符(防止缓存穿透)，过期时间随机增加(防止缓存雪崩)
+type Loader struct {
+	cache       Cache
+	group       singleflight.Group
+	notFoundErr error
+	jitterRatio float64
+
+	xfetchBeta     float64
+	encoding       encoding.Encoding
+	refreshTimeout time.Duration
+	loadTimeout    time.Duration
+	refreshing     sync.Map // 正在后台刷新的key
+
+	mu    sync.Mutex
+	calls map[string]*loadCall // MultiGetOrLoad正在加载的key
+}
+
+// loadCall 一个key的批量加载，同一个key的并发请求等待同一次加载
+type loadCall struct {
+	done  chan struct{}
+	value interface{}
+	found bool
+	err   error
+}
+
+// NewLoader create a loader on top of cache
+func NewLoader(c Cache, opts ...LoaderOption) *Loader {
+	o := defaultLoaderOptions()
+	o.apply(opts...)
+
+	return &Loader{
+		cache:       c,
+		notFoundErr: o.notFoundErr,
+		jitterRatio: o.jitterRatio,
+
+		xfetchBeta:     o.xfetchBeta,
+		encoding:       o.encoding,
+		refreshTimeout: o.refreshTimeout,
+		loadTimeout:    o.loadTimeout,
+		calls:          make(map[string]*loadCall),
+	}
+}
+
+// GetOrLoad 从缓存获取数据，没有命中时调用loader加载数据并写入缓存
+func (l *Loader) GetOrLoad(ctx context.Context, key string, val interface{}, loader LoadFunc, expiration time.Duration) error {
+	err := l.cache.Get(ctx, key, val)
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, ErrPlaceholder) {
+		return l.notFoundErr
+	}
+	// fail fast, if cache error return, don't request to data source
+	if !errors.Is(err, CacheNotFound) {
+		return err
+	}
+
+	// 并发请求共用一次加载，每个调用者只等待到自己的ctx结束
+	ch := l.group.DoChan(key, func() (data interface{}, err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = &loaderPanic{value: p}
+			}
+		}()
+
+		loadCtx, cancel := l.loadContext(ctx)
+		defer cancel()
+		data, err = loader(loadCtx)
+		if err != nil {
+			if errors.Is(err, l.notFoundErr) {
+				_ = l.cache.SetCacheWithNotFound(loadCtx, key)
+			}
+			return nil, err
+		}
+		err = l.cache.Set(loadCtx, key, data, l.withJitter(expiration))
+		if err != nil {
+			return nil, err
+		}
+		return data, nil
+	})
+
+	select {
+	case res := <-ch:
+		var p *loaderPanic
+		if errors.As(res.Err, &p) {
+			panic(p.value)
+		}
+		if res.Err != nil {
+			return res.Err
+		}
+		return setValue(val, res.Val)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// MultiGetOrLoad 批量从缓存获取数据，没有命中的key调用loader批量加载并写入缓存，
+// 同一个key的并发请求只会加载一次，valueMap的类型为map[string]*T，key为参数keys中的key
+func (l *Loader) MultiGetOrLoad(ctx context.Context, keys []string, valueMap interface{}, loader MultiLoadFunc, expiration time.Duration) error {
+	mv := reflect.ValueOf(valueMap)
+	if mv.Kind() != reflect.Map || mv.Type().Elem().Kind() != reflect.Ptr {
+		return fmt.Errorf("valueMap must be a map[string]*T, got %v", mv.Type())
+	}
+	elemType := mv.Type().Elem().Elem()
+
+	missKeys, err := l.multiGet(ctx, keys, elemType, mv)
+	if err != nil {
+		return err
+	}
+	if len(missKeys) == 0 {
+		return nil
+	}
+
+	values, err := l.multiLoad(ctx, missKeys, loader, expiration)
+	if err != nil {
+		return err
+	}
+	for key, value := range values {
+		object := reflect.New(elemType)
+		err = setValue(object.Interface(), value)
+		if err != nil {
+			return err
+		}
+		mv.SetMapIndex(reflect.ValueOf(key), object)
+	}
+
+	return nil
+}
+
+// 批量读取缓存，返回没有命中的key，命中占位符的key不需要加载
+func (l *Loader) multiGet(ctx context.Context, keys []string, elemType reflect.Type, mv reflect.Value) ([]string, error) {
+	hits := make([]bool, len(keys))
+	newObject := func() interface{} {
+		return reflect.New(elemType).Interface()
+	}
+
+	if mg, ok := l.cache.(multiGetter); ok {
+		err := mg.multiGetEach(ctx, keys, newObject, func(_ string, i int, object interface{}) {
+			hits[i] = true
+			if object != nil {
+				mv.SetMapIndex(reflect.ValueOf(keys[i]), reflect.ValueOf(object))
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		for i, key := range keys {
+			object := newObject()
+			err := l.cache.Get(ctx, key, object)
+			switch {
+			case err == nil:
+				hits[i] = true
+				mv.SetMapIndex(reflect.ValueOf(key), reflect.ValueOf(object))
+			case errors.Is(err, ErrPlaceholder):
+				hits[i] = true
+			case !errors.Is(err, CacheNotFound):
+				// fail fast, if cache error return, don't request to data source
+				return nil, err
+			}
+		}
+	}
+
+	var missKeys []string
+	for i, key := range keys {
+		if !hits[i] {
+			missKeys = append(missKeys, key)
+		}
+	}
+	return missKeys, nil
+}
+
+// 加载没有命中的key，其他请求正在加载的key等待其结果，剩余的key调用一次loader
+func (l *Loader) multiLoad(ctx context.Context, keys []string, loader MultiLoadFunc, expiration time.Duration) (map[string]interface{}, error) {
+	calls := make(map[string]*loadCall, len(keys))
+	var ownKeys []string
+	l.mu.Lock()
+	for _, key := range keys {
+		if _, ok := calls[key]; ok {
+			continue
+		}
+		c, ok := l.calls[key]
+		if !ok {
+			c = &loadCall{done: make(chan struct{})}
+			l.calls[key] = c
+			ownKeys = append(ownKeys, key)
+		}
+		calls[key] = c
+	}
+	l.mu.Unlock()
+
+	if len(ownKeys) > 0 {
+		l.doMultiLoad(ctx, ownKeys, calls, loader, expiration)
+	}
+
+	values := make(map[string]interface{}, len(calls))
+	for key, c := range calls {
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if c.err != nil {
+			return nil, c.err
+		}
+		if c.found {
+			values[key] = c.value
+		}
+	}
+	return values, nil
+}
+
+func (l *Loader) doMultiLoad(ctx context.Context, keys []string, calls map[string]*loadCall, loader MultiLoadFunc, expiration time.Duration) {
+	var values map[string]interface{}
+	var err error
+	defer func() {
+		// 加载完成、失败或panic时都要通知等待的请求
+		p := recover()
+		if p != nil {
+			err = fmt.Errorf("cache: loader panic: %v", p)
+		}
+		l.mu.Lock()
+		for _, key := range keys {
+			c := calls[key]
+			c.value, c.found = values[key]
+			c.err = err
+			delete(l.calls, key)
+			close(c.done)
+		}
+		l.mu.Unlock()
+		if p != nil {
+			panic(p)
+		}
+	}()
+
+	ctx, cancel := l.loadContext(ctx)
+	defer cancel()
+	values, err = loader(ctx, keys)
+	if err != nil {
+		return
+	}
+	for _, key := range keys {
+		if _, ok := values[key]; !ok {
+			_ = l.cache.SetCacheWithNotFound(ctx, key)
+		}
+	}
+	if len(values) > 0 {
+		err = l.cache.MultiSet(ctx, values, l.withJitter(expiration))
+	}
+}
+
+// 加载数据使用的ctx，保留调用者ctx中的值(例如链路跟踪)，不随调用者的ctx取消，使用自己的超时时间
+func (l *Loader) loadContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(detachedContext{parent: ctx}, l.loadTimeout)
+}
+
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
+
+// loader panic时传递给所有等待的调用者
+type loaderPanic struct {
+	value interface{}
+}
+
+func (p *loaderPanic) Error() string {
+	return fmt.Sprintf("cache: loader panic: %v", p.value)
+}
+
+// 过期时间随机增加[0, expiration*jitterRatio]
+func (l *Loader) withJitter(expiration time.Duration) time.Duration {
+	if expiration <= 0 {
+		expiration = DefaultExpireTime
+	}
+	n := int64(float64(expiration) * l.jitterRatio)
+	if n <= 0 {
+		return expiration
+	}
+	return expiration + time.Duration(rand.Int63n(n+1))
+}
+
+// 把加载的数据复制到val，val必须是指针
+func setValue(val interface{}, data interface{}) error {
+	rv := reflect.ValueOf(val)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("val must be a non-nil pointer, got %v", reflect.TypeOf(val))
+	}
+
+	dv := reflect.ValueOf(data)
+	if !dv.IsValid() || (dv.Kind() == reflect.Ptr && dv.IsNil()) {
+		return fmt.Errorf("loaded data is nil, val type %v", rv.Type())
+	}
+	switch {
+	case dv.Type() == rv.Type():
+		rv.Elem().Set(dv.Elem())
+	case dv.Type().AssignableTo(rv.Elem().Type()):
+		rv.Elem().Set(dv)
+	default:
+		return fmt.Errorf("loaded data type %v does not match val type %v", dv.Type(), rv.Type())
+	}
+	return nil
+}
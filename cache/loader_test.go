@@ -0,0 +1,293 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zhufuyi/pkg/encoding"
+	"github.com/zhufuyi/pkg/gotest"
+	"github.com/zhufuyi/pkg/utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type loaderUser struct {
+	ID   uint64
+	Name string
+}
+
+var errRecordNotFound = errors.New("record not found")
+
+func newLoaderCache() *gotest.Cache {
+	record1 := &loaderUser{
+		ID:   1,
+		Name: "foo",
+	}
+	record2 := &loaderUser{
+		ID:   2,
+		Name: "bar",
+	}
+
+	testData := map[string]interface{}{
+		utils.Uint64ToStr(record1.ID): record1,
+		utils.Uint64ToStr(record2.ID): record2,
+	}
+
+	c := gotest.NewCache(testData)
+	cachePrefix := ""
+	c.ICache = NewLoader(NewRedisCache(c.RedisClient, cachePrefix, encoding.JSONEncoding{}, func() interface{} {
+		return &loaderUser{}
+	}), WithNotFoundError(errRecordNotFound), WithJitterRatio(0.2))
+
+	return c
+}
+
+func TestLoader_GetOrLoad(t *testing.T) {
+	c := newLoaderCache()
+	defer c.Close()
+	testData := c.TestDataSlice[0].(*loaderUser)
+	loader := c.ICache.(*Loader)
+	key := utils.Uint64ToStr(testData.ID)
+
+	var count int32
+	loadFn := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&count, 1)
+		time.Sleep(time.Millisecond * 100)
+		return c.TestDataMap[key], nil
+	}
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			val := &loaderUser{}
+			err := loader.GetOrLoad(c.Ctx, key, val, loadFn, time.Minute)
+			assert.NoError(t, err)
+			assert.Equal(t, testData.Name, val.Name)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&count))
+
+	// hit cache
+	val := &loaderUser{}
+	err := loader.GetOrLoad(c.Ctx, key, val, loadFn, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, testData.Name, val.Name)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&count))
+	ttl := c.RedisClient.TTL(c.Ctx, key).Val()
+	assert.True(t, ttl >= time.Minute-time.Second && ttl <= time.Minute*12/10)
+}
+
+func TestLoader_GetOrLoadNotFound(t *testing.T) {
+	c := newLoaderCache()
+	defer c.Close()
+	loader := c.ICache.(*Loader)
+
+	var count int32
+	loadFn := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&count, 1)
+		return nil, errRecordNotFound
+	}
+
+	val := &loaderUser{}
+	err := loader.GetOrLoad(c.Ctx, "not_found", val, loadFn, time.Minute)
+	assert.ErrorIs(t, err, errRecordNotFound)
+
+	// hit placeholder
+	err = loader.GetOrLoad(c.Ctx, "not_found", val, loadFn, time.Minute)
+	assert.ErrorIs(t, err, errRecordNotFound)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&count))
+
+	// loader error is not cached
+	loadErr := errors.New("db error")
+	err = loader.GetOrLoad(c.Ctx, "error", val, func(ctx context.Context) (interface{}, error) {
+		return nil, loadErr
+	}, time.Minute)
+	assert.ErrorIs(t, err, loadErr)
+	err = c.RedisClient.Get(c.Ctx, "error").Err()
+	assert.ErrorIs(t, err, CacheNotFound)
+
+	// type mismatch
+	err = loader.GetOrLoad(c.Ctx, "mismatch", val, func(ctx context.Context) (interface{}, error) {
+		return "foo", nil
+	}, time.Minute)
+	assert.Error(t, err)
+}
+
+func TestLoader_GetOrLoadCancel(t *testing.T) {
+	c := newLoaderCache()
+	defer c.Close()
+	loader := NewLoader(c.ICache.(*Loader).cache, WithLoadTimeout(time.Millisecond*300))
+	key := "1"
+
+	var count int32
+	loadFn := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&count, 1)
+		time.Sleep(time.Millisecond * 100)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return c.TestDataMap[key], nil
+	}
+
+	// 第一个调用者取消不影响其他调用者
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- loader.GetOrLoad(ctx, key, &loaderUser{}, loadFn, time.Minute)
+	}()
+	time.Sleep(time.Millisecond * 20)
+	start := time.Now()
+	cancel()
+	assert.ErrorIs(t, <-errCh, context.Canceled)
+	assert.Less(t, time.Since(start), time.Millisecond*50)
+
+	val := &loaderUser{}
+	err := loader.GetOrLoad(c.Ctx, key, val, loadFn, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", val.Name)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&count))
+
+	// 加载超时
+	err = loader.GetOrLoad(c.Ctx, "timeout", val, func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}, time.Minute)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// panic传递给调用者
+	assert.Panics(t, func() {
+		_ = loader.GetOrLoad(c.Ctx, "panic", val, func(ctx context.Context) (interface{}, error) {
+			panic("loader panic")
+		}, time.Minute)
+	})
+}
+
+func TestLoader_MultiGetOrLoad(t *testing.T) {
+	c := newLoaderCache()
+	defer c.Close()
+	loader := c.ICache.(*Loader)
+
+	var keys []string
+	for k := range c.TestDataMap {
+		keys = append(keys, k)
+	}
+	keys = append(keys, "not_found")
+
+	var count int32
+	loadFn := func(ctx context.Context, keys []string) (map[string]interface{}, error) {
+		atomic.AddInt32(&count, 1)
+		values := make(map[string]interface{})
+		for _, key := range keys {
+			if v, ok := c.TestDataMap[key]; ok {
+				values[key] = v
+			}
+		}
+		return values, nil
+	}
+
+	vals := make(map[string]*loaderUser)
+	err := loader.MultiGetOrLoad(c.Ctx, keys, vals, loadFn, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, len(c.TestDataMap), len(vals))
+
+	vals = make(map[string]*loaderUser)
+	err = loader.MultiGetOrLoad(c.Ctx, keys, vals, loadFn, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, len(c.TestDataMap), len(vals))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&count))
+
+	err = loader.MultiGetOrLoad(c.Ctx, keys, map[string]loaderUser{}, loadFn, time.Minute)
+	assert.Error(t, err)
+}
+
+func TestLoader_MultiGetOrLoadConcurrent(t *testing.T) {
+	c := newLoaderCache()
+	defer c.Close()
+	memLoader := NewLoader(NewMemoryCache("", encoding.JSONEncoding{}, func() interface{} {
+		return &loaderUser{}
+	}), WithNotFoundError(errRecordNotFound))
+
+	for _, loader := range []*Loader{c.ICache.(*Loader), memLoader} {
+		mu := sync.Mutex{}
+		counts := map[string]int{}
+		loadFn := func(ctx context.Context, keys []string) (map[string]interface{}, error) {
+			mu.Lock()
+			for _, key := range keys {
+				counts[key]++
+			}
+			mu.Unlock()
+			time.Sleep(time.Millisecond * 100)
+			values := make(map[string]interface{})
+			for _, key := range keys {
+				if v, ok := c.TestDataMap[key]; ok {
+					values[key] = v
+				}
+			}
+			return values, nil
+		}
+
+		// 不同批次中相同的key只加载一次
+		batches := [][]string{{"1", "2"}, {"2", "3"}, {"1", "3"}, {"1", "2", "3"}}
+		wg := &sync.WaitGroup{}
+		for i := 0; i < 20; i++ {
+			keys := batches[i%len(batches)]
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				vals := make(map[string]*loaderUser)
+				err := loader.MultiGetOrLoad(c.Ctx, keys, vals, loadFn, time.Minute)
+				assert.NoError(t, err)
+				for _, key := range keys {
+					if _, ok := c.TestDataMap[key]; ok {
+						assert.Equal(t, c.TestDataMap[key].(*loaderUser).Name, vals[key].Name)
+					} else {
+						assert.NotContains(t, vals, key)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, map[string]int{"1": 1, "2": 1, "3": 1}, counts)
+
+		// 命中数据和占位符，不再加载
+		vals := make(map[string]*loaderUser)
+		err := loader.MultiGetOrLoad(c.Ctx, []string{"1", "2", "3"}, vals, loadFn, time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(vals))
+		assert.Equal(t, map[string]int{"1": 1, "2": 1, "3": 1}, counts)
+	}
+}
+
+func TestLoader_MultiGetOrLoadError(t *testing.T) {
+	c := newLoaderCache()
+	defer c.Close()
+	loader := c.ICache.(*Loader)
+
+	loadErr := errors.New("db error")
+	vals := make(map[string]*loaderUser)
+	err := loader.MultiGetOrLoad(c.Ctx, []string{"1", "2"}, vals, func(ctx context.Context, keys []string) (map[string]interface{}, error) {
+		return nil, loadErr
+	}, time.Minute)
+	assert.ErrorIs(t, err, loadErr)
+
+	// panic时正在加载的key被释放
+	assert.Panics(t, func() {
+		_ = loader.MultiGetOrLoad(c.Ctx, []string{"1"}, vals, func(ctx context.Context, keys []string) (map[string]interface{}, error) {
+			panic("loader panic")
+		}, time.Minute)
+	})
+	assert.Empty(t, loader.calls)
+
+	err = loader.MultiGetOrLoad(c.Ctx, []string{"1"}, vals, func(ctx context.Context, keys []string) (map[string]interface{}, error) {
+		return map[string]interface{}{"1": c.TestDataMap["1"]}, nil
+	}, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", vals["1"].Name)
+}
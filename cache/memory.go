@@ -1,41 +1,223 @@
 package cache
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"reflect"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/zhufuyi/pkg/encoding"
+	"github.com/zhufuyi/pkg/stat"
 
 	"github.com/dgraph-io/ristretto"
 )
 
+var (
+	// DefaultMemoryMaxCost 内存缓存默认最大容量(1GB)
+	DefaultMemoryMaxCost int64 = 1 << 30
+	// DefaultMemoryNumCounters 内存缓存默认跟踪访问频率的key数量(10M)
+	DefaultMemoryNumCounters int64 = 1e7
+)
+
+// MemoryOption set the memory cache options.
+type MemoryOption func(*memoryOptions)
+
+type memoryOptions struct {
+	maxCost     int64
+	numCounters int64
+	costFunc    func(key string, data []byte) int64
+	onEvict     func(key string, data []byte, cost int64)
+	statsName   string
+}
+
+func (o *memoryOptions) apply(opts ...MemoryOption) {
+	for _, opt := range opts {
+		opt(o)
+	}
+}
+
+func defaultMemoryOptions() *memoryOptions {
+	return &memoryOptions{
+		maxCost:     DefaultMemoryMaxCost,
+		numCounters: DefaultMemoryNumCounters,
+		costFunc:    defaultCostFunc,
+	}
+}
+
+// 缓存的成本为key和编码后数据的字节数
+func defaultCostFunc(key string, data []byte) int64 {
+	return int64(len(key) + len(data))
+}
+
+// WithMaxMemory set the max memory(bytes) of the cache, the default is 1GB
+func WithMaxMemory(bytes int64) MemoryOption {
+	return func(o *memoryOptions) {
+		if bytes > 0 {
+			o.maxCost = bytes
+		}
+	}
+}
+
+// WithNumCounters set the number of keys to track frequency, it is recommended to be 10 times the number of items, the default is 10M
+func WithNumCounters(n int64) MemoryOption {
+	return func(o *memoryOptions) {
+		if n > 0 {
+			o.numCounters = n
+		}
+	}
+}
+
+// WithCostFunc set the cost function of an item, the default is the byte size of the key and encoded data
+func WithCostFunc(fn func(key string, data []byte) int64) MemoryOption {
+	return func(o *memoryOptions) {
+		if fn != nil {
+			o.costFunc = fn
+		}
+	}
+}
+
+// WithOnEvict set the callback when an item is evicted or expired, key is the cache key with prefix
+func WithOnEvict(fn func(key string, data []byte, cost int64)) MemoryOption {
+	return func(o *memoryOptions) {
+		o.onEvict = fn
+	}
+}
+
+// WithStatsExport export the cache stats periodically through the stat package logger with name,
+// stat.Init must be called to start the export
+func WithStatsExport(name string) MemoryOption {
+	return func(o *memoryOptions) {
+		o.statsName = name
+	}
+}
+
+// MemoryStats 内存缓存的统计信息
+type MemoryStats struct {
+	Hits      uint64  `json:"hits"`      // 命中次数
+	Misses    uint64  `json:"misses"`    // 未命中次数
+	HitRatio  float64 `json:"hitRatio"`  // 命中率
+	Evictions uint64  `json:"evictions"` // 被淘汰和过期的数量
+	Keys      uint64  `json:"keys"`      // 当前key数量
+	Cost      uint64  `json:"cost"`      // 当前使用的容量
+	MaxCost   int64   `json:"maxCost"`   // 最大容量
+}
+
+// StatsCache 提供统计信息的缓存，memory缓存实现了该接口
+type StatsCache interface {
+	Cache
+	Stats() MemoryStats
+}
+
+// memoryItem 保存在ristretto的数据，保存key用于淘汰回调
+type memoryItem struct {
+	key  string
+	data []byte
+}
+
+// taggedItem 缓存的标签，item用于判断淘汰的是否为打上标签的那次写入
+type taggedItem struct {
+	item *memoryItem
+	tags []string
+}
+
 type memoryCache struct {
 	client            *ristretto.Cache
 	KeyPrefix         string
 	encoding          encoding.Encoding
 	DefaultExpireTime time.Duration
 	newObject         func() interface{}
+
+	costFunc  func(key string, data []byte) int64
+	evictions uint64
+
+	setNXMutex sync.Mutex
+
+	tagMutex sync.Mutex
+	tags     map[string]map[string]struct{} // tag --> cacheKeys
+	keyTags  map[string]*taggedItem         // cacheKey --> tags
 }
 
 // NewMemoryCache create a memory cache
-func NewMemoryCache(keyPrefix string, encoding encoding.Encoding, newObject func() interface{}) Cache {
+func NewMemoryCache(keyPrefix string, encoding encoding.Encoding, newObject func() interface{}, opts ...MemoryOption) Cache {
+	o := defaultMemoryOptions()
+	o.apply(opts...)
+
+	m := &memoryCache{
+		KeyPrefix: keyPrefix,
+		encoding:  encoding,
+		newObject: newObject,
+		costFunc:  o.costFunc,
+		tags:      make(map[string]map[string]struct{}),
+		keyTags:   make(map[string]*taggedItem),
+	}
+
 	// see: https://dgraph.io/blog/post/introducing-ristretto-high-perf-go-cache/
 	//		https://www.start.io/blog/we-chose-ristretto-cache-for-go-heres-why/
 	config := &ristretto.Config{
-		NumCounters: 1e7,     // number of keys to track frequency of (10M).
-		MaxCost:     1 << 30, // maximum cost of cache (1GB).
-		BufferItems: 64,      // number of keys per Get buffer.
+		NumCounters: o.numCounters, // number of keys to track frequency of.
+		MaxCost:     o.maxCost,     // maximum cost of cache.
+		BufferItems: 64,            // number of keys per Get buffer.
+		Metrics:     true,
+		OnEvict: func(item *ristretto.Item) {
+			atomic.AddUint64(&m.evictions, 1)
+			if o.onEvict == nil {
+				return
+			}
+			if mi, ok := item.Value.(*memoryItem); ok {
+				o.onEvict(mi.key, mi.data, item.Cost)
+			}
+		},
+		// 淘汰、过期、拒绝、删除和覆盖时都会调用，删除标签索引
+		OnExit: m.untagItem,
 	}
-	store, _ := ristretto.NewCache(config)
-	return &memoryCache{
-		client:    store,
-		KeyPrefix: keyPrefix,
-		encoding:  encoding,
-		newObject: newObject,
+	m.client, _ = ristretto.NewCache(config)
+
+	if o.statsName != "" {
+		stat.Register(o.statsName, func() interface{} {
+			return m.Stats()
+		})
+	}
+
+	return m
+}
+
+// Stats 获取统计信息
+func (m *memoryCache) Stats() MemoryStats {
+	metrics := m.client.Metrics
+	return MemoryStats{
+		Hits:      metrics.Hits(),
+		Misses:    metrics.Misses(),
+		HitRatio:  metrics.Ratio(),
+		Evictions: atomic.LoadUint64(&m.evictions),
+		Keys:      metrics.KeysAdded() - metrics.KeysEvicted(),
+		Cost:      metrics.CostAdded() - metrics.CostEvicted(),
+		MaxCost:   m.client.MaxCost(),
+	}
+}
+
+func (m *memoryCache) set(cacheKey string, data []byte, expiration time.Duration) (*memoryItem, error) {
+	item := &memoryItem{key: cacheKey, data: data}
+	ok := m.client.SetWithTTL(cacheKey, item, m.costFunc(cacheKey, data), expiration)
+	if !ok {
+		return nil, errors.New("SetWithTTL failed")
+	}
+	return item, nil
+}
+
+func (m *memoryCache) get(cacheKey string) ([]byte, bool) {
+	value, ok := m.client.Get(cacheKey)
+	if !ok {
+		return nil, false
 	}
+	mi, ok := value.(*memoryItem)
+	if !ok {
+		return nil, false
+	}
+	return mi.data, true
 }
 
 // Set add cache
@@ -48,12 +230,84 @@ func (m *memoryCache) Set(ctx context.Context, key string, val interface{}, expi
 	if err != nil {
 		return fmt.Errorf("BuildCacheKey error: %v, key=%s", err, key)
 	}
-	ok := m.client.SetWithTTL(cacheKey, buf, 0, expiration)
-	if !ok {
-		return errors.New("SetWithTTL failed")
+	_, err = m.set(cacheKey, buf, expiration)
+	return err
+}
+
+// SetNX add cache if the key does not exist
+func (m *memoryCache) SetNX(ctx context.Context, key string, val interface{}, expiration time.Duration) (bool, error) {
+	buf, err := encoding.Marshal(m.encoding, val)
+	if err != nil {
+		return false, fmt.Errorf("encoding.Marshal error: %v, key=%s, val=%+v ", err, key, val)
+	}
+	cacheKey, err := BuildCacheKey(m.KeyPrefix, key)
+	if err != nil {
+		return false, fmt.Errorf("BuildCacheKey error: %v, key=%s", err, key)
 	}
 
-	return nil
+	m.setNXMutex.Lock()
+	defer m.setNXMutex.Unlock()
+	if _, ok := m.get(cacheKey); ok {
+		return false, nil
+	}
+	return m.setAndWait(cacheKey, buf, expiration)
+}
+
+// CompareAndSet set cache if the value of the key is equal to old
+func (m *memoryCache) CompareAndSet(ctx context.Context, key string, old interface{}, val interface{}, expiration time.Duration) (bool, error) {
+	oldBuf, err := encoding.Marshal(m.encoding, old)
+	if err != nil {
+		return false, fmt.Errorf("encoding.Marshal error: %v, key=%s, old=%+v ", err, key, old)
+	}
+	buf, err := encoding.Marshal(m.encoding, val)
+	if err != nil {
+		return false, fmt.Errorf("encoding.Marshal error: %v, key=%s, val=%+v ", err, key, val)
+	}
+	cacheKey, err := BuildCacheKey(m.KeyPrefix, key)
+	if err != nil {
+		return false, fmt.Errorf("BuildCacheKey error: %v, key=%s", err, key)
+	}
+
+	m.setNXMutex.Lock()
+	defer m.setNXMutex.Unlock()
+	if data, ok := m.get(cacheKey); !ok || !bytes.Equal(data, oldBuf) {
+		return false, nil
+	}
+	return m.setAndWait(cacheKey, buf, expiration)
+}
+
+// CompareAndDelete delete cache if the value of the key is equal to old
+func (m *memoryCache) CompareAndDelete(ctx context.Context, key string, old interface{}) (bool, error) {
+	oldBuf, err := encoding.Marshal(m.encoding, old)
+	if err != nil {
+		return false, fmt.Errorf("encoding.Marshal error: %v, key=%s, old=%+v ", err, key, old)
+	}
+	cacheKey, err := BuildCacheKey(m.KeyPrefix, key)
+	if err != nil {
+		return false, fmt.Errorf("BuildCacheKey error: %v, key=%s", err, key)
+	}
+
+	m.setNXMutex.Lock()
+	defer m.setNXMutex.Unlock()
+	if data, ok := m.get(cacheKey); !ok || !bytes.Equal(data, oldBuf) {
+		return false, nil
+	}
+	m.client.Del(cacheKey)
+	m.client.Wait()
+	return true, nil
+}
+
+// 写入并等待生效，下一次SetNX能读到，ristretto可能在Wait时丢弃写入，需要检查是否写入成功
+func (m *memoryCache) setAndWait(cacheKey string, data []byte, expiration time.Duration) (bool, error) {
+	item, err := m.set(cacheKey, data, expiration)
+	if err != nil {
+		return false, err
+	}
+	m.client.Wait()
+	if value, ok := m.client.Get(cacheKey); !ok || value != item {
+		return false, errors.New("SetWithTTL failed, the item is dropped")
+	}
+	return true, nil
 }
 
 // Get data
@@ -63,19 +317,19 @@ func (m *memoryCache) Get(ctx context.Context, key string, val interface{}) erro
 		return fmt.Errorf("BuildCacheKey error: %v, key=%s", err, key)
 	}
 
-	data, ok := m.client.Get(cacheKey)
+	data, ok := m.get(cacheKey)
 	if !ok {
 		return CacheNotFound
 	}
 
-	if string(data.([]byte)) == NotFoundPlaceholder {
+	if string(data) == NotFoundPlaceholder {
 		return ErrPlaceholder
 	}
 
-	err = encoding.Unmarshal(m.encoding, data.([]byte), val)
+	err = encoding.Unmarshal(m.encoding, data, val)
 	if err != nil {
 		return fmt.Errorf("encoding.Unmarshal error: %v, key=%s, cacheKey=%s, type=%v, json=%+v ",
-			err, key, cacheKey, reflect.TypeOf(val), string(data.([]byte)))
+			err, key, cacheKey, reflect.TypeOf(val), string(data))
 	}
 	return nil
 }
@@ -86,12 +340,13 @@ func (m *memoryCache) Del(ctx context.Context, keys ...string) error {
 		return nil
 	}
 
-	key := keys[0]
-	cacheKey, err := BuildCacheKey(m.KeyPrefix, key)
-	if err != nil {
-		return fmt.Errorf("build cache key error, err=%v, key=%s", err, key)
+	for _, key := range keys {
+		cacheKey, err := BuildCacheKey(m.KeyPrefix, key)
+		if err != nil {
+			return fmt.Errorf("build cache key error, err=%v, key=%s", err, key)
+		}
+		m.client.Del(cacheKey)
 	}
-	m.client.Del(cacheKey)
 	return nil
 }
 
@@ -110,14 +365,27 @@ func (m *memoryCache) MultiSet(ctx context.Context, valueMap map[string]interfac
 // MultiGet 批量获取
 func (m *memoryCache) MultiGet(ctx context.Context, keys []string, value interface{}) error {
 	valueMap := reflect.ValueOf(value)
+	return m.multiGetEach(ctx, keys, m.newObject, func(key string, i int, object interface{}) {
+		if object == nil {
+			return
+		}
+		valueMap.SetMapIndex(reflect.ValueOf(key), reflect.ValueOf(object))
+	})
+}
+
+// multiGetEach 批量获取，每个命中的key调用一次fn，命中占位符时object为nil
+func (m *memoryCache) multiGetEach(ctx context.Context, keys []string, newObject func() interface{}, fn func(key string, i int, object interface{})) error {
 	var err error
-	for _, key := range keys {
-		object := m.newObject()
+	for i, key := range keys {
+		object := newObject()
 		err = m.Get(ctx, key, object)
 		if err != nil {
+			if errors.Is(err, ErrPlaceholder) {
+				fn(key, i, nil)
+			}
 			continue
 		}
-		valueMap.SetMapIndex(reflect.ValueOf(key), reflect.ValueOf(object))
+		fn(key, i, object)
 	}
 
 	return nil
@@ -129,10 +397,93 @@ func (m *memoryCache) SetCacheWithNotFound(ctx context.Context, key string) erro
 		return fmt.Errorf("BuildCacheKey error: %v, key=%s", err, key)
 	}
 
-	ok := m.client.SetWithTTL(cacheKey, []byte(NotFoundPlaceholder), 0, DefaultNotFoundExpireTime)
-	if !ok {
-		return errors.New("SetWithTTL failed")
+	_, err = m.set(cacheKey, []byte(NotFoundPlaceholder), DefaultNotFoundExpireTime)
+	return err
+}
+
+// SetWithTags 添加缓存，并给缓存打上标签
+func (m *memoryCache) SetWithTags(ctx context.Context, key string, val interface{}, expiration time.Duration, tags ...string) error {
+	buf, err := encoding.Marshal(m.encoding, val)
+	if err != nil {
+		return fmt.Errorf("encoding.Marshal error: %v, key=%s, val=%+v ", err, key, val)
+	}
+	cacheKey, err := BuildCacheKey(m.KeyPrefix, key)
+	if err != nil {
+		return fmt.Errorf("BuildCacheKey error: %v, key=%s", err, key)
+	}
+	// 不能持有tagMutex，覆盖旧值时会同步调用untagItem
+	item, err := m.set(cacheKey, buf, expiration)
+	if err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+
+	m.tagMutex.Lock()
+	defer m.tagMutex.Unlock()
+	m.untagLocked(cacheKey)
+	ti := &taggedItem{item: item}
+	for _, tag := range tags {
+		cacheKeys, ok := m.tags[tag]
+		if !ok {
+			cacheKeys = make(map[string]struct{})
+			m.tags[tag] = cacheKeys
+		}
+		if _, ok = cacheKeys[cacheKey]; ok {
+			continue
+		}
+		cacheKeys[cacheKey] = struct{}{}
+		ti.tags = append(ti.tags, tag)
+	}
+	m.keyTags[cacheKey] = ti
+	return nil
+}
+
+// InvalidateTag 删除带有标签的所有缓存
+func (m *memoryCache) InvalidateTag(ctx context.Context, tags ...string) error {
+	m.tagMutex.Lock()
+	var cacheKeys []string
+	for _, tag := range tags {
+		for cacheKey := range m.tags[tag] {
+			cacheKeys = append(cacheKeys, cacheKey)
+		}
+	}
+	for _, cacheKey := range cacheKeys {
+		m.untagLocked(cacheKey)
 	}
+	m.tagMutex.Unlock()
 
+	for _, cacheKey := range cacheKeys {
+		m.client.Del(cacheKey)
+	}
 	return nil
 }
+
+// 缓存离开ristretto时删除它的标签，被覆盖的旧值不影响新值的标签
+func (m *memoryCache) untagItem(val interface{}) {
+	mi, ok := val.(*memoryItem)
+	if !ok {
+		return
+	}
+	m.tagMutex.Lock()
+	defer m.tagMutex.Unlock()
+	if ti, ok := m.keyTags[mi.key]; ok && ti.item == mi {
+		m.untagLocked(mi.key)
+	}
+}
+
+func (m *memoryCache) untagLocked(cacheKey string) {
+	ti, ok := m.keyTags[cacheKey]
+	if !ok {
+		return
+	}
+	for _, tag := range ti.tags {
+		cacheKeys := m.tags[tag]
+		delete(cacheKeys, cacheKey)
+		if len(cacheKeys) == 0 {
+			delete(m.tags, tag)
+		}
+	}
+	delete(m.keyTags, cacheKey)
+}
@@ -1,11 +1,16 @@
 package cache
 
 import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/zhufuyi/pkg/encoding"
 	"github.com/zhufuyi/pkg/gotest"
+	"github.com/zhufuyi/pkg/stat"
 	"github.com/zhufuyi/pkg/utils"
 
 	"github.com/stretchr/testify/assert"
@@ -120,3 +125,211 @@ func TestMemoryCacheError(t *testing.T) {
 	err = iCache.SetCacheWithNotFound(c.Ctx, "")
 	assert.Error(t, err)
 }
+
+func TestMemoryCacheTags(t *testing.T) {
+	c := newMemoryCache()
+	defer c.Close()
+	iCache := c.ICache.(TagCache)
+
+	err := iCache.SetWithTags(c.Ctx, "1", c.TestDataMap["1"], time.Minute, "user:1", "user:list")
+	assert.NoError(t, err)
+	err = iCache.SetWithTags(c.Ctx, "2", c.TestDataMap["2"], time.Minute, "user:list")
+	assert.NoError(t, err)
+	time.Sleep(time.Millisecond * 10)
+
+	err = iCache.InvalidateTag(c.Ctx, "user:1")
+	assert.NoError(t, err)
+	val := &memoryUser{}
+	err = iCache.Get(c.Ctx, "1", val)
+	assert.Equal(t, CacheNotFound, err)
+	err = iCache.Get(c.Ctx, "2", val)
+	assert.NoError(t, err)
+
+	err = iCache.InvalidateTag(c.Ctx, "user:list")
+	assert.NoError(t, err)
+	err = iCache.Get(c.Ctx, "2", val)
+	assert.Equal(t, CacheNotFound, err)
+}
+
+func TestMemoryCacheTagsPrune(t *testing.T) {
+	iCache := NewMemoryCache("", encoding.JSONEncoding{}, func() interface{} {
+		return &memoryUser{}
+	}, WithMaxMemory(1<<12), WithNumCounters(1000))
+	m := iCache.(*memoryCache)
+	ctx := context.Background()
+	tagCount := func() (int, int) {
+		m.tagMutex.Lock()
+		defer m.tagMutex.Unlock()
+		return len(m.tags), len(m.keyTags)
+	}
+
+	// Del
+	err := m.SetWithTags(ctx, "1", &memoryUser{ID: 1}, time.Minute, "user:1", "user:list")
+	assert.NoError(t, err)
+	time.Sleep(time.Millisecond * 10)
+	err = m.Del(ctx, "1")
+	assert.NoError(t, err)
+	tags, keys := tagCount()
+	assert.Equal(t, 0, tags)
+	assert.Equal(t, 0, keys)
+
+	// Set覆盖带标签的缓存
+	err = m.SetWithTags(ctx, "2", &memoryUser{ID: 2}, time.Minute, "user:2")
+	assert.NoError(t, err)
+	time.Sleep(time.Millisecond * 10)
+	err = m.SetWithTags(ctx, "2", &memoryUser{ID: 2}, time.Minute, "user:2", "user:list")
+	assert.NoError(t, err)
+	tags, keys = tagCount()
+	assert.Equal(t, 2, tags)
+	assert.Equal(t, 1, keys)
+	err = m.Set(ctx, "2", &memoryUser{ID: 2}, time.Minute)
+	assert.NoError(t, err)
+	tags, keys = tagCount()
+	assert.Equal(t, 0, tags)
+	assert.Equal(t, 0, keys)
+
+	// 过期
+	err = m.SetWithTags(ctx, "3", &memoryUser{ID: 3}, time.Millisecond*100, "user:3")
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		tags, keys := tagCount()
+		return tags == 0 && keys == 0
+	}, time.Second*10, time.Millisecond*100)
+
+	// 淘汰，标签索引的数量不超过缓存中的数量
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		err = m.SetWithTags(ctx, key, &memoryUser{ID: uint64(i), Name: strings.Repeat("x", 100)}, time.Minute, "user:"+key, "user:list")
+		assert.NoError(t, err)
+	}
+	time.Sleep(time.Millisecond * 100)
+	tags, keys = tagCount()
+	assert.Less(t, keys, 100)
+	assert.LessOrEqual(t, tags, keys+1)
+
+	err = m.InvalidateTag(ctx, "user:list")
+	assert.NoError(t, err)
+	tags, keys = tagCount()
+	assert.Equal(t, 0, tags)
+	assert.Equal(t, 0, keys)
+}
+
+func TestMemoryCacheDelMultiKeys(t *testing.T) {
+	c := newMemoryCache()
+	defer c.Close()
+	iCache := c.ICache.(Cache)
+
+	err := iCache.MultiSet(c.Ctx, c.TestDataMap, time.Minute)
+	assert.NoError(t, err)
+	time.Sleep(time.Millisecond * 10)
+
+	err = iCache.Del(c.Ctx, "1", "2")
+	assert.NoError(t, err)
+	vals := make(map[string]*memoryUser)
+	err = iCache.MultiGet(c.Ctx, []string{"1", "2"}, vals)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(vals))
+}
+
+func TestMemoryCacheOptions(t *testing.T) {
+	var evictedKeys []string
+	mu := &sync.Mutex{}
+	iCache := NewMemoryCache("user", encoding.JSONEncoding{}, func() interface{} {
+		return &memoryUser{}
+	},
+		WithMaxMemory(1<<20),
+		WithNumCounters(1000),
+		WithCostFunc(func(key string, data []byte) int64 {
+			return int64(len(data))
+		}),
+		WithOnEvict(func(key string, data []byte, cost int64) {
+			mu.Lock()
+			evictedKeys = append(evictedKeys, key)
+			mu.Unlock()
+		}),
+		WithStatsExport("user_memory_cache"),
+	)
+	ctx := context.Background()
+
+	err := iCache.Set(ctx, "1", &memoryUser{ID: 1, Name: "foo"}, time.Millisecond*100)
+	assert.NoError(t, err)
+	time.Sleep(time.Millisecond * 10)
+	val := &memoryUser{}
+	err = iCache.Get(ctx, "1", val)
+	assert.NoError(t, err)
+	err = iCache.Get(ctx, "2", val)
+	assert.Equal(t, CacheNotFound, err)
+
+	stats := iCache.(StatsCache).Stats()
+	assert.Equal(t, uint64(1), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+	assert.Equal(t, uint64(1), stats.Keys)
+	assert.Equal(t, int64(1<<20), stats.MaxCost)
+	assert.True(t, stats.Cost > 0)
+
+	// 过期的key在定时清理时触发淘汰回调
+	for i := 0; i < 100; i++ {
+		if iCache.(StatsCache).Stats().Evictions > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+	stats = iCache.(StatsCache).Stats()
+	assert.Equal(t, uint64(1), stats.Evictions)
+	mu.Lock()
+	assert.Equal(t, []string{"user:1"}, evictedKeys)
+	mu.Unlock()
+	stat.Unregister("user_memory_cache")
+}
+
+func TestMemoryCacheSetNX(t *testing.T) {
+	c := newMemoryCache()
+	defer c.Close()
+	iCache := c.ICache.(SetNXCache)
+
+	// 并发添加同一个key，只有一个成功
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	success := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ok, err := iCache.SetNX(c.Ctx, "setnx", &memoryUser{ID: uint64(i)}, time.Minute)
+			assert.NoError(t, err)
+			if ok {
+				mu.Lock()
+				success++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, 1, success)
+
+	val := &memoryUser{}
+	assert.NoError(t, iCache.Get(c.Ctx, "setnx", val))
+	assert.NoError(t, iCache.Del(c.Ctx, "setnx"))
+	time.Sleep(time.Millisecond)
+	ok, err := iCache.SetNX(c.Ctx, "setnx", val, time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	// 值等于old时才写入
+	ok, err = iCache.CompareAndSet(c.Ctx, "setnx", &memoryUser{ID: 100}, &memoryUser{ID: 101}, time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = iCache.CompareAndSet(c.Ctx, "setnx", val, &memoryUser{ID: 101}, time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.NoError(t, iCache.Get(c.Ctx, "setnx", val))
+	assert.Equal(t, uint64(101), val.ID)
+
+	ok, err = iCache.CompareAndDelete(c.Ctx, "setnx", &memoryUser{ID: 100})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = iCache.CompareAndDelete(c.Ctx, "setnx", val)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, CacheNotFound, iCache.Get(c.Ctx, "setnx", val))
+}
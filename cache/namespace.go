@@ -0,0 +1,238 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// namespaceKeyPrefix 命名空间版本号key的前缀
+const namespaceKeyPrefix = "_ns:"
+
+// NamespaceVersioner 保存命名空间的版本号
+type NamespaceVersioner interface {
+	// Version 获取命名空间当前的版本号
+	Version(ctx context.Context, namespace string) (int64, error)
+	// Incr 版本号加1，旧版本的缓存不再被访问，等待过期后自动删除
+	Incr(ctx context.Context, namespace string) (int64, error)
+}
+
+type redisVersioner struct {
+	client    *redis.Client
+	keyPrefix string
+}
+
+// NewRedisVersioner create a namespace versioner based on redis, the versions are shared by all instances,
+// keyPrefix is the same as the prefix of redis cache, the key of version is keyPrefix:_ns:namespace
+func NewRedisVersioner(client *redis.Client, keyPrefix string) NamespaceVersioner {
+	return &redisVersioner{client: client, keyPrefix: keyPrefix}
+}
+
+func (v *redisVersioner) versionKey(namespace string) (string, error) {
+	return BuildCacheKey(v.keyPrefix, namespaceKeyPrefix+namespace)
+}
+
+// Version get the version of namespace
+func (v *redisVersioner) Version(ctx context.Context, namespace string) (int64, error) {
+	key, err := v.versionKey(namespace)
+	if err != nil {
+		return 0, fmt.Errorf("build version key error: %v, namespace=%s", err, namespace)
+	}
+	version, err := v.client.Get(ctx, key).Int64()
+	if err != nil {
+		if err == redis.Nil {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("v.client.Get error: %v, namespace=%s", err, namespace)
+	}
+	return version, nil
+}
+
+// Incr increase the version of namespace
+func (v *redisVersioner) Incr(ctx context.Context, namespace string) (int64, error) {
+	key, err := v.versionKey(namespace)
+	if err != nil {
+		return 0, fmt.Errorf("build version key error: %v, namespace=%s", err, namespace)
+	}
+	version, err := v.client.Incr(ctx, key).Result()
+	if err != nil {
+		return 0, fmt.Errorf("v.client.Incr error: %v, namespace=%s", err, namespace)
+	}
+	return version, nil
+}
+
+type memoryVersioner struct {
+	mutex    sync.RWMutex
+	versions map[string]int64
+}
+
+// NewMemoryVersioner create a namespace versioner in process memory
+func NewMemoryVersioner() NamespaceVersioner {
+	return &memoryVersioner{versions: make(map[string]int64)}
+}
+
+// Version get the version of namespace
+func (v *memoryVersioner) Version(ctx context.Context, namespace string) (int64, error) {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+	return v.versions[namespace], nil
+}
+
+// Incr increase the version of namespace
+func (v *memoryVersioner) Incr(ctx context.Context, namespace string) (int64, error) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.versions[namespace]++
+	return v.versions[namespace], nil
+}
+
+// NamespaceCache 命名空间缓存，实际的key为"命名空间:版本号:key"，
+// Flush通过增加版本号使命名空间下的所有缓存失效，时间复杂度为O(1)
+type NamespaceCache struct {
+	cache     Cache
+	namespace string
+	versioner NamespaceVersioner
+}
+
+// NewNamespaceCache create a namespace cache on top of cache
+func NewNamespaceCache(c Cache, namespace string, versioner NamespaceVersioner) *NamespaceCache {
+	return &NamespaceCache{
+		cache:     c,
+		namespace: namespace,
+		versioner: versioner,
+	}
+}
+
+// Flush 使命名空间下的所有缓存失效
+func (c *NamespaceCache) Flush(ctx context.Context) error {
+	_, err := c.versioner.Incr(ctx, c.namespace)
+	return err
+}
+
+func (c *NamespaceCache) keyPrefix(ctx context.Context) (string, error) {
+	version, err := c.versioner.Version(ctx, c.namespace)
+	if err != nil {
+		return "", err
+	}
+	return c.namespace + ":" + strconv.FormatInt(version, 10) + ":", nil
+}
+
+func (c *NamespaceCache) buildKeys(ctx context.Context, keys []string) ([]string, error) {
+	prefix, err := c.keyPrefix(ctx)
+	if err != nil {
+		return nil, err
+	}
+	nsKeys := make([]string, len(keys))
+	for i, key := range keys {
+		if key == "" {
+			return nil, fmt.Errorf("[cache] key should not be empty")
+		}
+		nsKeys[i] = prefix + key
+	}
+	return nsKeys, nil
+}
+
+// Set one value
+func (c *NamespaceCache) Set(ctx context.Context, key string, val interface{}, expiration time.Duration) error {
+	nsKeys, err := c.buildKeys(ctx, []string{key})
+	if err != nil {
+		return err
+	}
+	return c.cache.Set(ctx, nsKeys[0], val, expiration)
+}
+
+// Get one value
+func (c *NamespaceCache) Get(ctx context.Context, key string, val interface{}) error {
+	nsKeys, err := c.buildKeys(ctx, []string{key})
+	if err != nil {
+		return err
+	}
+	return c.cache.Get(ctx, nsKeys[0], val)
+}
+
+// MultiSet set multiple values
+func (c *NamespaceCache) MultiSet(ctx context.Context, valueMap map[string]interface{}, expiration time.Duration) error {
+	prefix, err := c.keyPrefix(ctx)
+	if err != nil {
+		return err
+	}
+	nsValueMap := make(map[string]interface{}, len(valueMap))
+	for key, val := range valueMap {
+		nsValueMap[prefix+key] = val
+	}
+	return c.cache.MultiSet(ctx, nsValueMap, expiration)
+}
+
+// MultiGet get multiple values, valueMap type is map[string]*T, the key of valueMap is the key in keys
+func (c *NamespaceCache) MultiGet(ctx context.Context, keys []string, valueMap interface{}) error {
+	mv := reflect.ValueOf(valueMap)
+	if mv.Kind() != reflect.Map || mv.Type().Elem().Kind() != reflect.Ptr {
+		return fmt.Errorf("valueMap must be a map[string]*T, got %v", mv.Type())
+	}
+	elemType := mv.Type().Elem().Elem()
+	newObject := func() interface{} {
+		return reflect.New(elemType).Interface()
+	}
+
+	return c.multiGetEach(ctx, keys, newObject, func(key string, i int, object interface{}) {
+		if object == nil {
+			return
+		}
+		mv.SetMapIndex(reflect.ValueOf(key), reflect.ValueOf(object))
+	})
+}
+
+// multiGetEach the key passed to fn is the key in keys
+func (c *NamespaceCache) multiGetEach(ctx context.Context, keys []string, newObject func() interface{}, fn func(key string, i int, object interface{})) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	nsKeys, err := c.buildKeys(ctx, keys)
+	if err != nil {
+		return err
+	}
+
+	if mg, ok := c.cache.(multiGetter); ok {
+		return mg.multiGetEach(ctx, nsKeys, newObject, func(_ string, i int, object interface{}) {
+			fn(keys[i], i, object)
+		})
+	}
+
+	for i, nsKey := range nsKeys {
+		object := newObject()
+		err = c.cache.Get(ctx, nsKey, object)
+		if err == nil {
+			fn(keys[i], i, object)
+		} else if errors.Is(err, ErrPlaceholder) {
+			fn(keys[i], i, nil)
+		}
+	}
+	return nil
+}
+
+// Del delete multiple values
+func (c *NamespaceCache) Del(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	nsKeys, err := c.buildKeys(ctx, keys)
+	if err != nil {
+		return err
+	}
+	return c.cache.Del(ctx, nsKeys...)
+}
+
+// SetCacheWithNotFound set value for notfound
+func (c *NamespaceCache) SetCacheWithNotFound(ctx context.Context, key string) error {
+	nsKeys, err := c.buildKeys(ctx, []string{key})
+	if err != nil {
+		return err
+	}
+	return c.cache.SetCacheWithNotFound(ctx, nsKeys[0])
+}
@@ -0,0 +1,113 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zhufuyi/pkg/encoding"
+	"github.com/zhufuyi/pkg/gotest"
+	"github.com/zhufuyi/pkg/utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type namespaceUser struct {
+	ID   uint64
+	Name string
+}
+
+func newNamespaceCache() *gotest.Cache {
+	record1 := &namespaceUser{
+		ID:   1,
+		Name: "foo",
+	}
+	record2 := &namespaceUser{
+		ID:   2,
+		Name: "bar",
+	}
+
+	testData := map[string]interface{}{
+		utils.Uint64ToStr(record1.ID): record1,
+		utils.Uint64ToStr(record2.ID): record2,
+	}
+
+	c := gotest.NewCache(testData)
+	cachePrefix := "user"
+	iCache := NewRedisCache(c.RedisClient, cachePrefix, encoding.JSONEncoding{}, func() interface{} {
+		return &namespaceUser{}
+	})
+	c.ICache = NewNamespaceCache(iCache, "list", NewRedisVersioner(c.RedisClient, cachePrefix))
+
+	return c
+}
+
+func testNamespaceCache(t *testing.T, c *gotest.Cache, iCache *NamespaceCache) {
+	testData := c.TestDataSlice[0].(*namespaceUser)
+
+	key := utils.Uint64ToStr(testData.ID)
+	err := iCache.Set(c.Ctx, key, c.TestDataMap[key], time.Minute)
+	assert.NoError(t, err)
+	time.Sleep(time.Millisecond * 10)
+
+	val := &namespaceUser{}
+	err = iCache.Get(c.Ctx, key, val)
+	assert.NoError(t, err)
+	assert.Equal(t, testData.Name, val.Name)
+
+	err = iCache.Del(c.Ctx, key)
+	assert.NoError(t, err)
+
+	err = iCache.MultiSet(c.Ctx, c.TestDataMap, time.Minute)
+	assert.NoError(t, err)
+	time.Sleep(time.Millisecond * 10)
+
+	var keys []string
+	for k := range c.TestDataMap {
+		keys = append(keys, k)
+	}
+	vals := make(map[string]*namespaceUser)
+	err = iCache.MultiGet(c.Ctx, keys, vals)
+	assert.NoError(t, err)
+	assert.Equal(t, len(c.TestDataSlice), len(vals))
+	typedVals, err := NewTyped[*namespaceUser](iCache).MultiGet(c.Ctx, keys)
+	assert.NoError(t, err)
+	assert.Equal(t, len(c.TestDataSlice), len(typedVals))
+
+	err = iCache.SetCacheWithNotFound(c.Ctx, "not_found")
+	assert.NoError(t, err)
+
+	// 增加版本号后，命名空间下的所有缓存都失效
+	err = iCache.Flush(c.Ctx)
+	assert.NoError(t, err)
+	vals = make(map[string]*namespaceUser)
+	err = iCache.MultiGet(c.Ctx, keys, vals)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(vals))
+	err = iCache.Get(c.Ctx, "not_found", val)
+	assert.Equal(t, CacheNotFound, err)
+
+	err = iCache.Get(c.Ctx, "", val)
+	assert.Error(t, err)
+	err = iCache.MultiGet(c.Ctx, keys, map[string]namespaceUser{})
+	assert.Error(t, err)
+}
+
+func TestNamespaceRedisCache(t *testing.T) {
+	c := newNamespaceCache()
+	defer c.Close()
+	testNamespaceCache(t, c, c.ICache.(*NamespaceCache))
+
+	// 版本号的key带有缓存前缀
+	version, err := c.RedisClient.Get(c.Ctx, "user:_ns:list").Int64()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), version)
+}
+
+func TestNamespaceMemoryCache(t *testing.T) {
+	c := newNamespaceCache()
+	defer c.Close()
+	iCache := NewMemoryCache("user", encoding.JSONEncoding{}, func() interface{} {
+		return &namespaceUser{}
+	})
+	testNamespaceCache(t, c, NewNamespaceCache(iCache, "list", NewMemoryVersioner()))
+}
@@ -0,0 +1,474 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+const observeTracerName = "github.com/zhufuyi/pkg/cache"
+
+var (
+	observeNamespace = "cache"
+
+	observeLabels   = []string{"name", "prefix"}
+	observeOpLabels = []string{"name", "prefix", "op"}
+
+	observeMetricsMutex sync.Mutex
+	observeMetricsMap   = map[prometheus.Registerer]*observeMetrics{}
+)
+
+type observeMetrics struct {
+	hits            *prometheus.CounterVec
+	misses          *prometheus.CounterVec
+	placeholderHits *prometheus.CounterVec
+	errors          *prometheus.CounterVec
+	duration        *prometheus.HistogramVec
+}
+
+// get the metrics registered to the registerer, register them for the first time,
+// if the metrics have been registered by other code, use the registered ones
+func getObserveMetrics(registerer prometheus.Registerer) *observeMetrics {
+	observeMetricsMutex.Lock()
+	defer observeMetricsMutex.Unlock()
+	if m, ok := observeMetricsMap[registerer]; ok {
+		return m
+	}
+
+	m := &observeMetrics{
+		hits: registerCollector(registerer, prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: observeNamespace,
+				Name:      "hits_total",
+				Help:      "Total number of cache hits.",
+			}, observeLabels,
+		)),
+		misses: registerCollector(registerer, prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: observeNamespace,
+				Name:      "misses_total",
+				Help:      "Total number of cache misses.",
+			}, observeLabels,
+		)),
+		placeholderHits: registerCollector(registerer, prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: observeNamespace,
+				Name:      "placeholder_hits_total",
+				Help:      "Total number of cache hits on the not found placeholder.",
+			}, observeLabels,
+		)),
+		errors: registerCollector(registerer, prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: observeNamespace,
+				Name:      "errors_total",
+				Help:      "Total number of cache operation errors.",
+			}, observeOpLabels,
+		)),
+		duration: registerCollector(registerer, prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: observeNamespace,
+				Name:      "operation_duration_seconds",
+				Help:      "Cache operation latencies in seconds.",
+				Buckets:   []float64{.0001, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+			}, observeOpLabels,
+		)),
+	}
+	observeMetricsMap[registerer] = m
+	return m
+}
+
+func registerCollector[T prometheus.Collector](registerer prometheus.Registerer, c T) T {
+	err := registerer.Register(c)
+	if err == nil {
+		return c
+	}
+	var are prometheus.AlreadyRegisteredError
+	if errors.As(err, &are) {
+		if existing, ok := are.ExistingCollector.(T); ok {
+			return existing
+		}
+	}
+	panic(err)
+}
+
+// ObserveOption set the observed cache options.
+type ObserveOption func(*observeOptions)
+
+type observeOptions struct {
+	registerer     prometheus.Registerer
+	tracerProvider oteltrace.TracerProvider
+	prefixFunc     func(key string) string
+}
+
+func (o *observeOptions) apply(opts ...ObserveOption) {
+	for _, opt := range opts {
+		opt(o)
+	}
+}
+
+func defaultObserveOptions() *observeOptions {
+	return &observeOptions{
+		registerer: prometheus.DefaultRegisterer,
+	}
+}
+
+// WithRegisterer set the prometheus registerer, the metrics are registered once per registerer, default is prometheus.DefaultRegisterer
+func WithRegisterer(registerer prometheus.Registerer) ObserveOption {
+	return func(o *observeOptions) {
+		o.registerer = registerer
+	}
+}
+
+// WithObserveTracerProvider set the tracer provider, default is the global provider set by tracer.Init
+func WithObserveTracerProvider(provider oteltrace.TracerProvider) ObserveOption {
+	return func(o *observeOptions) {
+		o.tracerProvider = provider
+	}
+}
+
+// WithPrefixFunc set the function to get the prefix label from the key
+func WithPrefixFunc(fn func(key string) string) ObserveOption {
+	return func(o *observeOptions) {
+		o.prefixFunc = fn
+	}
+}
+
+type observedCache struct {
+	cache      Cache
+	name       string
+	prefixFunc func(key string) string
+	tracer     oteltrace.Tracer
+	metrics    *observeMetrics
+}
+
+// NewObservedCache 包装cache，记录命中、未命中、占位符命中、错误和耗时的prometheus指标，并且创建链路跟踪span，
+// 指标的标签为缓存名称name和key的前缀，
+// c实现了TagCache、SetNXCache、StatsCache时，返回的缓存也实现了这些接口
+func NewObservedCache(c Cache, name string, opts ...ObserveOption) Cache {
+	o := defaultObserveOptions()
+	o.apply(opts...)
+
+	if o.tracerProvider == nil {
+		o.tracerProvider = otel.GetTracerProvider()
+	}
+	if o.prefixFunc == nil {
+		o.prefixFunc = defaultPrefixFunc(getKeyPrefix(c))
+	}
+
+	oc := &observedCache{
+		cache:      c,
+		name:       name,
+		prefixFunc: o.prefixFunc,
+		tracer:     o.tracerProvider.Tracer(observeTracerName),
+		metrics:    getObserveMetrics(o.registerer),
+	}
+	return oc.withInterfaces()
+}
+
+type observedBase interface {
+	Cache
+	multiGetter
+}
+
+type tagMethods interface {
+	SetWithTags(ctx context.Context, key string, val interface{}, expiration time.Duration, tags ...string) error
+	InvalidateTag(ctx context.Context, tags ...string) error
+}
+
+type setNXMethods interface {
+	SetNX(ctx context.Context, key string, val interface{}, expiration time.Duration) (bool, error)
+	CompareAndSet(ctx context.Context, key string, old interface{}, val interface{}, expiration time.Duration) (bool, error)
+	CompareAndDelete(ctx context.Context, key string, old interface{}) (bool, error)
+}
+
+type statsMethods interface {
+	Stats() MemoryStats
+}
+
+// 只暴露被包装的缓存实现了的接口，调用方通过类型断言判断是否支持
+func (c *observedCache) withInterfaces() Cache {
+	_, isTag := c.cache.(TagCache)
+	_, isSetNX := c.cache.(SetNXCache)
+	_, isStats := c.cache.(StatsCache)
+
+	switch {
+	case isTag && isSetNX && isStats:
+		return struct {
+			observedBase
+			tagMethods
+			setNXMethods
+			statsMethods
+		}{c, c, c, c}
+	case isTag && isSetNX:
+		return struct {
+			observedBase
+			tagMethods
+			setNXMethods
+		}{c, c, c}
+	case isTag && isStats:
+		return struct {
+			observedBase
+			tagMethods
+			statsMethods
+		}{c, c, c}
+	case isSetNX && isStats:
+		return struct {
+			observedBase
+			setNXMethods
+			statsMethods
+		}{c, c, c}
+	case isTag:
+		return struct {
+			observedBase
+			tagMethods
+		}{c, c}
+	case isSetNX:
+		return struct {
+			observedBase
+			setNXMethods
+		}{c, c}
+	case isStats:
+		return struct {
+			observedBase
+			statsMethods
+		}{c, c}
+	}
+	return struct{ observedBase }{c}
+}
+
+// 如果缓存设置了前缀，使用缓存的前缀，否则使用key中第一个冒号之前的部分
+func defaultPrefixFunc(keyPrefix string) func(key string) string {
+	return func(key string) string {
+		if keyPrefix != "" {
+			return keyPrefix
+		}
+		if i := strings.Index(key, ":"); i > 0 {
+			return key[:i]
+		}
+		return ""
+	}
+}
+
+func getKeyPrefix(c Cache) string {
+	switch v := c.(type) {
+	case *redisCache:
+		return v.KeyPrefix
+	case *memoryCache:
+		return v.KeyPrefix
+	case *TwoLevelCache:
+		return v.KeyPrefix
+	}
+	return ""
+}
+
+func (c *observedCache) start(ctx context.Context, op string, keys ...string) (context.Context, oteltrace.Span, time.Time) {
+	attrs := []attribute.KeyValue{
+		attribute.String("cache.name", c.name),
+		attribute.String("cache.operation", op),
+	}
+	if len(keys) == 1 {
+		attrs = append(attrs, attribute.String("cache.key", keys[0]))
+	} else {
+		attrs = append(attrs, attribute.Int("cache.keys", len(keys)))
+	}
+	ctx, span := c.tracer.Start(ctx, "cache."+op,
+		oteltrace.WithSpanKind(oteltrace.SpanKindClient),
+		oteltrace.WithAttributes(attrs...),
+	)
+	return ctx, span, time.Now()
+}
+
+func (c *observedCache) end(span oteltrace.Span, start time.Time, op string, prefix string, err error) {
+	c.metrics.duration.WithLabelValues(c.name, prefix, op).Observe(time.Since(start).Seconds())
+	if err != nil {
+		c.metrics.errors.WithLabelValues(c.name, prefix, op).Inc()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (c *observedCache) keysPrefix(keys []string) string {
+	if len(keys) == 0 {
+		return ""
+	}
+	return c.prefixFunc(keys[0])
+}
+
+// Set one value
+func (c *observedCache) Set(ctx context.Context, key string, val interface{}, expiration time.Duration) error {
+	ctx, span, start := c.start(ctx, "Set", key)
+	err := c.cache.Set(ctx, key, val, expiration)
+	c.end(span, start, "Set", c.prefixFunc(key), err)
+	return err
+}
+
+// Get one value
+func (c *observedCache) Get(ctx context.Context, key string, val interface{}) error {
+	ctx, span, start := c.start(ctx, "Get", key)
+	err := c.cache.Get(ctx, key, val)
+
+	prefix := c.prefixFunc(key)
+	spanErr := err
+	switch {
+	case err == nil:
+		c.metrics.hits.WithLabelValues(c.name, prefix).Inc()
+		span.SetAttributes(attribute.Bool("cache.hit", true))
+	case errors.Is(err, ErrPlaceholder):
+		c.metrics.placeholderHits.WithLabelValues(c.name, prefix).Inc()
+		span.SetAttributes(attribute.Bool("cache.hit", true), attribute.Bool("cache.placeholder", true))
+		spanErr = nil // placeholder and not found are not errors
+	case errors.Is(err, CacheNotFound):
+		c.metrics.misses.WithLabelValues(c.name, prefix).Inc()
+		span.SetAttributes(attribute.Bool("cache.hit", false))
+		spanErr = nil
+	}
+	c.end(span, start, "Get", prefix, spanErr)
+
+	return err
+}
+
+// MultiSet set multiple values
+func (c *observedCache) MultiSet(ctx context.Context, valueMap map[string]interface{}, expiration time.Duration) error {
+	keys := make([]string, 0, len(valueMap))
+	for key := range valueMap {
+		keys = append(keys, key)
+	}
+	ctx, span, start := c.start(ctx, "MultiSet", keys...)
+	err := c.cache.MultiSet(ctx, valueMap, expiration)
+	c.end(span, start, "MultiSet", c.keysPrefix(keys), err)
+	return err
+}
+
+// MultiGet get multiple values
+func (c *observedCache) MultiGet(ctx context.Context, keys []string, valueMap interface{}) error {
+	ctx, span, start := c.start(ctx, "MultiGet", keys...)
+	before := mapLen(valueMap)
+	err := c.cache.MultiGet(ctx, keys, valueMap)
+	prefix := c.keysPrefix(keys)
+	if err == nil {
+		c.observeHits(span, prefix, len(keys), mapLen(valueMap)-before)
+	}
+	c.end(span, start, "MultiGet", prefix, err)
+	return err
+}
+
+// multiGetEach used by Typed cache
+func (c *observedCache) multiGetEach(ctx context.Context, keys []string, newObject func() interface{}, fn func(key string, i int, object interface{})) error {
+	ctx, span, start := c.start(ctx, "MultiGet", keys...)
+	hits := 0
+	var err error
+	if mg, ok := c.cache.(multiGetter); ok {
+		err = mg.multiGetEach(ctx, keys, newObject, func(key string, i int, object interface{}) {
+			hits++
+			fn(key, i, object)
+		})
+	} else {
+		for i, key := range keys {
+			object := newObject()
+			getErr := c.cache.Get(ctx, key, object)
+			if getErr == nil {
+				hits++
+				fn(key, i, object)
+			} else if errors.Is(getErr, ErrPlaceholder) {
+				hits++
+				fn(key, i, nil)
+			}
+		}
+	}
+	prefix := c.keysPrefix(keys)
+	if err == nil {
+		c.observeHits(span, prefix, len(keys), hits)
+	}
+	c.end(span, start, "MultiGet", prefix, err)
+	return err
+}
+
+func (c *observedCache) observeHits(span oteltrace.Span, prefix string, total int, hits int) {
+	if hits < 0 {
+		hits = 0
+	}
+	c.metrics.hits.WithLabelValues(c.name, prefix).Add(float64(hits))
+	if total > hits {
+		c.metrics.misses.WithLabelValues(c.name, prefix).Add(float64(total - hits))
+	}
+	span.SetAttributes(attribute.Int("cache.hits", hits))
+}
+
+// Del delete multiple values
+func (c *observedCache) Del(ctx context.Context, keys ...string) error {
+	ctx, span, start := c.start(ctx, "Del", keys...)
+	err := c.cache.Del(ctx, keys...)
+	c.end(span, start, "Del", c.keysPrefix(keys), err)
+	return err
+}
+
+// SetCacheWithNotFound set value for notfound
+func (c *observedCache) SetCacheWithNotFound(ctx context.Context, key string) error {
+	ctx, span, start := c.start(ctx, "SetCacheWithNotFound", key)
+	err := c.cache.SetCacheWithNotFound(ctx, key)
+	c.end(span, start, "SetCacheWithNotFound", c.prefixFunc(key), err)
+	return err
+}
+
+// SetWithTags set one value with tags
+func (c *observedCache) SetWithTags(ctx context.Context, key string, val interface{}, expiration time.Duration, tags ...string) error {
+	ctx, span, start := c.start(ctx, "SetWithTags", key)
+	err := c.cache.(TagCache).SetWithTags(ctx, key, val, expiration, tags...)
+	c.end(span, start, "SetWithTags", c.prefixFunc(key), err)
+	return err
+}
+
+// InvalidateTag delete all values with tags
+func (c *observedCache) InvalidateTag(ctx context.Context, tags ...string) error {
+	ctx, span, start := c.start(ctx, "InvalidateTag", tags...)
+	err := c.cache.(TagCache).InvalidateTag(ctx, tags...)
+	c.end(span, start, "InvalidateTag", "", err)
+	return err
+}
+
+// SetNX set the value if the key does not exist
+func (c *observedCache) SetNX(ctx context.Context, key string, val interface{}, expiration time.Duration) (bool, error) {
+	ctx, span, start := c.start(ctx, "SetNX", key)
+	ok, err := c.cache.(SetNXCache).SetNX(ctx, key, val, expiration)
+	c.end(span, start, "SetNX", c.prefixFunc(key), err)
+	return ok, err
+}
+
+// CompareAndSet set the value if the value of the key is equal to old
+func (c *observedCache) CompareAndSet(ctx context.Context, key string, old interface{}, val interface{}, expiration time.Duration) (bool, error) {
+	ctx, span, start := c.start(ctx, "CompareAndSet", key)
+	ok, err := c.cache.(SetNXCache).CompareAndSet(ctx, key, old, val, expiration)
+	c.end(span, start, "CompareAndSet", c.prefixFunc(key), err)
+	return ok, err
+}
+
+// CompareAndDelete delete the value if the value of the key is equal to old
+func (c *observedCache) CompareAndDelete(ctx context.Context, key string, old interface{}) (bool, error) {
+	ctx, span, start := c.start(ctx, "CompareAndDelete", key)
+	ok, err := c.cache.(SetNXCache).CompareAndDelete(ctx, key, old)
+	c.end(span, start, "CompareAndDelete", c.prefixFunc(key), err)
+	return ok, err
+}
+
+// Stats get the statistics of the cache
+func (c *observedCache) Stats() MemoryStats {
+	return c.cache.(StatsCache).Stats()
+}
+
+func mapLen(valueMap interface{}) int {
+	v := reflect.ValueOf(valueMap)
+	if v.Kind() != reflect.Map {
+		return 0
+	}
+	return v.Len()
+}
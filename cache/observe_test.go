@@ -0,0 +1,186 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zhufuyi/pkg/encoding"
+	"github.com/zhufuyi/pkg/gotest"
+	"github.com/zhufuyi/pkg/utils"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type observeUser struct {
+	ID   uint64
+	Name string
+}
+
+func newObservedCache(name string, registry *prometheus.Registry, sr *tracetest.SpanRecorder, isMemory bool) *gotest.Cache {
+	record1 := &observeUser{
+		ID:   1,
+		Name: "foo",
+	}
+	record2 := &observeUser{
+		ID:   2,
+		Name: "bar",
+	}
+
+	testData := map[string]interface{}{
+		utils.Uint64ToStr(record1.ID): record1,
+		utils.Uint64ToStr(record2.ID): record2,
+	}
+
+	c := gotest.NewCache(testData)
+	cachePrefix := "user"
+	newObject := func() interface{} {
+		return &observeUser{}
+	}
+	var iCache Cache
+	if isMemory {
+		iCache = NewMemoryCache(cachePrefix, encoding.JSONEncoding{}, newObject)
+	} else {
+		iCache = NewRedisCache(c.RedisClient, cachePrefix, encoding.JSONEncoding{}, newObject)
+	}
+	c.ICache = NewObservedCache(iCache, name,
+		WithRegisterer(registry),
+		WithObserveTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))),
+	)
+
+	return c
+}
+
+func testObservedCache(t *testing.T, name string, isMemory bool) {
+	sr := tracetest.NewSpanRecorder()
+	registry := prometheus.NewRegistry()
+	c := newObservedCache(name, registry, sr, isMemory)
+	defer c.Close()
+	testData := c.TestDataSlice[0].(*observeUser)
+	iCache := c.ICache.(Cache)
+
+	key := utils.Uint64ToStr(testData.ID)
+	err := iCache.Set(c.Ctx, key, c.TestDataMap[key], time.Minute)
+	assert.NoError(t, err)
+	time.Sleep(time.Millisecond * 10)
+
+	val := &observeUser{}
+	err = iCache.Get(c.Ctx, key, val)
+	assert.NoError(t, err)
+	assert.Equal(t, testData.Name, val.Name)
+
+	err = iCache.Get(c.Ctx, "not_exist", val)
+	assert.Equal(t, CacheNotFound, err)
+
+	err = iCache.SetCacheWithNotFound(c.Ctx, "not_found")
+	assert.NoError(t, err)
+	time.Sleep(time.Millisecond * 10)
+	err = iCache.Get(c.Ctx, "not_found", val)
+	assert.Equal(t, ErrPlaceholder, err)
+
+	err = iCache.Get(c.Ctx, "", val)
+	assert.Error(t, err)
+
+	err = iCache.MultiSet(c.Ctx, c.TestDataMap, time.Minute)
+	assert.NoError(t, err)
+	time.Sleep(time.Millisecond * 10)
+	var keys []string
+	for k := range c.TestDataMap {
+		keys = append(keys, k)
+	}
+	vals := make(map[string]*observeUser)
+	err = iCache.MultiGet(c.Ctx, append(keys, "not_exist"), vals)
+	assert.NoError(t, err)
+	assert.Equal(t, len(c.TestDataSlice), len(vals))
+
+	typedVals, err := NewTyped[observeUser](iCache).MultiGet(c.Ctx, keys)
+	assert.NoError(t, err)
+	assert.Equal(t, len(c.TestDataSlice), len(typedVals))
+
+	err = iCache.Del(c.Ctx, key)
+	assert.NoError(t, err)
+
+	metrics := getObserveMetrics(registry)
+	assert.Equal(t, float64(5), testutil.ToFloat64(metrics.hits.WithLabelValues(name, "user")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(metrics.misses.WithLabelValues(name, "user")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.placeholderHits.WithLabelValues(name, "user")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.errors.WithLabelValues(name, "user", "Get")))
+	assert.Equal(t, 10, len(sr.Ended()))
+}
+
+func TestObservedRedisCache(t *testing.T) {
+	testObservedCache(t, "redis", false)
+}
+
+func TestObservedMemoryCache(t *testing.T) {
+	testObservedCache(t, "memory", true)
+}
+
+func TestDefaultPrefixFunc(t *testing.T) {
+	assert.Equal(t, "user", defaultPrefixFunc("user")("1"))
+	assert.Equal(t, "user", defaultPrefixFunc("")("user:1"))
+	assert.Equal(t, "", defaultPrefixFunc("")("1"))
+}
+
+func TestObservedCacheInterfaces(t *testing.T) {
+	newObject := func() interface{} { return &observeUser{} }
+	memCache := NewMemoryCache("user", encoding.JSONEncoding{}, newObject)
+	iCache := NewObservedCache(memCache, "memory", WithRegisterer(prometheus.NewRegistry()))
+
+	// 被包装的缓存实现的接口不被隐藏
+	_, ok := iCache.(TagCache)
+	assert.True(t, ok)
+	sc, ok := iCache.(SetNXCache)
+	assert.True(t, ok)
+	_, ok = iCache.(StatsCache)
+	assert.True(t, ok)
+	_, ok = iCache.(multiGetter)
+	assert.True(t, ok)
+	ok, err := sc.SetNX(context.Background(), "1", &observeUser{ID: 1}, time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	// 没有实现的接口也不暴露
+	iCache = NewObservedCache(struct{ Cache }{memCache}, "plain", WithRegisterer(prometheus.NewRegistry()))
+	_, ok = iCache.(TagCache)
+	assert.False(t, ok)
+	_, ok = iCache.(SetNXCache)
+	assert.False(t, ok)
+	_, ok = iCache.(StatsCache)
+	assert.False(t, ok)
+}
+
+func TestObservedCacheRegisterer(t *testing.T) {
+	memCache := NewMemoryCache("user", encoding.JSONEncoding{}, nil)
+
+	// 每个registerer都注册指标，同一个registerer只注册一次
+	registry1, registry2 := prometheus.NewRegistry(), prometheus.NewRegistry()
+	c1 := NewObservedCache(memCache, "c1", WithRegisterer(registry1))
+	c2 := NewObservedCache(memCache, "c2", WithRegisterer(registry1))
+	c3 := NewObservedCache(memCache, "c3", WithRegisterer(registry2))
+	for _, c := range []Cache{c1, c2, c3} {
+		_ = c.Get(context.Background(), "1", &observeUser{})
+	}
+	n, err := testutil.GatherAndCount(registry1, "cache_misses_total")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	n, err = testutil.GatherAndCount(registry2, "cache_misses_total")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	// 指标已经被其他代码注册时使用已经注册的指标
+	registry3 := prometheus.NewRegistry()
+	misses := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: observeNamespace,
+		Name:      "misses_total",
+		Help:      "Total number of cache misses.",
+	}, observeLabels)
+	registry3.MustRegister(misses)
+	c4 := NewObservedCache(memCache, "c4", WithRegisterer(registry3))
+	_ = c4.Get(context.Background(), "1", &observeUser{})
+	assert.Equal(t, float64(1), testutil.ToFloat64(misses.WithLabelValues("c4", "user")))
+}
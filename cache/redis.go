@@ -56,6 +56,87 @@ func (c *redisCache) Set(ctx context.Context, key string, val interface{}, expir
 	return nil
 }
 
+// SetNX set the value if the key does not exist
+func (c *redisCache) SetNX(ctx context.Context, key string, val interface{}, expiration time.Duration) (bool, error) {
+	buf, err := encoding.Marshal(c.encoding, val)
+	if err != nil {
+		return false, fmt.Errorf("encoding.Marshal error: %v, key=%s, val=%+v ", err, key, val)
+	}
+
+	cacheKey, err := BuildCacheKey(c.KeyPrefix, key)
+	if err != nil {
+		return false, fmt.Errorf("BuildCacheKey error: %v, key=%s", err, key)
+	}
+	if expiration == 0 {
+		expiration = DefaultExpireTime
+	}
+	ok, err := c.client.SetNX(ctx, cacheKey, buf, expiration).Result()
+	if err != nil {
+		return false, fmt.Errorf("c.client.SetNX error: %v, cacheKey=%s", err, cacheKey)
+	}
+	return ok, nil
+}
+
+// 缓存的值等于ARGV[1]时写入ARGV[2]
+var compareAndSetScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+	return 1
+end
+return 0
+`)
+
+// CompareAndSet set the value if the value of the key is equal to old
+func (c *redisCache) CompareAndSet(ctx context.Context, key string, old interface{}, val interface{}, expiration time.Duration) (bool, error) {
+	oldBuf, err := encoding.Marshal(c.encoding, old)
+	if err != nil {
+		return false, fmt.Errorf("encoding.Marshal error: %v, key=%s, old=%+v ", err, key, old)
+	}
+	buf, err := encoding.Marshal(c.encoding, val)
+	if err != nil {
+		return false, fmt.Errorf("encoding.Marshal error: %v, key=%s, val=%+v ", err, key, val)
+	}
+
+	cacheKey, err := BuildCacheKey(c.KeyPrefix, key)
+	if err != nil {
+		return false, fmt.Errorf("BuildCacheKey error: %v, key=%s", err, key)
+	}
+	if expiration == 0 {
+		expiration = DefaultExpireTime
+	}
+	n, err := compareAndSetScript.Run(ctx, c.client, []string{cacheKey}, oldBuf, buf, expiration.Milliseconds()).Int()
+	if err != nil {
+		return false, fmt.Errorf("compareAndSetScript.Run error: %v, cacheKey=%s", err, cacheKey)
+	}
+	return n == 1, nil
+}
+
+// 缓存的值等于ARGV[1]时删除
+var compareAndDeleteScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// CompareAndDelete delete the value if the value of the key is equal to old
+func (c *redisCache) CompareAndDelete(ctx context.Context, key string, old interface{}) (bool, error) {
+	oldBuf, err := encoding.Marshal(c.encoding, old)
+	if err != nil {
+		return false, fmt.Errorf("encoding.Marshal error: %v, key=%s, old=%+v ", err, key, old)
+	}
+
+	cacheKey, err := BuildCacheKey(c.KeyPrefix, key)
+	if err != nil {
+		return false, fmt.Errorf("BuildCacheKey error: %v, key=%s", err, key)
+	}
+	n, err := compareAndDeleteScript.Run(ctx, c.client, []string{cacheKey}, oldBuf).Int()
+	if err != nil {
+		return false, fmt.Errorf("compareAndDeleteScript.Run error: %v, cacheKey=%s", err, cacheKey)
+	}
+	return n == 1, nil
+}
+
 // Get one value
 func (c *redisCache) Get(ctx context.Context, key string, val interface{}) error {
 	cacheKey, err := BuildCacheKey(c.KeyPrefix, key)
@@ -131,6 +212,18 @@ func (c *redisCache) MultiSet(ctx context.Context, valueMap map[string]interface
 
 // MultiGet get multiple values
 func (c *redisCache) MultiGet(ctx context.Context, keys []string, value interface{}) error {
+	// 通过反射注入到map
+	valueMap := reflect.ValueOf(value)
+	return c.multiGetEach(ctx, keys, c.newObject, func(cacheKey string, i int, object interface{}) {
+		if object == nil {
+			return
+		}
+		valueMap.SetMapIndex(reflect.ValueOf(cacheKey), reflect.ValueOf(object))
+	})
+}
+
+// multiGetEach get multiple values, fn is called for each hit key, the object is nil if the placeholder is hit
+func (c *redisCache) multiGetEach(ctx context.Context, keys []string, newObject func() interface{}, fn func(cacheKey string, i int, object interface{})) error {
 	if len(keys) == 0 {
 		return nil
 	}
@@ -147,19 +240,21 @@ func (c *redisCache) MultiGet(ctx context.Context, keys []string, value interfac
 		return fmt.Errorf("c.client.MGet error: %v, keys=%+v", err, cacheKeys)
 	}
 
-	// 通过反射注入到map
-	valueMap := reflect.ValueOf(value)
 	for i, v := range values {
 		if v == nil {
 			continue
 		}
-		object := c.newObject()
+		if v.(string) == NotFoundPlaceholder {
+			fn(cacheKeys[i], i, nil)
+			continue
+		}
+		object := newObject()
 		err = encoding.Unmarshal(c.encoding, []byte(v.(string)), object)
 		if err != nil {
 			//logger.Warnf("unmarshal data error: %+v, key=%s, cacheKey=%s type=%v", err, keys[i], cacheKeys[i], reflect.TypeOf(value))
 			continue
 		}
-		valueMap.SetMapIndex(reflect.ValueOf(cacheKeys[i]), reflect.ValueOf(object))
+		fn(cacheKeys[i], i, object)
 	}
 	return nil
 }
@@ -197,6 +292,80 @@ func (c *redisCache) SetCacheWithNotFound(ctx context.Context, key string) error
 	return c.client.Set(ctx, cacheKey, NotFoundPlaceholder, DefaultNotFoundExpireTime).Err()
 }
 
+// tagKeyPrefix 标签集合key的前缀，集合中保存带有该标签的缓存key
+const tagKeyPrefix = "_tag:"
+
+// 写入缓存，并把缓存key添加到标签集合，标签集合的过期时间不小于缓存的过期时间
+var setWithTagsScript = redis.NewScript(`
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+for i = 2, #KEYS do
+	redis.call('SADD', KEYS[i], KEYS[1])
+	local ttl = redis.call('PTTL', KEYS[i])
+	if ttl == -1 or (ttl >= 0 and ttl < tonumber(ARGV[2])) then
+		redis.call('PEXPIRE', KEYS[i], ARGV[2])
+	end
+end
+return 1
+`)
+
+// 删除标签集合中的所有缓存key和标签集合
+var invalidateTagScript = redis.NewScript(`
+local n = 0
+for i = 1, #KEYS do
+	local members = redis.call('SMEMBERS', KEYS[i])
+	for _, key in ipairs(members) do
+		n = n + redis.call('DEL', key)
+	end
+	redis.call('DEL', KEYS[i])
+end
+return n
+`)
+
+// SetWithTags set one value with tags
+func (c *redisCache) SetWithTags(ctx context.Context, key string, val interface{}, expiration time.Duration, tags ...string) error {
+	buf, err := encoding.Marshal(c.encoding, val)
+	if err != nil {
+		return fmt.Errorf("encoding.Marshal error: %v, key=%s, val=%+v ", err, key, val)
+	}
+
+	cacheKey, err := BuildCacheKey(c.KeyPrefix, key)
+	if err != nil {
+		return fmt.Errorf("BuildCacheKey error: %v, key=%s", err, key)
+	}
+	if expiration == 0 {
+		expiration = DefaultExpireTime
+	}
+
+	keys := []string{cacheKey}
+	for _, tag := range tags {
+		tagKey, _ := BuildCacheKey(c.KeyPrefix, tagKeyPrefix+tag)
+		keys = append(keys, tagKey)
+	}
+	err = setWithTagsScript.Run(ctx, c.client, keys, buf, expiration.Milliseconds()).Err()
+	if err != nil {
+		return fmt.Errorf("setWithTagsScript.Run error: %v, cacheKey=%s, tags=%+v", err, cacheKey, tags)
+	}
+	return nil
+}
+
+// InvalidateTag delete all values with tags
+func (c *redisCache) InvalidateTag(ctx context.Context, tags ...string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tagKey, _ := BuildCacheKey(c.KeyPrefix, tagKeyPrefix+tag)
+		keys = append(keys, tagKey)
+	}
+	err := invalidateTagScript.Run(ctx, c.client, keys).Err()
+	if err != nil {
+		return fmt.Errorf("invalidateTagScript.Run error: %v, tags=%+v", err, tags)
+	}
+	return nil
+}
+
 // BuildCacheKey 构建一个带有前缀的缓存key
 func BuildCacheKey(keyPrefix string, key string) (string, error) {
 	if key == "" {
@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"sync"
 	"testing"
 	"time"
 
@@ -120,3 +121,97 @@ func TestBuildCacheKey(t *testing.T) {
 	_, err = BuildCacheKey("foo", "bar")
 	assert.NoError(t, err)
 }
+
+func TestRedisCacheTags(t *testing.T) {
+	c := newRedisCache()
+	defer c.Close()
+	iCache := c.ICache.(TagCache)
+
+	err := iCache.SetWithTags(c.Ctx, "1", c.TestDataMap["1"], time.Minute, "user:1", "user:list")
+	assert.NoError(t, err)
+	err = iCache.SetWithTags(c.Ctx, "2", c.TestDataMap["2"], time.Hour, "user:list")
+	assert.NoError(t, err)
+	ttl := c.RedisClient.TTL(c.Ctx, tagKeyPrefix+"user:list").Val()
+	assert.True(t, ttl > time.Minute)
+
+	err = iCache.InvalidateTag(c.Ctx, "user:1")
+	assert.NoError(t, err)
+	val := &redisUser{}
+	err = iCache.Get(c.Ctx, "1", val)
+	assert.Equal(t, CacheNotFound, err)
+	err = iCache.Get(c.Ctx, "2", val)
+	assert.NoError(t, err)
+
+	err = iCache.InvalidateTag(c.Ctx, "user:list")
+	assert.NoError(t, err)
+	err = iCache.Get(c.Ctx, "2", val)
+	assert.Equal(t, CacheNotFound, err)
+
+	err = iCache.SetWithTags(c.Ctx, "", c.TestDataMap["1"], time.Minute, "user:list")
+	assert.Error(t, err)
+
+	// package functions
+	DefaultClient = iCache
+	err = SetWithTags(c.Ctx, "1", c.TestDataMap["1"], time.Minute, "user:list")
+	assert.NoError(t, err)
+	err = InvalidateTag(c.Ctx, "user:list")
+	assert.NoError(t, err)
+	DefaultClient = NewObservedCache(iCache, "redis")
+	err = InvalidateTag(c.Ctx, "user:list")
+	assert.NoError(t, err)
+	DefaultClient = struct{ Cache }{iCache}
+	err = InvalidateTag(c.Ctx, "user:list")
+	assert.Equal(t, ErrTagUnsupported, err)
+}
+
+func TestRedisCacheSetNX(t *testing.T) {
+	c := newRedisCache()
+	defer c.Close()
+	iCache := c.ICache.(SetNXCache)
+
+	// 并发添加同一个key，只有一个成功
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	success := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ok, err := iCache.SetNX(c.Ctx, "setnx", &redisUser{ID: uint64(i)}, time.Minute)
+			assert.NoError(t, err)
+			if ok {
+				mu.Lock()
+				success++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, 1, success)
+
+	val := &redisUser{}
+	assert.NoError(t, iCache.Get(c.Ctx, "setnx", val))
+	assert.NoError(t, iCache.Del(c.Ctx, "setnx"))
+	time.Sleep(time.Millisecond)
+	ok, err := iCache.SetNX(c.Ctx, "setnx", val, time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	// 值等于old时才写入
+	ok, err = iCache.CompareAndSet(c.Ctx, "setnx", &redisUser{ID: 100}, &redisUser{ID: 101}, time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = iCache.CompareAndSet(c.Ctx, "setnx", val, &redisUser{ID: 101}, time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.NoError(t, iCache.Get(c.Ctx, "setnx", val))
+	assert.Equal(t, uint64(101), val.ID)
+
+	ok, err = iCache.CompareAndDelete(c.Ctx, "setnx", &redisUser{ID: 100})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = iCache.CompareAndDelete(c.Ctx, "setnx", val)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, CacheNotFound, iCache.Get(c.Ctx, "setnx", val))
+}
@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/zhufuyi/pkg/encoding"
+)
+
+// refreshEntry GetOrRefresh保存在缓存中的数据，包含软过期时间和加载耗时
+type refreshEntry struct {
+	Data       []byte `json:"data"`       // 编码后的数据
+	SoftExpire int64  `json:"softExpire"` // 软过期时间(unix纳秒)
+	Delta      int64  `json:"delta"`      // 从数据源加载数据的耗时(纳秒)
+}
+
+// GetOrRefresh 从缓存获取数据，缓存同时有软过期时间softTTL和硬过期时间hardTTL，
+// 超过softTTL后仍然返回旧数据，同时只有一个后台任务调用loader刷新缓存(stale-while-revalidate)，
+// 开启XFetch时，在softTTL之前按概率提前刷新，加载越慢、越接近过期，刷新的概率越大，
+// 超过hardTTL后缓存被删除，同步调用loader加载数据。
+// 保存的数据带有过期信息，同一个key不能再使用Get直接读取
+func (l *Loader) GetOrRefresh(ctx context.Context, key string, val interface{}, loader LoadFunc, softTTL time.Duration, hardTTL time.Duration) error {
+	if hardTTL <= 0 {
+		hardTTL = DefaultExpireTime
+	}
+	if softTTL <= 0 || softTTL > hardTTL {
+		softTTL = hardTTL
+	}
+
+	entry := &refreshEntry{}
+	err := l.cache.Get(ctx, key, entry)
+	if err == nil {
+		err = encoding.Unmarshal(l.encoding, entry.Data, val)
+		if err != nil {
+			return fmt.Errorf("encoding.Unmarshal error: %v, key=%s", err, key)
+		}
+		if l.shouldRefresh(entry, time.Now()) {
+			l.refresh(key, loader, softTTL, hardTTL)
+		}
+		return nil
+	}
+	if errors.Is(err, ErrPlaceholder) {
+		return l.notFoundErr
+	}
+	// fail fast, if cache error return, don't request to data source
+	if !errors.Is(err, CacheNotFound) {
+		return err
+	}
+
+	data, err, _ := l.group.Do(key, func() (interface{}, error) {
+		return l.load(ctx, key, loader, softTTL, hardTTL)
+	})
+	if err != nil {
+		return err
+	}
+
+	return setValue(val, data)
+}
+
+// 超过软过期时间，或者XFetch判断需要提前刷新: now - delta*beta*ln(rand) >= softExpire
+func (l *Loader) shouldRefresh(entry *refreshEntry, now time.Time) bool {
+	if now.UnixNano() >= entry.SoftExpire {
+		return true
+	}
+	if l.xfetchBeta <= 0 || entry.Delta <= 0 {
+		return false
+	}
+	gap := -float64(entry.Delta) * l.xfetchBeta * math.Log(rand.Float64())
+	return float64(now.UnixNano())+gap >= float64(entry.SoftExpire)
+}
+
+// 后台刷新缓存，同一个key同时只有一个刷新任务
+func (l *Loader) refresh(key string, loader LoadFunc, softTTL time.Duration, hardTTL time.Duration) {
+	if _, loaded := l.refreshing.LoadOrStore(key, struct{}{}); loaded {
+		return
+	}
+
+	go func() {
+		defer l.refreshing.Delete(key)
+		ctx, cancel := context.WithTimeout(context.Background(), l.refreshTimeout)
+		defer cancel()
+		_, _ = l.load(ctx, key, loader, softTTL, hardTTL)
+	}()
+}
+
+// 从数据源加载数据，记录加载耗时和软过期时间后写入缓存
+func (l *Loader) load(ctx context.Context, key string, loader LoadFunc, softTTL time.Duration, hardTTL time.Duration) (interface{}, error) {
+	start := time.Now()
+	data, err := loader(ctx)
+	if err != nil {
+		if errors.Is(err, l.notFoundErr) {
+			_ = l.cache.SetCacheWithNotFound(ctx, key)
+		}
+		return nil, err
+	}
+	delta := time.Since(start)
+
+	buf, err := encoding.Marshal(l.encoding, data)
+	if err != nil {
+		return nil, fmt.Errorf("encoding.Marshal error: %v, key=%s", err, key)
+	}
+	entry := &refreshEntry{
+		Data:       buf,
+		SoftExpire: time.Now().Add(softTTL).UnixNano(),
+		Delta:      int64(delta),
+	}
+	err = l.cache.Set(ctx, key, entry, l.withJitter(hardTTL))
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,135 @@
+package cache
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zhufuyi/pkg/encoding"
+	"github.com/zhufuyi/pkg/gotest"
+	"github.com/zhufuyi/pkg/utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newRefreshCache(isMemory bool, opts ...LoaderOption) *gotest.Cache {
+	record1 := &loaderUser{
+		ID:   1,
+		Name: "foo",
+	}
+
+	testData := map[string]interface{}{
+		utils.Uint64ToStr(record1.ID): record1,
+	}
+
+	c := gotest.NewCache(testData)
+	cachePrefix := "config"
+	newObject := func() interface{} {
+		return &refreshEntry{}
+	}
+	var iCache Cache
+	if isMemory {
+		iCache = NewMemoryCache(cachePrefix, encoding.JSONEncoding{}, newObject)
+	} else {
+		iCache = NewRedisCache(c.RedisClient, cachePrefix, encoding.JSONEncoding{}, newObject)
+	}
+	c.ICache = NewLoader(iCache, append(opts, WithNotFoundError(errRecordNotFound))...)
+
+	return c
+}
+
+func testGetOrRefresh(t *testing.T, isMemory bool) {
+	c := newRefreshCache(isMemory)
+	defer c.Close()
+	loader := c.ICache.(*Loader)
+	key := "1"
+
+	var count int32
+	loadFn := func(ctx context.Context) (interface{}, error) {
+		n := atomic.AddInt32(&count, 1)
+		time.Sleep(time.Millisecond * 20)
+		return &loaderUser{ID: 1, Name: "v" + utils.IntToStr(int(n))}, nil
+	}
+
+	// 没有命中，同步加载
+	val := &loaderUser{}
+	err := loader.GetOrRefresh(c.Ctx, key, val, loadFn, time.Millisecond*200, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", val.Name)
+	time.Sleep(time.Millisecond * 10)
+
+	// 没有超过软过期时间，不刷新
+	val = &loaderUser{}
+	err = loader.GetOrRefresh(c.Ctx, key, val, loadFn, time.Millisecond*200, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", val.Name)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&count))
+
+	// 超过软过期时间，返回旧数据，只有一个后台刷新
+	time.Sleep(time.Millisecond * 250)
+	for i := 0; i < 5; i++ {
+		val = &loaderUser{}
+		err = loader.GetOrRefresh(c.Ctx, key, val, loadFn, time.Millisecond*200, time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, "v1", val.Name)
+	}
+	time.Sleep(time.Millisecond * 100)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&count))
+
+	val = &loaderUser{}
+	err = loader.GetOrRefresh(c.Ctx, key, val, loadFn, time.Millisecond*200, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", val.Name)
+
+	// 数据不存在，写入占位符
+	notFoundFn := func(ctx context.Context) (interface{}, error) {
+		return nil, errRecordNotFound
+	}
+	err = loader.GetOrRefresh(c.Ctx, "not_found", val, notFoundFn, time.Second, time.Minute)
+	assert.Equal(t, errRecordNotFound, err)
+	time.Sleep(time.Millisecond * 10)
+	err = loader.GetOrRefresh(c.Ctx, "not_found", val, loadFn, time.Second, time.Minute)
+	assert.Equal(t, errRecordNotFound, err)
+}
+
+func TestLoader_GetOrRefreshRedis(t *testing.T) {
+	testGetOrRefresh(t, false)
+}
+
+func TestLoader_GetOrRefreshMemory(t *testing.T) {
+	testGetOrRefresh(t, true)
+}
+
+func TestLoader_GetOrRefreshXFetch(t *testing.T) {
+	c := newRefreshCache(false, WithXFetchBeta(1e6))
+	defer c.Close()
+	loader := c.ICache.(*Loader)
+
+	var count int32
+	loadFn := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&count, 1)
+		time.Sleep(time.Millisecond * 5)
+		return &loaderUser{ID: 1, Name: "foo"}, nil
+	}
+
+	val := &loaderUser{}
+	err := loader.GetOrRefresh(c.Ctx, "1", val, loadFn, time.Minute, time.Hour)
+	assert.NoError(t, err)
+
+	// 加载耗时*beta远大于软过期时间，提前刷新
+	err = loader.GetOrRefresh(c.Ctx, "1", val, loadFn, time.Minute, time.Hour)
+	assert.NoError(t, err)
+	time.Sleep(time.Millisecond * 50)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&count))
+}
+
+func TestLoader_shouldRefresh(t *testing.T) {
+	l := NewLoader(nil)
+	now := time.Now()
+	assert.True(t, l.shouldRefresh(&refreshEntry{SoftExpire: now.Add(-time.Second).UnixNano()}, now))
+	assert.False(t, l.shouldRefresh(&refreshEntry{SoftExpire: now.Add(time.Second).UnixNano(), Delta: int64(time.Hour)}, now))
+
+	l = NewLoader(nil, WithXFetchBeta(1))
+	assert.False(t, l.shouldRefresh(&refreshEntry{SoftExpire: now.Add(time.Hour).UnixNano(), Delta: int64(time.Nanosecond)}, now))
+}
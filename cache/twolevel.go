@@ -0,0 +1,373 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/zhufuyi/pkg/encoding"
+	"github.com/zhufuyi/pkg/krand"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	// DefaultLocalExpireTime 一级缓存(内存)默认过期时间
+	DefaultLocalExpireTime = time.Minute
+	// DefaultInvalidateChannel 二级缓存失效通知的默认频道
+	DefaultInvalidateChannel = "cache:invalidate"
+)
+
+// TwoLevelOption set the two-level cache options.
+type TwoLevelOption func(*twoLevelOptions)
+
+type twoLevelOptions struct {
+	localExpireTime time.Duration
+	channel         string
+}
+
+func (o *twoLevelOptions) apply(opts ...TwoLevelOption) {
+	for _, opt := range opts {
+		opt(o)
+	}
+}
+
+func defaultTwoLevelOptions() *twoLevelOptions {
+	return &twoLevelOptions{
+		localExpireTime: DefaultLocalExpireTime,
+		channel:         DefaultInvalidateChannel,
+	}
+}
+
+// WithLocalExpireTime set the expiration time of the local(L1) cache
+func WithLocalExpireTime(d time.Duration) TwoLevelOption {
+	return func(o *twoLevelOptions) {
+		o.localExpireTime = d
+	}
+}
+
+// WithInvalidateChannel set the redis pub/sub channel used to broadcast invalidations
+func WithInvalidateChannel(channel string) TwoLevelOption {
+	return func(o *twoLevelOptions) {
+		o.channel = channel
+	}
+}
+
+// invalidateMessage 失效通知消息
+type invalidateMessage struct {
+	Node string   `json:"node"`
+	Keys []string `json:"keys"`
+}
+
+// TwoLevelCache 二级缓存，一级缓存是进程内的内存缓存，二级缓存是redis缓存，
+// 写和删除操作会同时作用于两级缓存，并通过redis pub/sub通知其他实例删除一级缓存
+type TwoLevelCache struct {
+	client    *redis.Client
+	local     Cache
+	remote    Cache
+	KeyPrefix string
+	newObject func() interface{}
+
+	node            string
+	channel         string
+	localExpireTime time.Duration
+
+	pubsub *redis.PubSub
+	cancel context.CancelFunc
+}
+
+// NewTwoLevelCache create a two-level cache, the local(L1) cache is memory cache, the remote(L2) cache is redis cache
+func NewTwoLevelCache(client *redis.Client, keyPrefix string, encoding encoding.Encoding, newObject func() interface{}, opts ...TwoLevelOption) *TwoLevelCache {
+	o := defaultTwoLevelOptions()
+	o.apply(opts...)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &TwoLevelCache{
+		client:    client,
+		local:     NewMemoryCache(keyPrefix, encoding, newObject),
+		remote:    NewRedisCache(client, keyPrefix, encoding, newObject),
+		KeyPrefix: keyPrefix,
+		newObject: newObject,
+
+		node:            krand.String(krand.R_All, 16),
+		channel:         o.channel,
+		localExpireTime: o.localExpireTime,
+
+		pubsub: client.Subscribe(ctx, o.channel),
+		cancel: cancel,
+	}
+	go c.watch(ctx)
+
+	return c
+}
+
+// Set 写入两级缓存，并通知其他实例删除一级缓存
+func (c *TwoLevelCache) Set(ctx context.Context, key string, val interface{}, expiration time.Duration) error {
+	err := c.remote.Set(ctx, key, val, expiration)
+	if err != nil {
+		return err
+	}
+	err = c.local.Set(ctx, key, val, c.getLocalExpiration(expiration))
+	if err != nil {
+		return err
+	}
+	return c.publish(ctx, key)
+}
+
+// SetNX 二级缓存中key不存在时写入，成功后删除一级缓存，并通知其他实例删除一级缓存
+func (c *TwoLevelCache) SetNX(ctx context.Context, key string, val interface{}, expiration time.Duration) (bool, error) {
+	ok, err := c.remote.(SetNXCache).SetNX(ctx, key, val, expiration)
+	if err != nil || !ok {
+		return ok, err
+	}
+	return true, c.delLocal(ctx, key)
+}
+
+// CompareAndSet 二级缓存的值等于old时写入，成功后删除一级缓存，并通知其他实例删除一级缓存
+func (c *TwoLevelCache) CompareAndSet(ctx context.Context, key string, old interface{}, val interface{}, expiration time.Duration) (bool, error) {
+	ok, err := c.remote.(SetNXCache).CompareAndSet(ctx, key, old, val, expiration)
+	if err != nil || !ok {
+		return ok, err
+	}
+	return true, c.delLocal(ctx, key)
+}
+
+// CompareAndDelete 二级缓存的值等于old时删除，成功后删除一级缓存，并通知其他实例删除一级缓存
+func (c *TwoLevelCache) CompareAndDelete(ctx context.Context, key string, old interface{}) (bool, error) {
+	ok, err := c.remote.(SetNXCache).CompareAndDelete(ctx, key, old)
+	if err != nil || !ok {
+		return ok, err
+	}
+	return true, c.delLocal(ctx, key)
+}
+
+func (c *TwoLevelCache) delLocal(ctx context.Context, key string) error {
+	err := c.local.Del(ctx, key)
+	if err != nil {
+		return err
+	}
+	return c.publish(ctx, key)
+}
+
+// Get 先从一级缓存获取，没有命中时再从二级缓存获取并回填一级缓存
+func (c *TwoLevelCache) Get(ctx context.Context, key string, val interface{}) error {
+	err := c.local.Get(ctx, key, val)
+	if err == nil || err == ErrPlaceholder {
+		return err
+	}
+
+	err = c.remote.Get(ctx, key, val)
+	if err != nil {
+		if err == ErrPlaceholder {
+			_ = c.local.SetCacheWithNotFound(ctx, key)
+		}
+		return err
+	}
+
+	_ = c.local.Set(ctx, key, val, c.localExpireTime)
+	return nil
+}
+
+// MultiSet 批量写入两级缓存
+func (c *TwoLevelCache) MultiSet(ctx context.Context, valueMap map[string]interface{}, expiration time.Duration) error {
+	if len(valueMap) == 0 {
+		return nil
+	}
+
+	err := c.remote.MultiSet(ctx, valueMap, expiration)
+	if err != nil {
+		return err
+	}
+	err = c.local.MultiSet(ctx, valueMap, c.getLocalExpiration(expiration))
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(valueMap))
+	for key := range valueMap {
+		keys = append(keys, key)
+	}
+	return c.publish(ctx, keys...)
+}
+
+// MultiGet 批量获取，valueMap的key为参数keys中的key，一级缓存没有命中的key从二级缓存获取
+func (c *TwoLevelCache) MultiGet(ctx context.Context, keys []string, value interface{}) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	valueMap := reflect.ValueOf(value)
+	cacheKeys := make(map[string]string) // cacheKey --> key
+	var missKeys []string
+	for _, key := range keys {
+		object := c.newObject()
+		err := c.local.Get(ctx, key, object)
+		if err == nil {
+			valueMap.SetMapIndex(reflect.ValueOf(key), reflect.ValueOf(object))
+			continue
+		}
+		if err == ErrPlaceholder {
+			continue
+		}
+
+		cacheKey, err := BuildCacheKey(c.KeyPrefix, key)
+		if err != nil {
+			return fmt.Errorf("BuildCacheKey error: %v, key=%s", err, key)
+		}
+		cacheKeys[cacheKey] = key
+		missKeys = append(missKeys, key)
+	}
+	if len(missKeys) == 0 {
+		return nil
+	}
+
+	remoteValues := make(map[string]interface{})
+	err := c.remote.MultiGet(ctx, missKeys, remoteValues)
+	if err != nil {
+		return err
+	}
+	for cacheKey, object := range remoteValues {
+		key, ok := cacheKeys[cacheKey]
+		if !ok {
+			continue
+		}
+		valueMap.SetMapIndex(reflect.ValueOf(key), reflect.ValueOf(object))
+		_ = c.local.Set(ctx, key, object, c.localExpireTime)
+	}
+
+	return nil
+}
+
+// Del 删除两级缓存，并通知其他实例删除一级缓存
+func (c *TwoLevelCache) Del(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	err := c.remote.Del(ctx, keys...)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		err = c.local.Del(ctx, key)
+		if err != nil {
+			return err
+		}
+	}
+	return c.publish(ctx, keys...)
+}
+
+// SetCacheWithNotFound 两级缓存都写入占位符，并通知其他实例删除一级缓存
+func (c *TwoLevelCache) SetCacheWithNotFound(ctx context.Context, key string) error {
+	err := c.remote.SetCacheWithNotFound(ctx, key)
+	if err != nil {
+		return err
+	}
+	err = c.local.SetCacheWithNotFound(ctx, key)
+	if err != nil {
+		return err
+	}
+	return c.publish(ctx, key)
+}
+
+// SetWithTags 写入两级缓存并打上标签，并通知其他实例删除一级缓存
+func (c *TwoLevelCache) SetWithTags(ctx context.Context, key string, val interface{}, expiration time.Duration, tags ...string) error {
+	err := c.remote.(TagCache).SetWithTags(ctx, key, val, expiration, tags...)
+	if err != nil {
+		return err
+	}
+	err = c.local.(TagCache).SetWithTags(ctx, key, val, c.getLocalExpiration(expiration), tags...)
+	if err != nil {
+		return err
+	}
+	return c.publish(ctx, key)
+}
+
+// InvalidateTag 删除两级缓存中带有标签的所有缓存，并通知其他实例删除一级缓存
+func (c *TwoLevelCache) InvalidateTag(ctx context.Context, tags ...string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	// 其他实例的一级缓存可能是从二级缓存回填的，没有标签，需要按key删除
+	var keys []string
+	for _, tag := range tags {
+		tagKey, _ := BuildCacheKey(c.KeyPrefix, tagKeyPrefix+tag)
+		cacheKeys, err := c.client.SMembers(ctx, tagKey).Result()
+		if err != nil {
+			return fmt.Errorf("c.client.SMembers error: %v, tagKey=%s", err, tagKey)
+		}
+		for _, cacheKey := range cacheKeys {
+			if c.KeyPrefix != "" {
+				cacheKey = strings.TrimPrefix(cacheKey, c.KeyPrefix+":")
+			}
+			keys = append(keys, cacheKey)
+		}
+	}
+
+	err := c.remote.(TagCache).InvalidateTag(ctx, tags...)
+	if err != nil {
+		return err
+	}
+	_ = c.local.(TagCache).InvalidateTag(ctx, tags...)
+	if len(keys) == 0 {
+		return nil
+	}
+	err = c.local.Del(ctx, keys...)
+	if err != nil {
+		return err
+	}
+	return c.publish(ctx, keys...)
+}
+
+// Close 停止订阅失效通知
+func (c *TwoLevelCache) Close() error {
+	c.cancel()
+	return c.pubsub.Close()
+}
+
+func (c *TwoLevelCache) getLocalExpiration(expiration time.Duration) time.Duration {
+	if expiration > 0 && expiration < c.localExpireTime {
+		return expiration
+	}
+	return c.localExpireTime
+}
+
+// 广播失效通知
+func (c *TwoLevelCache) publish(ctx context.Context, keys ...string) error {
+	data, err := json.Marshal(&invalidateMessage{Node: c.node, Keys: keys})
+	if err != nil {
+		return fmt.Errorf("json.Marshal error: %v, keys=%+v", err, keys)
+	}
+	err = c.client.Publish(ctx, c.channel, data).Err()
+	if err != nil {
+		return fmt.Errorf("c.client.Publish error: %v, channel=%s, keys=%+v", err, c.channel, keys)
+	}
+	return nil
+}
+
+// 接收其他实例的失效通知，删除本地一级缓存
+func (c *TwoLevelCache) watch(ctx context.Context) {
+	ch := c.pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			im := &invalidateMessage{}
+			err := json.Unmarshal([]byte(msg.Payload), im)
+			if err != nil || im.Node == c.node {
+				continue
+			}
+			for _, key := range im.Keys {
+				_ = c.local.Del(ctx, key)
+			}
+		}
+	}
+}
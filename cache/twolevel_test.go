@@ -0,0 +1,190 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zhufuyi/pkg/encoding"
+	"github.com/zhufuyi/pkg/gotest"
+	"github.com/zhufuyi/pkg/utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type twoLevelUser struct {
+	ID   uint64
+	Name string
+}
+
+func newTwoLevelCache() *gotest.Cache {
+	record1 := &twoLevelUser{
+		ID:   1,
+		Name: "foo",
+	}
+	record2 := &twoLevelUser{
+		ID:   2,
+		Name: "bar",
+	}
+
+	testData := map[string]interface{}{
+		utils.Uint64ToStr(record1.ID): record1,
+		utils.Uint64ToStr(record2.ID): record2,
+	}
+
+	c := gotest.NewCache(testData)
+	cachePrefix := ""
+	c.ICache = NewTwoLevelCache(c.RedisClient, cachePrefix, encoding.JSONEncoding{}, func() interface{} {
+		return &twoLevelUser{}
+	}, WithLocalExpireTime(time.Minute))
+
+	return c
+}
+
+func TestTwoLevelCache(t *testing.T) {
+	c := newTwoLevelCache()
+	defer c.Close()
+	testData := c.TestDataSlice[0].(*twoLevelUser)
+	iCache := c.ICache.(*TwoLevelCache)
+	defer iCache.Close()
+
+	key := utils.Uint64ToStr(testData.ID)
+	err := iCache.Set(c.Ctx, key, c.TestDataMap[key], time.Minute)
+	assert.NoError(t, err)
+
+	time.Sleep(time.Millisecond * 10)
+	val := &twoLevelUser{}
+	err = iCache.Get(c.Ctx, key, val)
+	assert.NoError(t, err)
+	assert.Equal(t, testData.Name, val.Name)
+
+	err = iCache.Del(c.Ctx, key)
+	assert.NoError(t, err)
+
+	err = iCache.MultiSet(c.Ctx, c.TestDataMap, time.Minute)
+	assert.NoError(t, err)
+
+	time.Sleep(time.Millisecond * 10)
+	var keys []string
+	for k := range c.TestDataMap {
+		keys = append(keys, k)
+	}
+	vals := make(map[string]*twoLevelUser)
+	err = iCache.MultiGet(c.Ctx, keys, vals)
+	assert.NoError(t, err)
+	assert.Equal(t, len(c.TestDataSlice), len(vals))
+
+	err = iCache.SetCacheWithNotFound(c.Ctx, "not_found")
+	assert.NoError(t, err)
+	time.Sleep(time.Millisecond * 10)
+	err = iCache.Get(c.Ctx, "not_found", val)
+	assert.Equal(t, ErrPlaceholder, err)
+}
+
+func TestTwoLevelCacheInvalidate(t *testing.T) {
+	c := newTwoLevelCache()
+	defer c.Close()
+	testData := c.TestDataSlice[0].(*twoLevelUser)
+	cache1 := c.ICache.(*TwoLevelCache)
+	defer cache1.Close()
+	cache2 := NewTwoLevelCache(c.RedisClient, "", encoding.JSONEncoding{}, func() interface{} {
+		return &twoLevelUser{}
+	})
+	defer cache2.Close()
+	time.Sleep(time.Millisecond * 100)
+
+	key := utils.Uint64ToStr(testData.ID)
+	err := cache1.Set(c.Ctx, key, c.TestDataMap[key], time.Minute)
+	assert.NoError(t, err)
+
+	// 从二级缓存获取，并回填一级缓存
+	val := &twoLevelUser{}
+	err = cache2.Get(c.Ctx, key, val)
+	assert.NoError(t, err)
+	assert.Equal(t, testData.Name, val.Name)
+	time.Sleep(time.Millisecond * 10)
+	err = cache2.local.Get(c.Ctx, key, val)
+	assert.NoError(t, err)
+
+	// 删除后，其他实例的一级缓存也被删除
+	err = cache1.Del(c.Ctx, key)
+	assert.NoError(t, err)
+	time.Sleep(time.Millisecond * 100)
+	err = cache2.local.Get(c.Ctx, key, val)
+	assert.Equal(t, CacheNotFound, err)
+	err = cache2.Get(c.Ctx, key, val)
+	assert.Equal(t, CacheNotFound, err)
+
+	// 占位符从二级缓存回填到一级缓存
+	err = cache1.SetCacheWithNotFound(c.Ctx, key)
+	assert.NoError(t, err)
+	err = cache2.Get(c.Ctx, key, val)
+	assert.Equal(t, ErrPlaceholder, err)
+	time.Sleep(time.Millisecond * 10)
+	err = cache2.local.Get(c.Ctx, key, val)
+	assert.Equal(t, ErrPlaceholder, err)
+}
+
+func TestTwoLevelCacheTags(t *testing.T) {
+	c := newTwoLevelCache()
+	defer c.Close()
+	cache1 := c.ICache.(*TwoLevelCache)
+	defer cache1.Close()
+	cache2 := NewTwoLevelCache(c.RedisClient, "", encoding.JSONEncoding{}, func() interface{} {
+		return &twoLevelUser{}
+	})
+	defer cache2.Close()
+	time.Sleep(time.Millisecond * 100)
+
+	err := cache1.SetWithTags(c.Ctx, "1", c.TestDataMap["1"], time.Minute, "user:list")
+	assert.NoError(t, err)
+
+	// 从二级缓存回填，一级缓存没有标签
+	val := &twoLevelUser{}
+	err = cache2.Get(c.Ctx, "1", val)
+	assert.NoError(t, err)
+	time.Sleep(time.Millisecond * 10)
+
+	err = cache1.InvalidateTag(c.Ctx, "user:list")
+	assert.NoError(t, err)
+	time.Sleep(time.Millisecond * 100)
+	err = cache1.Get(c.Ctx, "1", val)
+	assert.Equal(t, CacheNotFound, err)
+	err = cache2.Get(c.Ctx, "1", val)
+	assert.Equal(t, CacheNotFound, err)
+}
+
+func TestTwoLevelCacheSetNX(t *testing.T) {
+	c := newTwoLevelCache()
+	defer c.Close()
+	cache1 := c.ICache.(*TwoLevelCache)
+	defer cache1.Close()
+	var iCache SetNXCache = cache1
+
+	ok, err := iCache.SetNX(c.Ctx, "setnx", &twoLevelUser{ID: 1}, time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = iCache.SetNX(c.Ctx, "setnx", &twoLevelUser{ID: 2}, time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// 回填一级缓存后比较写入，一级缓存被删除，读到新的值
+	val := &twoLevelUser{}
+	assert.NoError(t, iCache.Get(c.Ctx, "setnx", val))
+	ok, err = iCache.CompareAndSet(c.Ctx, "setnx", &twoLevelUser{ID: 2}, &twoLevelUser{ID: 3}, time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = iCache.CompareAndSet(c.Ctx, "setnx", &twoLevelUser{ID: 1}, &twoLevelUser{ID: 3}, time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	time.Sleep(time.Millisecond * 10)
+	assert.NoError(t, iCache.Get(c.Ctx, "setnx", val))
+	assert.Equal(t, uint64(3), val.ID)
+
+	ok, err = iCache.CompareAndDelete(c.Ctx, "setnx", &twoLevelUser{ID: 100})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = iCache.CompareAndDelete(c.Ctx, "setnx", val)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, CacheNotFound, iCache.Get(c.Ctx, "setnx", val))
+}
@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/zhufuyi/pkg/encoding"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// multiGetter 不使用反射的批量获取，每个命中的key调用一次fn，i是key在keys中的下标，命中占位符时object为nil
+type multiGetter interface {
+	multiGetEach(ctx context.Context, keys []string, newObject func() interface{}, fn func(key string, i int, object interface{})) error
+}
+
+// Typed 泛型缓存，值的类型在编译期检查，不需要newObject和反射
+type Typed[T any] struct {
+	cache Cache
+}
+
+// NewTyped create a typed cache on top of cache
+func NewTyped[T any](c Cache) *Typed[T] {
+	return &Typed[T]{cache: c}
+}
+
+// NewTypedRedisCache create a typed redis cache
+func NewTypedRedisCache[T any](client *redis.Client, keyPrefix string, encoding encoding.Encoding) *Typed[T] {
+	return NewTyped[T](NewRedisCache(client, keyPrefix, encoding, newTypedObject[T]))
+}
+
+// NewTypedMemoryCache create a typed memory cache
+func NewTypedMemoryCache[T any](keyPrefix string, encoding encoding.Encoding) *Typed[T] {
+	return NewTyped[T](NewMemoryCache(keyPrefix, encoding, newTypedObject[T]))
+}
+
+func newTypedObject[T any]() interface{} {
+	return new(T)
+}
+
+// Cache return the underlying cache
+func (t *Typed[T]) Cache() Cache {
+	return t.cache
+}
+
+// Set one value
+func (t *Typed[T]) Set(ctx context.Context, key string, val T, expiration time.Duration) error {
+	return t.cache.Set(ctx, key, &val, expiration)
+}
+
+// Get one value
+func (t *Typed[T]) Get(ctx context.Context, key string) (T, error) {
+	var val T
+	err := t.cache.Get(ctx, key, &val)
+	return val, err
+}
+
+// MultiSet set multiple values
+func (t *Typed[T]) MultiSet(ctx context.Context, valueMap map[string]T, expiration time.Duration) error {
+	values := make(map[string]interface{}, len(valueMap))
+	for key, val := range valueMap {
+		val := val
+		values[key] = &val
+	}
+	return t.cache.MultiSet(ctx, values, expiration)
+}
+
+// MultiGet get multiple values, the key of the returned map is the key in keys,
+// keys that are not hit are not in the map
+func (t *Typed[T]) MultiGet(ctx context.Context, keys []string) (map[string]T, error) {
+	values := make(map[string]T, len(keys))
+
+	if mg, ok := t.cache.(multiGetter); ok {
+		err := mg.multiGetEach(ctx, keys, newTypedObject[T], func(_ string, i int, object interface{}) {
+			if object == nil {
+				return
+			}
+			values[keys[i]] = *object.(*T)
+		})
+		return values, err
+	}
+
+	for _, key := range keys {
+		var val T
+		err := t.cache.Get(ctx, key, &val)
+		if err != nil {
+			if errors.Is(err, CacheNotFound) || errors.Is(err, ErrPlaceholder) {
+				continue
+			}
+			return nil, err
+		}
+		values[key] = val
+	}
+	return values, nil
+}
+
+// Del delete multiple values
+func (t *Typed[T]) Del(ctx context.Context, keys ...string) error {
+	return t.cache.Del(ctx, keys...)
+}
+
+// SetCacheWithNotFound set value for notfound
+func (t *Typed[T]) SetCacheWithNotFound(ctx context.Context, key string) error {
+	return t.cache.SetCacheWithNotFound(ctx, key)
+}
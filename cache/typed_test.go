@@ -0,0 +1,148 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/zhufuyi/pkg/encoding"
+	"github.com/zhufuyi/pkg/gotest"
+	"github.com/zhufuyi/pkg/utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type typedUser struct {
+	ID   uint64
+	Name string
+}
+
+func newTypedCache() *gotest.Cache {
+	record1 := &typedUser{
+		ID:   1,
+		Name: "foo",
+	}
+	record2 := &typedUser{
+		ID:   2,
+		Name: "bar",
+	}
+
+	testData := map[string]interface{}{
+		utils.Uint64ToStr(record1.ID): record1,
+		utils.Uint64ToStr(record2.ID): record2,
+	}
+
+	c := gotest.NewCache(testData)
+	cachePrefix := "user"
+	c.ICache = NewTypedRedisCache[*typedUser](c.RedisClient, cachePrefix, encoding.JSONEncoding{})
+
+	return c
+}
+
+func testTyped(t *testing.T, c *gotest.Cache, iCache *Typed[*typedUser]) {
+	testData := c.TestDataSlice[0].(*typedUser)
+
+	key := utils.Uint64ToStr(testData.ID)
+	err := iCache.Set(c.Ctx, key, testData, time.Minute)
+	assert.NoError(t, err)
+
+	time.Sleep(time.Millisecond * 10)
+	val, err := iCache.Get(c.Ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, testData.Name, val.Name)
+
+	err = iCache.Del(c.Ctx, key)
+	assert.NoError(t, err)
+
+	valueMap := make(map[string]*typedUser)
+	var keys []string
+	for k, v := range c.TestDataMap {
+		valueMap[k] = v.(*typedUser)
+		keys = append(keys, k)
+	}
+	err = iCache.MultiSet(c.Ctx, valueMap, time.Minute)
+	assert.NoError(t, err)
+
+	time.Sleep(time.Millisecond * 10)
+	vals, err := iCache.MultiGet(c.Ctx, append(keys, "not_exist"))
+	assert.NoError(t, err)
+	assert.Equal(t, len(c.TestDataSlice), len(vals))
+	for _, k := range keys {
+		assert.Equal(t, valueMap[k].Name, vals[k].Name)
+	}
+
+	err = iCache.SetCacheWithNotFound(c.Ctx, "not_found")
+	assert.NoError(t, err)
+	time.Sleep(time.Millisecond * 10)
+	_, err = iCache.Get(c.Ctx, "not_found")
+	assert.Equal(t, ErrPlaceholder, err)
+}
+
+func TestTypedRedisCache(t *testing.T) {
+	c := newTypedCache()
+	defer c.Close()
+	testTyped(t, c, c.ICache.(*Typed[*typedUser]))
+}
+
+func TestTypedMemoryCache(t *testing.T) {
+	c := newTypedCache()
+	defer c.Close()
+	testTyped(t, c, NewTypedMemoryCache[*typedUser]("user", encoding.JSONEncoding{}))
+}
+
+func TestTypedTwoLevelCache(t *testing.T) {
+	c := newTypedCache()
+	defer c.Close()
+	tc := NewTwoLevelCache(c.RedisClient, "user", encoding.JSONEncoding{}, newTypedObject[typedUser])
+	defer tc.Close()
+	iCache := NewTyped[*typedUser](tc)
+	assert.Equal(t, tc, iCache.Cache())
+	testTyped(t, c, iCache)
+}
+
+func TestTypedValue(t *testing.T) {
+	c := newTypedCache()
+	defer c.Close()
+
+	iCache := NewTypedRedisCache[typedUser](c.RedisClient, "", encoding.JSONEncoding{})
+	err := iCache.Set(c.Ctx, "1", typedUser{ID: 1, Name: "foo"}, time.Minute)
+	assert.NoError(t, err)
+	val, err := iCache.Get(c.Ctx, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", val.Name)
+
+	_, err = iCache.Get(c.Ctx, "2")
+	assert.Equal(t, CacheNotFound, err)
+}
+
+type errGetCache struct {
+	Cache
+	errKey string
+}
+
+func (c *errGetCache) Get(ctx context.Context, key string, val interface{}) error {
+	if key == c.errKey {
+		return errors.New("get error")
+	}
+	return c.Cache.Get(ctx, key, val)
+}
+
+func TestTypedMultiGetFallback(t *testing.T) {
+	memCache := NewMemoryCache("user", encoding.JSONEncoding{}, newTypedObject[typedUser])
+	err := memCache.Set(context.Background(), "1", &typedUser{ID: 1, Name: "foo"}, time.Minute)
+	assert.NoError(t, err)
+	err = memCache.SetCacheWithNotFound(context.Background(), "2")
+	assert.NoError(t, err)
+	time.Sleep(time.Millisecond * 10)
+
+	// 没有实现multiGetter时逐个获取，未命中和占位符被跳过
+	iCache := NewTyped[typedUser](&errGetCache{Cache: memCache, errKey: "4"})
+	vals, err := iCache.MultiGet(context.Background(), []string{"1", "2", "3"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]typedUser{"1": {ID: 1, Name: "foo"}}, vals)
+
+	// 其他错误直接返回
+	_, err = iCache.MultiGet(context.Background(), []string{"1", "4"})
+	assert.EqualError(t, err, "get error")
+}
@@ -0,0 +1,16 @@
+package encoding
+
+import "github.com/fxamacker/cbor/v2"
+
+// CBOREncoding cbor格式
+type CBOREncoding struct{}
+
+// Marshal cbor encode
+func (c CBOREncoding) Marshal(v interface{}) ([]byte, error) {
+	return cbor.Marshal(v)
+}
+
+// Unmarshal cbor decode
+func (c CBOREncoding) Unmarshal(data []byte, value interface{}) error {
+	return cbor.Unmarshal(data, value)
+}
@@ -0,0 +1,89 @@
+package encoding
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+// zstd的EncodeAll和DecodeAll可以并发调用
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// ZstdEncode 压缩
+func ZstdEncode(in []byte) []byte {
+	return zstdEncoder.EncodeAll(in, make([]byte, 0, len(in)))
+}
+
+// ZstdDecode 解压
+func ZstdDecode(in []byte) ([]byte, error) {
+	return zstdDecoder.DecodeAll(in, nil)
+}
+
+// JSONZstdEncoding json格式和zstd压缩
+type JSONZstdEncoding struct{}
+
+// Marshal json encode and zstd compress
+func (z JSONZstdEncoding) Marshal(v interface{}) ([]byte, error) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return ZstdEncode(buf), nil
+}
+
+// Unmarshal zstd decompress and json decode
+func (z JSONZstdEncoding) Unmarshal(data []byte, value interface{}) error {
+	buf, err := ZstdDecode(data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(buf, value)
+}
+
+// Lz4Encode 压缩
+func Lz4Encode(in []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := lz4.NewWriter(&buffer)
+	_, err := writer.Write(in)
+	if err != nil {
+		_ = writer.Close()
+		return nil, err
+	}
+	err = writer.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// Lz4Decode 解压
+func Lz4Decode(in []byte) ([]byte, error) {
+	return io.ReadAll(lz4.NewReader(bytes.NewReader(in)))
+}
+
+// JSONLz4Encoding json格式和lz4压缩
+type JSONLz4Encoding struct{}
+
+// Marshal json encode and lz4 compress
+func (l JSONLz4Encoding) Marshal(v interface{}) ([]byte, error) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return Lz4Encode(buf)
+}
+
+// Unmarshal lz4 decompress and json decode
+func (l JSONLz4Encoding) Unmarshal(data []byte, value interface{}) error {
+	buf, err := Lz4Decode(data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(buf, value)
+}
@@ -26,8 +26,6 @@ type Codec interface {
 	Name() string
 }
 
-var registeredCodecs = make(map[string]Codec)
-
 // RegisterCodec registers the provided Codec for use with all transport clients and
 // servers.
 //
@@ -39,8 +37,13 @@ var registeredCodecs = make(map[string]Codec)
 // https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-HTTP2.md#requests for
 // more details.
 //
-// NOTE: this function must only be called during initialization time (i.e. in
-// an init() function), and is not thread-safe.  If multiple Compressors are
+// The Codec shares the registry with Encoding, it is also registered with the
+// MIME type application/<content-subtype>, e.g. application/x-codec, unless
+// an Encoding which is not a Codec has been registered with the MIME type,
+// e.g. the built-in JSONEncoding of application/json is not replaced.
+//
+// NOTE: this function should be called during initialization time (i.e. in
+// an init() function).  If multiple Compressors are
 // registered with the same name, the one registered last will take effect.
 func RegisterCodec(codec Codec) {
 	if codec == nil {
@@ -50,7 +53,17 @@ func RegisterCodec(codec Codec) {
 		panic("cannot register Codec with empty string result for Name()")
 	}
 	contentSubtype := strings.ToLower(codec.Name())
-	registeredCodecs[contentSubtype] = codec
+	mimeType := "application/" + contentSubtype
+
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	codecs[contentSubtype] = codec
+	if e, ok := registry[mimeType]; ok {
+		if _, isCodec := e.(Codec); !isCodec {
+			return
+		}
+	}
+	registry[mimeType] = codec
 }
 
 // GetCodec gets a registered Codec by content-subtype, or nil if no Codec is
@@ -58,7 +71,9 @@ func RegisterCodec(codec Codec) {
 //
 // The content-subtype is expected to be lowercase.
 func GetCodec(contentSubtype string) Codec {
-	return registeredCodecs[contentSubtype]
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	return codecs[contentSubtype]
 }
 
 // Encoding 编码接口定义
@@ -3,6 +3,8 @@ package json
 import (
 	"testing"
 
+	"github.com/zhufuyi/pkg/encoding"
+
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/protobuf/compiler/protogen"
 	"google.golang.org/protobuf/reflect/protoreflect"
@@ -95,3 +97,9 @@ func TestJSON4(t *testing.T) {
 	err := c.Unmarshal(nil, &obj4{})
 	assert.NoError(t, err)
 }
+
+func TestRegister(t *testing.T) {
+	// 导入json包不替换内置的application/json编码
+	assert.Equal(t, codec{}, encoding.GetCodec(Name))
+	assert.Equal(t, encoding.JSONEncoding{}, encoding.Get(encoding.MIMEJSON))
+}
@@ -0,0 +1,169 @@
+package encoding
+
+import (
+	"errors"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 内置编码对应的MIME类型，压缩格式使用+后缀
+const (
+	MIMEJSON       = "application/json"
+	MIMEJSONGzip   = "application/json+gzip"
+	MIMEJSONSnappy = "application/json+snappy"
+	MIMEJSONZstd   = "application/json+zstd"
+	MIMEJSONLz4    = "application/json+lz4"
+	MIMEGob        = "application/x-gob"
+	MIMEMsgPack    = "application/msgpack"
+	MIMECBOR       = "application/cbor"
+	MIMEProtobuf   = "application/x-protobuf"
+)
+
+var (
+	// ErrUnsupportedMediaType 没有注册Content-Type对应的编码
+	ErrUnsupportedMediaType = errors.New("unsupported media type")
+
+	// DefaultMIMEType Content-Type和Accept为空或没有匹配的编码时使用的MIME类型
+	DefaultMIMEType = MIMEJSON
+)
+
+var (
+	registryMutex sync.RWMutex
+	registry      = map[string]Encoding{} // MIME类型 -> 编码，Codec也注册在这里
+	codecs        = map[string]Codec{}    // content-subtype -> Codec
+)
+
+func init() {
+	Register(MIMEJSON, JSONEncoding{})
+	Register(MIMEJSONGzip, JSONGzipEncoding{})
+	Register(MIMEJSONSnappy, JSONSnappyEncoding{})
+	Register(MIMEJSONZstd, JSONZstdEncoding{})
+	Register(MIMEJSONLz4, JSONLz4Encoding{})
+	Register(MIMEGob, GobEncoding{})
+	Register(MIMEMsgPack, MsgPackEncoding{})
+	Register("application/x-msgpack", MsgPackEncoding{})
+	Register(MIMECBOR, CBOREncoding{})
+	Register(MIMEProtobuf, ProtobufEncoding{})
+	Register("application/protobuf", ProtobufEncoding{})
+}
+
+// 去掉参数并转为小写，例如 "Application/JSON; charset=utf-8" -> "application/json"
+func normalizeMIMEType(mimeType string) string {
+	if mt, _, err := mime.ParseMediaType(mimeType); err == nil {
+		return mt
+	}
+	if i := strings.Index(mimeType, ";"); i >= 0 {
+		mimeType = mimeType[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(mimeType))
+}
+
+// Register registers the encoding with the MIME type, the one registered last will take effect
+func Register(mimeType string, e Encoding) {
+	if e == nil {
+		panic("cannot register a nil Encoding")
+	}
+	mimeType = normalizeMIMEType(mimeType)
+	if mimeType == "" {
+		panic("cannot register Encoding with empty MIME type")
+	}
+
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	registry[mimeType] = e
+}
+
+// Get gets a registered encoding by MIME type, or nil if no encoding is registered
+func Get(mimeType string) Encoding {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	return registry[normalizeMIMEType(mimeType)]
+}
+
+// MIMETypes returns all registered MIME types in sorted order
+func MIMETypes() []string {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	types := make([]string, 0, len(registry))
+	for mt := range registry {
+		types = append(types, mt)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// ForContentType get the encoding for decoding the request body or message payload by Content-Type,
+// empty Content-Type uses DefaultMIMEType, return ErrUnsupportedMediaType if not registered
+func ForContentType(contentType string) (Encoding, error) {
+	if strings.TrimSpace(contentType) == "" {
+		contentType = DefaultMIMEType
+	}
+	e := Get(contentType)
+	if e == nil {
+		return nil, ErrUnsupportedMediaType
+	}
+	return e, nil
+}
+
+type acceptItem struct {
+	mimeType string
+	q        float64
+}
+
+// 解析Accept，按q值从高到低排序
+func parseAccept(accept string) []acceptItem {
+	var items []acceptItem
+	for _, part := range strings.Split(accept, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		mt, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if q > 0 {
+			items = append(items, acceptItem{mimeType: mt, q: q})
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].q > items[j].q
+	})
+	return items
+}
+
+// Negotiate pick the response encoding by Accept, supports q-values and wildcards such as application/* and */*,
+// return DefaultMIMEType and its encoding if Accept is empty or nothing matches
+func Negotiate(accept string) (string, Encoding) {
+	for _, item := range parseAccept(accept) {
+		switch {
+		case item.mimeType == "*/*":
+			return DefaultMIMEType, Get(DefaultMIMEType)
+		case strings.HasSuffix(item.mimeType, "/*"):
+			prefix := strings.TrimSuffix(item.mimeType, "*")
+			if strings.HasPrefix(DefaultMIMEType, prefix) {
+				return DefaultMIMEType, Get(DefaultMIMEType)
+			}
+			for _, mt := range MIMETypes() {
+				if strings.HasPrefix(mt, prefix) {
+					return mt, Get(mt)
+				}
+			}
+		default:
+			if e := Get(item.mimeType); e != nil {
+				return item.mimeType, e
+			}
+		}
+	}
+	return DefaultMIMEType, Get(DefaultMIMEType)
+}
@@ -0,0 +1,91 @@
+package encoding
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestRegistry(t *testing.T) {
+	Register(MIMEJSON, JSONEncoding{})
+
+	assert.Equal(t, JSONEncoding{}, Get("Application/JSON; charset=utf-8"))
+	assert.Equal(t, MsgPackEncoding{}, Get("application/x-msgpack"))
+	assert.Nil(t, Get("text/unknown"))
+	assert.Contains(t, MIMETypes(), MIMECBOR)
+
+	e, err := ForContentType("")
+	assert.NoError(t, err)
+	assert.Equal(t, JSONEncoding{}, e)
+	e, err = ForContentType("application/cbor")
+	assert.NoError(t, err)
+	assert.Equal(t, CBOREncoding{}, e)
+	_, err = ForContentType("text/unknown")
+	assert.ErrorIs(t, err, ErrUnsupportedMediaType)
+
+	// Codec和Encoding共用注册表
+	RegisterCodec(codec3{})
+	assert.NotNil(t, GetCodec("x-codec3"))
+	assert.Equal(t, codec3{}, Get("application/x-codec3"))
+	assert.Nil(t, GetCodec("cbor")) // 不是Codec
+
+	// Codec不替换已经注册的Encoding
+	RegisterCodec(codec{})
+	assert.Equal(t, codec{}, GetCodec("json"))
+	assert.Equal(t, JSONEncoding{}, Get(MIMEJSON))
+
+	assert.Panics(t, func() { Register("", JSONEncoding{}) })
+	assert.Panics(t, func() { Register(MIMEJSON, nil) })
+}
+
+type codec3 struct{ codec }
+
+func (c codec3) Name() string {
+	return "x-codec3"
+}
+
+func TestNegotiate(t *testing.T) {
+	Register(MIMEJSON, JSONEncoding{})
+
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", MIMEJSON},
+		{"*/*", MIMEJSON},
+		{"text/html, application/msgpack;q=0.9, application/json;q=0.8", MIMEMsgPack},
+		{"application/cbor;q=0.5, application/x-protobuf", MIMEProtobuf},
+		{"application/*", MIMEJSON},
+		{"text/html, text/plain", MIMEJSON},
+		{"application/json+zstd;q=0, application/json+lz4", MIMEJSONLz4},
+	}
+	for _, tt := range tests {
+		mt, e := Negotiate(tt.accept)
+		assert.Equal(t, tt.want, mt, tt.accept)
+		assert.Equal(t, Get(tt.want), e)
+	}
+}
+
+func TestNewEncodings(t *testing.T) {
+	assert.NoError(t, xEncoding(CBOREncoding{}))
+	assert.NoError(t, xEncoding(JSONZstdEncoding{}))
+	assert.NoError(t, xEncoding(JSONLz4Encoding{}))
+
+	pe := ProtobufEncoding{}
+	data, err := pe.Marshal(wrapperspb.String("foo"))
+	assert.NoError(t, err)
+	v := &wrapperspb.StringValue{}
+	assert.NoError(t, pe.Unmarshal(data, v))
+	assert.Equal(t, "foo", v.GetValue())
+	_, err = pe.Marshal(&obj{})
+	assert.Error(t, err)
+	assert.Error(t, pe.Unmarshal(data, &obj{}))
+
+	_, err = JSONZstdEncoding{}.Marshal(make(chan string))
+	assert.Error(t, err)
+	assert.Error(t, JSONZstdEncoding{}.Unmarshal([]byte("foo"), &obj{}))
+	_, err = JSONLz4Encoding{}.Marshal(make(chan string))
+	assert.Error(t, err)
+	assert.Error(t, JSONLz4Encoding{}.Unmarshal([]byte("foo"), &obj{}))
+}
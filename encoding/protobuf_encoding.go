@@ -0,0 +1,28 @@
+package encoding
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// ProtobufEncoding protobuf格式，参数必须实现proto.Message
+type ProtobufEncoding struct{}
+
+// Marshal protobuf encode
+func (p ProtobufEncoding) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("failed to marshal, message is %T, want proto.Message", v)
+	}
+	return proto.Marshal(m)
+}
+
+// Unmarshal protobuf decode
+func (p ProtobufEncoding) Unmarshal(data []byte, value interface{}) error {
+	m, ok := value.(proto.Message)
+	if !ok {
+		return fmt.Errorf("failed to unmarshal, message is %T, want proto.Message", value)
+	}
+	return proto.Unmarshal(data, m)
+}
@@ -0,0 +1,215 @@
+package errcode
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+)
+
+// CodeRange 错误码范围[Min, Max)
+type CodeRange struct {
+	Min int
+	Max int
+}
+
+// Contains whether the code is in the range
+func (r CodeRange) Contains(code int) bool {
+	return code >= r.Min && code < r.Max
+}
+
+var (
+	// HTTPSystemCodeRange http系统级错误码保留范围，只能在http_system_code.go中定义
+	HTTPSystemCodeRange = CodeRange{Min: 10000, Max: 20000}
+	// RPCSystemCodeRange rpc系统级错误码保留范围，只能在rpc_system_code.go中定义
+	RPCSystemCodeRange = CodeRange{Min: 30000, Max: 40000}
+)
+
+// 错误码类型
+const (
+	KindHTTP    = "http"
+	KindRPC     = "rpc"
+	KindUnified = "unified"
+)
+
+// CatalogEntry 错误码目录中的一条记录
+type CatalogEntry struct {
+	Code       int    `json:"code"`
+	Msg        string `json:"msg"`
+	Kind       string `json:"kind"`             // http、rpc或unified
+	HTTPStatus int    `json:"httpStatus"`       // 返回的http状态码
+	RPCCode    string `json:"rpcCode"`          // 返回的grpc状态码
+	Reason     string `json:"reason,omitempty"` // ErrorInfo中的reason，只有unified类型有
+	System     bool   `json:"system"`           // 是否为系统级错误码
+}
+
+var kindOrder = map[string]int{KindHTTP: 0, KindRPC: 1, KindUnified: 2}
+
+// Catalog list all registered error codes, sorted by kind and code
+func Catalog() []CatalogEntry {
+	var entries []CatalogEntry
+	for code, e := range errCodes {
+		m := getMapping(code)
+		entries = append(entries, CatalogEntry{
+			Code:       code,
+			Msg:        e.Msg(),
+			Kind:       KindHTTP,
+			HTTPStatus: m.httpStatus,
+			RPCCode:    m.rpcCode.String(),
+			System:     systemHTTPCodes[code],
+		})
+	}
+	for code, msg := range statusCodes {
+		entry := CatalogEntry{
+			Code:       int(code),
+			Msg:        msg,
+			Kind:       KindRPC,
+			HTTPStatus: http.StatusOK,
+			RPCCode:    code.String(), // 业务错误码直接作为grpc状态码返回
+			System:     systemRPCCodes[int(code)],
+		}
+		if m, ok := systemMappings[int(code)]; ok {
+			entry.HTTPStatus = m.httpStatus
+			entry.RPCCode = m.rpcCode.String()
+		}
+		entries = append(entries, entry)
+	}
+	for code, e := range codeErrors {
+		entries = append(entries, CatalogEntry{
+			Code:       code,
+			Msg:        e.Msg(),
+			Kind:       KindUnified,
+			HTTPStatus: e.HTTPStatus(),
+			RPCCode:    e.RPCCode().String(),
+			Reason:     e.Reason(),
+			System:     systemHTTPCodes[code] || systemRPCCodes[code],
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Kind != entries[j].Kind {
+			return kindOrder[entries[i].Kind] < kindOrder[entries[j].Kind]
+		}
+		return entries[i].Code < entries[j].Code
+	})
+	return entries
+}
+
+// CatalogJSON export the catalog as json
+func CatalogJSON() ([]byte, error) {
+	return json.MarshalIndent(Catalog(), "", "  ")
+}
+
+// CatalogMarkdown export the catalog as markdown table
+func CatalogMarkdown() string {
+	var sb strings.Builder
+	sb.WriteString("| code | msg | kind | http status | grpc code | reason |\n")
+	sb.WriteString("|:-----|:----|:-----|:------------|:----------|:-------|\n")
+	for _, e := range Catalog() {
+		sb.WriteString(fmt.Sprintf("| %d | %s | %s | %d | %s | %s |\n",
+			e.Code, escapeMarkdown(e.Msg), e.Kind, e.HTTPStatus, e.RPCCode, e.Reason))
+	}
+	return sb.String()
+}
+
+func escapeMarkdown(s string) string {
+	return strings.ReplaceAll(s, "|", "\\|")
+}
+
+// CatalogOpenAPI export the catalog as an OpenAPI 3 components snippet,
+// including the ErrorCode enum schema and the ErrorResponse schema returned by gin/response
+func CatalogOpenAPI() ([]byte, error) {
+	var enum []int
+	var descriptions []string
+	seen := map[int]bool{}
+	for _, e := range Catalog() {
+		if e.Kind == KindRPC || seen[e.Code] {
+			continue // grpc错误码不会在http接口中返回
+		}
+		seen[e.Code] = true
+		enum = append(enum, e.Code)
+		descriptions = append(descriptions, fmt.Sprintf("%d: %s", e.Code, e.Msg))
+	}
+
+	snippet := map[string]interface{}{
+		"components": map[string]interface{}{
+			"schemas": map[string]interface{}{
+				"ErrorCode": map[string]interface{}{
+					"type":                "integer",
+					"enum":                enum,
+					"x-enum-descriptions": descriptions,
+					"description":         strings.Join(descriptions, "\n"),
+				},
+				"ErrorResponse": map[string]interface{}{
+					"type":     "object",
+					"required": []string{"code", "msg", "data"},
+					"properties": map[string]interface{}{
+						"code": map[string]interface{}{"$ref": "#/components/schemas/ErrorCode"},
+						"msg":  map[string]interface{}{"type": "string"},
+						"data": map[string]interface{}{"type": "object"},
+					},
+				},
+			},
+		},
+	}
+	return json.MarshalIndent(snippet, "", "  ")
+}
+
+// CatalogHandler return a gin handler serving the catalog,
+// the format is specified by the query parameter format=json(default)|markdown|openapi
+func CatalogHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Query("format") {
+		case "markdown", "md":
+			c.Data(http.StatusOK, "text/markdown; charset=utf-8", []byte(CatalogMarkdown()))
+		case "openapi":
+			data, err := CatalogOpenAPI()
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"code": InternalServerError.Code(), "msg": err.Error()})
+				return
+			}
+			c.Data(http.StatusOK, "application/json; charset=utf-8", data)
+		default:
+			c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "ok", "data": Catalog()})
+		}
+	}
+}
+
+// CheckReservedCodes check that the service level codes do not use the reserved system code ranges,
+// and the same code registered by NewError and NewCodeError has the same message,
+// it is recommended to call it in the unit test or at startup
+func CheckReservedCodes() error {
+	var conflicts []string
+	for _, e := range Catalog() {
+		if e.System {
+			continue
+		}
+		if HTTPSystemCodeRange.Contains(e.Code) {
+			conflicts = append(conflicts, fmt.Sprintf("%s code = %d is in the reserved http system code range [%d, %d)",
+				e.Kind, e.Code, HTTPSystemCodeRange.Min, HTTPSystemCodeRange.Max))
+		}
+		if RPCSystemCodeRange.Contains(e.Code) {
+			conflicts = append(conflicts, fmt.Sprintf("%s code = %d is in the reserved rpc system code range [%d, %d)",
+				e.Kind, e.Code, RPCSystemCodeRange.Min, RPCSystemCodeRange.Max))
+		}
+	}
+
+	for code, ce := range codeErrors {
+		if e, ok := errCodes[code]; ok && e.Msg() != ce.Msg() {
+			conflicts = append(conflicts, fmt.Sprintf("code = %d has different messages, http: %s, unified: %s", code, e.Msg(), ce.Msg()))
+		}
+		if msg, ok := statusCodes[codes.Code(code)]; ok && msg != ce.Msg() {
+			conflicts = append(conflicts, fmt.Sprintf("code = %d has different messages, rpc: %s, unified: %s", code, msg, ce.Msg()))
+		}
+	}
+
+	if len(conflicts) > 0 {
+		sort.Strings(conflicts)
+		return fmt.Errorf("error code conflicts:\n%s", strings.Join(conflicts, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package errcode
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+)
+
+func TestCatalog(t *testing.T) {
+	entries := Catalog()
+	assert.NotEmpty(t, entries)
+
+	var found bool
+	for _, e := range entries {
+		if e.Kind == KindHTTP && e.Code == InvalidParams.Code() {
+			found = true
+			assert.True(t, e.System)
+			assert.Equal(t, http.StatusBadRequest, e.HTTPStatus)
+			assert.Equal(t, codes.InvalidArgument.String(), e.RPCCode)
+		}
+	}
+	assert.True(t, found)
+	assert.Equal(t, KindHTTP, entries[0].Kind)
+	assert.Equal(t, KindUnified, entries[len(entries)-1].Kind)
+
+	data, err := CatalogJSON()
+	assert.NoError(t, err)
+	var list []CatalogEntry
+	assert.NoError(t, json.Unmarshal(data, &list))
+	assert.Equal(t, len(entries), len(list))
+
+	md := CatalogMarkdown()
+	assert.Contains(t, md, "| 10001 | Invalid Parameter | http | 400 | InvalidArgument |  |")
+	assert.Contains(t, md, "| 20201 | user not found | unified | 404 | NotFound | USER_NOT_FOUND |")
+
+	data, err = CatalogOpenAPI()
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"ErrorResponse"`)
+	assert.Contains(t, string(data), `"#/components/schemas/ErrorCode"`)
+	assert.NotContains(t, string(data), "30001: Invalid Parameter")
+}
+
+func TestCatalogHandler(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.GET("/codes", CatalogHandler())
+
+	for format, contentType := range map[string]string{
+		"":         "application/json",
+		"markdown": "text/markdown",
+		"openapi":  "application/json",
+	} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/codes?format="+format, nil)
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Header().Get("Content-Type"), contentType)
+		assert.NotEmpty(t, w.Body.String())
+	}
+}
+
+func TestCheckReservedCodes(t *testing.T) {
+	assert.NoError(t, CheckReservedCodes())
+
+	// 业务错误码使用了系统级错误码范围
+	NewError(10101, "service code in system range")
+	NewRPCStatus(30101, "service code in system range")
+	defer func() {
+		delete(errCodes, 10101)
+		delete(statusCodes, 30101)
+	}()
+	err := CheckReservedCodes()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "http code = 10101 is in the reserved http system code range")
+	assert.Contains(t, err.Error(), "rpc code = 30101 is in the reserved rpc system code range")
+
+	// 同一个错误码的信息不一致
+	NewCodeError(20301, "bar")
+	NewError(20301, "foo")
+	defer func() {
+		delete(errCodes, 20301)
+		delete(codeErrors, 20301)
+	}()
+	err = CheckReservedCodes()
+	assert.Contains(t, err.Error(), "code = 20301 has different messages")
+}
@@ -1,6 +1,7 @@
 package errcode
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -84,12 +85,20 @@ func (e *Error) ToHTTPCode() int {
 	return e.Code()
 }
 
-// ParseError parsing out error codes from error messages
+// ParseError parsing out error codes from error messages, CodeError in the error chain is converted directly
 func ParseError(err error) *Error {
 	if err == nil {
 		return Success
 	}
 
+	var ce *CodeError
+	if errors.As(err, &ce) {
+		if e, ok := errCodes[ce.Code()]; ok {
+			return e
+		}
+		return &Error{code: ce.Code(), msg: ce.Msg()}
+	}
+
 	unknownError := &Error{
 		code: -1,
 		msg:  "unknown error",
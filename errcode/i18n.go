@@ -0,0 +1,252 @@
+package errcode
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// DefaultLanguage 请求的语言没有对应的翻译时使用的语言，也没有翻译时使用注册时的错误信息
+	DefaultLanguage = "en"
+	// LanguageQueryKey 指定语言的请求参数，优先级高于Accept-Language
+	LanguageQueryKey = "lang"
+
+	i18nMutex sync.RWMutex
+	messages  = map[string]map[int]string{} // 语言 -> 错误码 -> 错误信息
+)
+
+// LoadMessages add translated messages of a language, e.g. LoadMessages("zh", map[int]string{10001: "参数错误"})
+func LoadMessages(lang string, msgs map[int]string) {
+	lang = normalizeLanguage(lang)
+
+	i18nMutex.Lock()
+	defer i18nMutex.Unlock()
+	if messages[lang] == nil {
+		messages[lang] = make(map[int]string, len(msgs))
+	}
+	for code, msg := range msgs {
+		messages[lang][code] = msg
+	}
+}
+
+// LoadMessageFile load translated messages from yaml or json file, the content format is language -> code -> message,
+// e.g.
+//
+//	zh:
+//	  10001: 参数错误
+//	en:
+//	  10001: Invalid Parameter
+func LoadMessageFile(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	content := map[string]map[string]string{}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &content)
+	case ".json":
+		err = json.Unmarshal(data, &content)
+	default:
+		return fmt.Errorf("unsupported message file type %s, only yaml and json are supported", filepath.Ext(file))
+	}
+	if err != nil {
+		return fmt.Errorf("parse message file %s error: %v", file, err)
+	}
+
+	for lang, msgs := range content {
+		m := make(map[int]string, len(msgs))
+		for codeStr, msg := range msgs {
+			code, err := strconv.Atoi(codeStr)
+			if err != nil {
+				return fmt.Errorf("invalid error code %s in message file %s", codeStr, file)
+			}
+			m[code] = msg
+		}
+		LoadMessages(lang, m)
+	}
+	return nil
+}
+
+// Translate get the translated message of the code, fallback to the base language (zh-cn -> zh) and the default language
+func Translate(code int, lang string) (string, bool) {
+	i18nMutex.RLock()
+	defer i18nMutex.RUnlock()
+
+	for _, l := range fallbackLanguages(lang) {
+		if msg, ok := messages[l][code]; ok {
+			return msg, true
+		}
+	}
+	return "", false
+}
+
+func translate(code int, lang string, defaultMsg string) string {
+	if msg, ok := Translate(code, lang); ok {
+		return msg
+	}
+	return defaultMsg
+}
+
+// 依次查找的语言，例如zh-cn -> zh -> en
+func fallbackLanguages(lang string) []string {
+	var langs []string
+	if lang = normalizeLanguage(lang); lang != "" {
+		langs = append(langs, lang)
+		if i := strings.Index(lang, "-"); i > 0 {
+			langs = append(langs, lang[:i])
+		}
+	}
+	return append(langs, normalizeLanguage(DefaultLanguage))
+}
+
+func normalizeLanguage(lang string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(lang), "_", "-"))
+}
+
+// MsgWithLanguage get the translated message, return the registered message if there is no translation
+func (e *Error) MsgWithLanguage(lang string) string {
+	return translate(e.code, lang, e.msg)
+}
+
+// Localize return a copy with the translated message, the message set by WithMsg is not translated
+func (e *CodeError) Localize(lang string) *CodeError {
+	if e.customMsg {
+		return e
+	}
+	newError := e.clone()
+	newError.msg = translate(e.code, lang, e.msg)
+	return newError
+}
+
+// ParseAcceptLanguage parse the Accept-Language header, return languages sorted by quality,
+// e.g. "zh-CN,zh;q=0.9,en;q=0.8" -> [zh-cn zh en]
+func ParseAcceptLanguage(header string) []string {
+	type item struct {
+		lang string
+		q    float64
+	}
+	var items []item
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		lang := normalizeLanguage(fields[0])
+		if lang == "" || lang == "*" {
+			continue
+		}
+		q := 1.0
+		for _, f := range fields[1:] {
+			f = strings.TrimSpace(f)
+			if strings.HasPrefix(f, "q=") {
+				if v, err := strconv.ParseFloat(f[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q > 0 {
+			items = append(items, item{lang: lang, q: q})
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].q > items[j].q
+	})
+	langs := make([]string, 0, len(items))
+	for _, it := range items {
+		langs = append(langs, it.lang)
+	}
+	return langs
+}
+
+// 返回第一个有翻译的语言，都没有时返回默认语言
+func matchLanguage(candidates []string) string {
+	i18nMutex.RLock()
+	defer i18nMutex.RUnlock()
+
+	for _, lang := range candidates {
+		if _, ok := messages[lang]; ok {
+			return lang
+		}
+		if i := strings.Index(lang, "-"); i > 0 {
+			if _, ok := messages[lang[:i]]; ok {
+				return lang[:i]
+			}
+		}
+	}
+	return normalizeLanguage(DefaultLanguage)
+}
+
+// GetLanguage get the language of the http request, the query parameter lang takes precedence over Accept-Language
+func GetLanguage(c *gin.Context) string {
+	var candidates []string
+	if lang := c.Query(LanguageQueryKey); lang != "" {
+		candidates = append(candidates, normalizeLanguage(lang))
+	}
+	candidates = append(candidates, ParseAcceptLanguage(c.GetHeader("Accept-Language"))...)
+	return matchLanguage(candidates)
+}
+
+// LanguageFromContext get the language of the grpc request from the incoming metadata,
+// lang takes precedence over accept-language, grpc-gateway forwards the header as grpcgateway-accept-language
+func LanguageFromContext(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return normalizeLanguage(DefaultLanguage)
+	}
+
+	var candidates []string
+	for _, v := range md.Get(LanguageQueryKey) {
+		candidates = append(candidates, normalizeLanguage(v))
+	}
+	for _, key := range []string{"accept-language", "grpcgateway-accept-language"} {
+		for _, v := range md.Get(key) {
+			candidates = append(candidates, ParseAcceptLanguage(v)...)
+		}
+	}
+	return matchLanguage(candidates)
+}
+
+// LocalizeError translate the message of the error returned by grpc server according to the language of the request,
+// CodeError is translated directly, status error returned by RPCStatus is translated by the code
+func LocalizeError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	lang := LanguageFromContext(ctx)
+
+	var ce *CodeError
+	if errors.As(err, &ce) {
+		return ce.Localize(lang)
+	}
+
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	code := st.Code()
+	registered, ok := statusCodes[code]
+	if !ok {
+		return err
+	}
+	msg, ok := Translate(int(code), lang)
+	if !ok || !strings.HasPrefix(st.Message(), registered) {
+		return err
+	}
+	// 保留RPCStatus.Err添加的详情
+	p := st.Proto()
+	p.Message = msg + strings.TrimPrefix(st.Message(), registered)
+	return status.FromProto(p).Err()
+}
@@ -0,0 +1,95 @@
+package errcode
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestLoadMessageFile(t *testing.T) {
+	dir := t.TempDir()
+	yamlFile := filepath.Join(dir, "messages.yaml")
+	_ = os.WriteFile(yamlFile, []byte("zh:\n  10001: 参数错误\n  30004: 资源不存在\n"), 0666)
+	jsonFile := filepath.Join(dir, "messages.json")
+	_ = os.WriteFile(jsonFile, []byte(`{"zh-TW": {"10001": "參數錯誤"}, "en": {"20201": "User not found"}}`), 0666)
+
+	assert.NoError(t, LoadMessageFile(yamlFile))
+	assert.NoError(t, LoadMessageFile(jsonFile))
+
+	assert.Equal(t, "参数错误", InvalidParams.MsgWithLanguage("zh"))
+	assert.Equal(t, "参数错误", InvalidParams.MsgWithLanguage("zh_CN")) // zh-cn -> zh
+	assert.Equal(t, "參數錯誤", InvalidParams.MsgWithLanguage("zh-TW"))
+	assert.Equal(t, "Invalid Parameter", InvalidParams.MsgWithLanguage("fr")) // 没有翻译使用注册时的信息
+	assert.Equal(t, "User not found", errUserNotFound.Localize("fr").Msg())   // 默认语言
+	assert.Equal(t, "custom", errUserNotFound.WithMsg("custom").Localize("en").Msg())
+
+	_ = os.WriteFile(filepath.Join(dir, "bad.yaml"), []byte("zh:\n  abc: 参数错误\n"), 0666)
+	assert.Error(t, LoadMessageFile(filepath.Join(dir, "bad.yaml")))
+	assert.Error(t, LoadMessageFile(filepath.Join(dir, "messages.txt")))
+}
+
+func TestParseAcceptLanguage(t *testing.T) {
+	assert.Equal(t, []string{"zh-cn", "zh", "en"}, ParseAcceptLanguage("en;q=0.8, zh-CN,zh;q=0.9"))
+	assert.Equal(t, []string{"fr"}, ParseAcceptLanguage("*;q=0.5, fr, de;q=0"))
+	assert.Empty(t, ParseAcceptLanguage(""))
+}
+
+func TestGetLanguage(t *testing.T) {
+	LoadMessages("zh", map[int]string{Unauthorized.Code(): "未授权"})
+
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.GET("/lang", func(c *gin.Context) {
+		c.String(http.StatusOK, GetLanguage(c))
+	})
+
+	tests := []struct {
+		query  string
+		header string
+		want   string
+	}{
+		{"", "", "en"},
+		{"", "fr-FR,zh-CN;q=0.9", "zh"},
+		{"?lang=en", "zh-CN", "en"},
+		{"?lang=ja", "", "en"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/lang"+tt.query, nil)
+		req.Header.Set("Accept-Language", tt.header)
+		r.ServeHTTP(w, req)
+		assert.Equal(t, tt.want, w.Body.String(), tt)
+	}
+}
+
+func TestLocalizeError(t *testing.T) {
+	LoadMessages("zh", map[int]string{
+		int(StatusUnauthorized.status.Code()): "未授权",
+		errUserNotFound.Code():                "用户不存在",
+	})
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("accept-language", "zh-CN,zh;q=0.9"))
+	assert.Equal(t, "zh", LanguageFromContext(ctx))
+	assert.Equal(t, "en", LanguageFromContext(context.Background()))
+
+	err := LocalizeError(ctx, StatusUnauthorized.Err(Any("token", "expired")))
+	st, _ := status.FromError(err)
+	assert.Equal(t, StatusUnauthorized.status.Code(), st.Code())
+	assert.Equal(t, "未授权 details = [token: {expired}]", st.Message())
+
+	err = LocalizeError(ctx, errUserNotFound)
+	assert.Equal(t, "用户不存在", Convert(err).Msg())
+
+	// 没有注册或没有翻译的错误不变
+	err = LocalizeError(ctx, StatusForbidden.Err())
+	st, _ = status.FromError(err)
+	assert.Equal(t, "Forbidden", st.Message())
+	assert.Nil(t, LocalizeError(ctx, nil))
+}
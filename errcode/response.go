@@ -40,7 +40,7 @@ func (resp *defaultResponse) Success(c *gin.Context, data interface{}) {
 
 // ParamError response parameter error information
 func (resp *defaultResponse) ParamError(c *gin.Context, err error) {
-	resp.response(c, http.StatusOK, InvalidParams.Code(), InvalidParams.Msg(), struct{}{})
+	resp.response(c, http.StatusOK, InvalidParams.Code(), InvalidParams.MsgWithLanguage(GetLanguage(c)), struct{}{})
 }
 
 // Error response error information, if return true, this error is not important and can be ignored
@@ -69,7 +69,7 @@ func (resp *defaultResponse) Error(c *gin.Context, err error) bool {
 		if e.code == NotFound.code {
 			isIgnore = true
 		}
-		resp.response(c, http.StatusOK, e.code, e.msg, struct{}{})
+		resp.response(c, http.StatusOK, e.code, e.MsgWithLanguage(GetLanguage(c)), struct{}{})
 		return isIgnore
 	}
 
@@ -78,7 +78,7 @@ func (resp *defaultResponse) Error(c *gin.Context, err error) bool {
 	if e.code == NotFound.code {
 		isIgnore = true
 	}
-	resp.response(c, http.StatusOK, e.code, e.msg, struct{}{})
+	resp.response(c, http.StatusOK, e.code, e.MsgWithLanguage(GetLanguage(c)), struct{}{})
 	return isIgnore
 }
 
@@ -0,0 +1,468 @@
+package errcode
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorDomain ErrorInfo中的domain，通常设置为服务名称
+var ErrorDomain = "errcode"
+
+// metadataCodeKey ErrorInfo.Metadata中保存错误码的key
+const metadataCodeKey = "code"
+
+var codeErrors = map[int]*CodeError{}
+
+// 系统级错误码对应的grpc状态码和http状态码，http错误码(100xx)和rpc错误码(300xx)对应同一种错误
+type codeMapping struct {
+	rpcCode    codes.Code
+	httpStatus int
+}
+
+var (
+	systemMappings  = map[int]codeMapping{}
+	systemHTTPCodes = map[int]bool{}
+	systemRPCCodes  = map[int]bool{}
+)
+
+func init() {
+	mappings := []struct {
+		httpErr   *Error
+		rpcStatus *RPCStatus
+		mapping   codeMapping
+	}{
+		{Success, StatusSuccess, codeMapping{codes.OK, http.StatusOK}},
+		{InvalidParams, StatusInvalidParams, codeMapping{codes.InvalidArgument, http.StatusBadRequest}},
+		{Unauthorized, StatusUnauthorized, codeMapping{codes.Unauthenticated, http.StatusUnauthorized}},
+		{InternalServerError, StatusInternalServerError, codeMapping{codes.Internal, http.StatusInternalServerError}},
+		{NotFound, StatusNotFound, codeMapping{codes.NotFound, http.StatusNotFound}},
+		{AlreadyExists, StatusAlreadyExists, codeMapping{codes.AlreadyExists, http.StatusConflict}},
+		{Timeout, StatusTimeout, codeMapping{codes.DeadlineExceeded, http.StatusRequestTimeout}},
+		{TooManyRequests, StatusTooManyRequests, codeMapping{codes.ResourceExhausted, http.StatusTooManyRequests}},
+		{Forbidden, StatusForbidden, codeMapping{codes.PermissionDenied, http.StatusForbidden}},
+		{LimitExceed, StatusLimitExceed, codeMapping{codes.ResourceExhausted, http.StatusTooManyRequests}},
+		{DeadlineExceeded, StatusDeadlineExceeded, codeMapping{codes.DeadlineExceeded, http.StatusGatewayTimeout}},
+		{AccessDenied, StatusAccessDenied, codeMapping{codes.PermissionDenied, http.StatusForbidden}},
+		{MethodNotAllowed, StatusMethodNotAllowed, codeMapping{codes.Unimplemented, http.StatusMethodNotAllowed}},
+		{ServiceUnavailable, StatusServiceUnavailable, codeMapping{codes.Unavailable, http.StatusServiceUnavailable}},
+	}
+	for _, m := range mappings {
+		systemMappings[m.httpErr.Code()] = m.mapping
+		systemMappings[int(m.rpcStatus.status.Code())] = m.mapping
+		systemHTTPCodes[m.httpErr.Code()] = true
+		systemRPCCodes[int(m.rpcStatus.status.Code())] = true
+	}
+}
+
+func getMapping(code int) codeMapping {
+	if m, ok := systemMappings[code]; ok {
+		return m
+	}
+	return codeMapping{codes.Unknown, http.StatusOK}
+}
+
+// FieldViolation 参数错误详情，对应google.rpc.BadRequest.FieldViolation
+type FieldViolation struct {
+	Field       string `json:"field"`
+	Description string `json:"description"`
+}
+
+// CodeError 统一的错误类型，同一个定义既可以作为http响应返回，也可以作为grpc status返回，
+// grpc status中携带google.rpc.ErrorInfo和google.rpc.BadRequest详情，客户端不需要解析字符串即可还原错误，
+// 错误码相同时errors.Is返回true，可以通过WithCause包装原始错误
+type CodeError struct {
+	code       int
+	msg        string
+	reason     string
+	rpcCode    codes.Code
+	httpStatus int
+	metadata   map[string]string
+	violations []FieldViolation
+	cause      error
+	customMsg  bool // 通过WithMsg设置的错误信息不翻译
+}
+
+// CodeErrorOption set the unified error options.
+type CodeErrorOption func(*codeErrorOptions)
+
+type codeErrorOptions struct {
+	reason     string
+	rpcCode    codes.Code
+	httpStatus int
+}
+
+func (o *codeErrorOptions) apply(opts ...CodeErrorOption) {
+	for _, opt := range opts {
+		opt(o)
+	}
+}
+
+// 系统级错误码映射为标准状态码，业务错误码默认使用codes.Unknown和http 200，与response.Error保持一致
+func defaultCodeErrorOptions(code int) *codeErrorOptions {
+	m := getMapping(code)
+	return &codeErrorOptions{
+		reason:     "CODE_" + strconv.Itoa(code),
+		rpcCode:    m.rpcCode,
+		httpStatus: m.httpStatus,
+	}
+}
+
+// WithReason set the reason of ErrorInfo, e.g. USER_NOT_FOUND, the default is CODE_<code>
+func WithReason(reason string) CodeErrorOption {
+	return func(o *codeErrorOptions) {
+		o.reason = reason
+	}
+}
+
+// WithRPCCode set grpc status code
+func WithRPCCode(code codes.Code) CodeErrorOption {
+	return func(o *codeErrorOptions) {
+		o.rpcCode = code
+	}
+}
+
+// WithHTTPStatus set http status code
+func WithHTTPStatus(httpStatus int) CodeErrorOption {
+	return func(o *codeErrorOptions) {
+		o.httpStatus = httpStatus
+	}
+}
+
+// NewCodeError create a new unified error, the grpc code and http status are derived from the code by default
+func NewCodeError(code int, msg string, opts ...CodeErrorOption) *CodeError {
+	if v, ok := codeErrors[code]; ok {
+		panic(fmt.Sprintf("error code = %d already exists, please replace with a new error code, old msg = %s", code, v.Msg()))
+	}
+	if v, ok := errCodes[code]; ok {
+		panic(fmt.Sprintf("error code = %d already exists in http error codes, please replace with a new error code, old msg = %s", code, v.Msg()))
+	}
+	if v, ok := statusCodes[codes.Code(code)]; ok {
+		panic(fmt.Sprintf("error code = %d already exists in grpc status codes, please replace with a new error code, old msg = %s", code, v))
+	}
+	e := newCodeError(code, msg, opts...)
+	codeErrors[code] = e
+	return e
+}
+
+func newCodeError(code int, msg string, opts ...CodeErrorOption) *CodeError {
+	o := defaultCodeErrorOptions(code)
+	o.apply(opts...)
+	return &CodeError{
+		code:       code,
+		msg:        msg,
+		reason:     o.reason,
+		rpcCode:    o.rpcCode,
+		httpStatus: o.httpStatus,
+	}
+}
+
+// FromHTTPError convert errcode.Error to unified error
+func FromHTTPError(e *Error) *CodeError {
+	if v, ok := codeErrors[e.Code()]; ok {
+		return v
+	}
+	return newCodeError(e.Code(), e.Msg())
+}
+
+// FromRPCStatus convert errcode.RPCStatus to unified error
+func FromRPCStatus(s *RPCStatus) *CodeError {
+	code := int(s.status.Code())
+	if v, ok := codeErrors[code]; ok {
+		return v
+	}
+	return newCodeError(code, s.status.Message())
+}
+
+// Error implement error interface, the format is compatible with ParseError
+func (e *CodeError) Error() string {
+	if e.cause == nil {
+		return fmt.Sprintf("code = %d, msg = %s", e.code, e.msg)
+	}
+	return fmt.Sprintf("code = %d, msg = %s, cause = %v", e.code, e.msg, e.cause)
+}
+
+// Err covert to standard error
+func (e *CodeError) Err() error {
+	return e
+}
+
+// Unwrap return the wrapped cause
+func (e *CodeError) Unwrap() error {
+	return e.cause
+}
+
+// Is errors with the same code are equal, target can be *CodeError,
+// or the error returned by Error.Err and RPCStatus.Err
+func (e *CodeError) Is(target error) bool {
+	switch t := target.(type) {
+	case *CodeError:
+		return e.code == t.code
+	case interface{ GRPCStatus() *status.Status }:
+		return e.code == FromStatus(t.GRPCStatus()).code
+	}
+	if he := ParseError(target); he.Code() != -1 {
+		return e.code == he.Code()
+	}
+	return false
+}
+
+// Code get error code
+func (e *CodeError) Code() int {
+	return e.code
+}
+
+// Msg get error message
+func (e *CodeError) Msg() string {
+	return e.msg
+}
+
+// Reason get the reason of ErrorInfo
+func (e *CodeError) Reason() string {
+	return e.reason
+}
+
+// RPCCode get grpc status code
+func (e *CodeError) RPCCode() codes.Code {
+	return e.rpcCode
+}
+
+// HTTPStatus get http status code
+func (e *CodeError) HTTPStatus() int {
+	return e.httpStatus
+}
+
+// Metadata get the metadata of ErrorInfo
+func (e *CodeError) Metadata() map[string]string {
+	return e.metadata
+}
+
+// FieldViolations get parameter error details
+func (e *CodeError) FieldViolations() []FieldViolation {
+	return e.violations
+}
+
+// Cause get the wrapped cause
+func (e *CodeError) Cause() error {
+	return e.cause
+}
+
+func (e *CodeError) clone() *CodeError {
+	newError := *e
+	if e.metadata != nil {
+		newError.metadata = make(map[string]string, len(e.metadata))
+		for k, v := range e.metadata {
+			newError.metadata[k] = v
+		}
+	}
+	newError.violations = append([]FieldViolation(nil), e.violations...)
+	return &newError
+}
+
+// WithMsg replace error message
+func (e *CodeError) WithMsg(msg string) *CodeError {
+	newError := e.clone()
+	newError.msg = msg
+	newError.customMsg = true
+	return newError
+}
+
+// WithMetadata add key-value to the metadata of ErrorInfo
+func (e *CodeError) WithMetadata(key string, val string) *CodeError {
+	newError := e.clone()
+	if newError.metadata == nil {
+		newError.metadata = map[string]string{}
+	}
+	newError.metadata[key] = val
+	return newError
+}
+
+// WithFieldViolation add parameter error detail
+func (e *CodeError) WithFieldViolation(field string, description string) *CodeError {
+	newError := e.clone()
+	newError.violations = append(newError.violations, FieldViolation{Field: field, Description: description})
+	return newError
+}
+
+// WithCause wrap the original error, the cause is not returned to the client
+func (e *CodeError) WithCause(err error) *CodeError {
+	newError := e.clone()
+	newError.cause = err
+	return newError
+}
+
+// GRPCStatus convert to grpc status with ErrorInfo and BadRequest details,
+// returning CodeError from grpc server handler directly is supported
+func (e *CodeError) GRPCStatus() *status.Status {
+	st := status.New(e.rpcCode, e.msg)
+	if e.rpcCode == codes.OK {
+		return st
+	}
+
+	metadata := map[string]string{metadataCodeKey: strconv.Itoa(e.code)}
+	for k, v := range e.metadata {
+		if k != metadataCodeKey {
+			metadata[k] = v
+		}
+	}
+	info := &errdetails.ErrorInfo{
+		Reason:   e.reason,
+		Domain:   ErrorDomain,
+		Metadata: metadata,
+	}
+
+	var stWithDetails *status.Status
+	var err error
+	if len(e.violations) == 0 {
+		stWithDetails, err = st.WithDetails(info)
+	} else {
+		br := &errdetails.BadRequest{}
+		for _, v := range e.violations {
+			br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       v.Field,
+				Description: v.Description,
+			})
+		}
+		stWithDetails, err = st.WithDetails(info, br)
+	}
+	if err != nil {
+		return st
+	}
+	return stWithDetails
+}
+
+// ToRPCErr convert to grpc error
+func (e *CodeError) ToRPCErr() error {
+	return e.GRPCStatus().Err()
+}
+
+// FromStatus rebuild unified error from grpc status, the code, reason, metadata and field violations
+// are read from the details, if there is no ErrorInfo, the grpc code is used as error code
+func FromStatus(st *status.Status) *CodeError {
+	e := &CodeError{
+		code:    int(st.Code()),
+		msg:     st.Message(),
+		rpcCode: st.Code(),
+	}
+
+	var hasInfo bool
+	for _, detail := range st.Details() {
+		switch d := detail.(type) {
+		case *errdetails.ErrorInfo:
+			code, err := strconv.Atoi(d.Metadata[metadataCodeKey])
+			if err != nil {
+				continue
+			}
+			hasInfo = true
+			e.code = code
+			e.reason = d.Reason
+			for k, v := range d.Metadata {
+				if k == metadataCodeKey {
+					continue
+				}
+				if e.metadata == nil {
+					e.metadata = map[string]string{}
+				}
+				e.metadata[k] = v
+			}
+		case *errdetails.BadRequest:
+			for _, v := range d.FieldViolations {
+				e.violations = append(e.violations, FieldViolation{Field: v.Field, Description: v.Description})
+			}
+		}
+	}
+
+	if !hasInfo {
+		e.reason = st.Code().String()
+		e.httpStatus = statusFromRPCCode(st.Code())
+	} else if v, ok := codeErrors[e.code]; ok {
+		e.httpStatus = v.httpStatus
+	} else {
+		e.httpStatus = getMapping(e.code).httpStatus
+	}
+	return e
+}
+
+// 没有ErrorInfo时根据grpc状态码转换为http状态码，兼容RPCStatus返回的自定义状态码
+func statusFromRPCCode(code codes.Code) int {
+	if m, ok := systemMappings[int(code)]; ok {
+		return m.httpStatus
+	}
+
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.Unknown, codes.Internal, codes.DataLoss:
+		return http.StatusInternalServerError
+	}
+	return http.StatusOK // 业务错误码
+}
+
+// FromHTTPResponse rebuild unified error from the http response body {"code": 0, "msg": ""},
+// return nil if the code is 0
+func FromHTTPResponse(httpStatus int, body []byte) (*CodeError, error) {
+	result := struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	}{}
+	err := json.Unmarshal(body, &result)
+	if err != nil {
+		return nil, fmt.Errorf("json.Unmarshal error: %v, body=%s", err, body)
+	}
+	if result.Code == 0 && httpStatus < http.StatusBadRequest {
+		return nil, nil
+	}
+
+	if v, ok := codeErrors[result.Code]; ok {
+		e := v.clone()
+		e.msg = result.Msg
+		e.httpStatus = httpStatus
+		return e, nil
+	}
+	e := newCodeError(result.Code, result.Msg)
+	e.httpStatus = httpStatus
+	return e, nil
+}
+
+// Convert convert any error to unified error, CodeError in the error chain is returned directly,
+// grpc status error is rebuilt from details, other errors are wrapped as InternalServerError
+func Convert(err error) *CodeError {
+	if err == nil {
+		return nil
+	}
+
+	var e *CodeError
+	if errors.As(err, &e) {
+		return e
+	}
+	if st, ok := status.FromError(err); ok {
+		return FromStatus(st)
+	}
+	return FromHTTPError(InternalServerError).WithCause(err)
+}
@@ -0,0 +1,145 @@
+package errcode
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errUserNotFound = NewCodeError(20201, "user not found",
+	WithReason("USER_NOT_FOUND"), WithRPCCode(codes.NotFound), WithHTTPStatus(http.StatusNotFound))
+
+func TestNewCodeError(t *testing.T) {
+	e := NewCodeError(20202, "invalid user name")
+	assert.Equal(t, 20202, e.Code())
+	assert.Equal(t, "CODE_20202", e.Reason())
+	assert.Equal(t, codes.Unknown, e.RPCCode())
+	assert.Equal(t, http.StatusOK, e.HTTPStatus())
+	assert.Equal(t, "code = 20202, msg = invalid user name", e.Error())
+
+	// 系统级错误码映射为标准状态码
+	e = FromHTTPError(InvalidParams)
+	assert.Equal(t, codes.InvalidArgument, e.RPCCode())
+	assert.Equal(t, http.StatusBadRequest, e.HTTPStatus())
+	e = FromRPCStatus(StatusNotFound)
+	assert.Equal(t, 30004, e.Code())
+	assert.Equal(t, codes.NotFound, e.RPCCode())
+	assert.Equal(t, http.StatusNotFound, e.HTTPStatus())
+
+	defer func() {
+		assert.NotNil(t, recover())
+	}()
+	NewCodeError(20202, "invalid user name")
+}
+
+func TestCodeErrorWrap(t *testing.T) {
+	cause := errors.New("record not found")
+	err := fmt.Errorf("get user: %w", errUserNotFound.WithCause(cause).WithMetadata("id", "1"))
+
+	assert.True(t, errors.Is(err, errUserNotFound))
+	assert.True(t, errors.Is(err, cause))
+	assert.False(t, errors.Is(err, FromHTTPError(NotFound)))
+
+	var e *CodeError
+	assert.True(t, errors.As(err, &e))
+	assert.Equal(t, cause, e.Cause())
+	assert.Equal(t, "1", e.Metadata()["id"])
+	assert.Nil(t, errUserNotFound.Metadata()) // 不影响原来的定义
+	assert.Contains(t, err.Error(), "cause = record not found")
+
+	assert.Equal(t, 20201, ParseError(err).Code())
+	assert.Equal(t, e, Convert(err))
+	assert.Nil(t, Convert(nil))
+	e = Convert(cause)
+	assert.Equal(t, InternalServerError.Code(), e.Code())
+	assert.True(t, errors.Is(e, cause))
+}
+
+func TestCodeErrorIs(t *testing.T) {
+	e := FromHTTPError(NotFound)
+	assert.True(t, errors.Is(e, NotFound.Err()))
+	assert.True(t, errors.Is(fmt.Errorf("wrap: %w", e), NotFound.Err()))
+	assert.False(t, errors.Is(e, InvalidParams.Err()))
+
+	e = FromRPCStatus(StatusNotFound)
+	assert.True(t, errors.Is(e, StatusNotFound.Err()))
+	assert.False(t, errors.Is(e, StatusInvalidParams.Err()))
+
+	// 经过grpc传输的错误
+	assert.True(t, errors.Is(errUserNotFound, status.FromProto(errUserNotFound.GRPCStatus().Proto()).Err()))
+	assert.False(t, errors.Is(errUserNotFound, errors.New("user not found")))
+}
+
+func TestNewCodeErrorConflict(t *testing.T) {
+	NewError(20203, "foo")
+	NewRPCStatus(20204, "bar")
+	defer func() {
+		delete(errCodes, 20203)
+		delete(statusCodes, 20204)
+	}()
+
+	assert.Panics(t, func() { NewCodeError(20203, "foo") })
+	assert.Panics(t, func() { NewCodeError(20204, "bar") })
+	_, ok := codeErrors[20203]
+	assert.False(t, ok)
+}
+
+func TestCodeErrorGRPC(t *testing.T) {
+	err := errUserNotFound.WithMsg("user 1 not found").
+		WithMetadata("id", "1").
+		WithFieldViolation("id", "must be greater than 0").
+		WithCause(errors.New("internal detail"))
+
+	st, ok := status.FromError(err)
+	assert.True(t, ok)
+	assert.Equal(t, codes.NotFound, st.Code())
+	assert.Equal(t, "user 1 not found", st.Message())
+	assert.Len(t, st.Details(), 2)
+
+	// 模拟经过网络传输后在客户端还原
+	clientErr := status.FromProto(st.Proto()).Err()
+	e := Convert(clientErr)
+	assert.Equal(t, 20201, e.Code())
+	assert.Equal(t, "USER_NOT_FOUND", e.Reason())
+	assert.Equal(t, "user 1 not found", e.Msg())
+	assert.Equal(t, http.StatusNotFound, e.HTTPStatus())
+	assert.Equal(t, map[string]string{"id": "1"}, e.Metadata())
+	assert.Equal(t, []FieldViolation{{Field: "id", Description: "must be greater than 0"}}, e.FieldViolations())
+	assert.Nil(t, e.Cause())
+	assert.True(t, errors.Is(e, errUserNotFound))
+
+	// 没有详情的grpc错误
+	e = Convert(status.Error(codes.Unavailable, "unavailable"))
+	assert.Equal(t, int(codes.Unavailable), e.Code())
+	assert.Equal(t, http.StatusServiceUnavailable, e.HTTPStatus())
+	e = Convert(StatusNotFound.Err())
+	assert.Equal(t, 30004, e.Code())
+	assert.Equal(t, http.StatusNotFound, e.HTTPStatus())
+
+	assert.Equal(t, codes.OK, FromHTTPError(Success).GRPCStatus().Code())
+	assert.Error(t, errUserNotFound.ToRPCErr())
+}
+
+func TestFromHTTPResponse(t *testing.T) {
+	e, err := FromHTTPResponse(http.StatusNotFound, []byte(`{"code":20201,"msg":"user 1 not found","data":{}}`))
+	assert.NoError(t, err)
+	assert.True(t, errors.Is(e, errUserNotFound))
+	assert.Equal(t, "USER_NOT_FOUND", e.Reason())
+	assert.Equal(t, "user 1 not found", e.Msg())
+
+	e, err = FromHTTPResponse(http.StatusOK, []byte(`{"code":0,"msg":"ok","data":{}}`))
+	assert.NoError(t, err)
+	assert.Nil(t, e)
+
+	e, err = FromHTTPResponse(http.StatusOK, []byte(`{"code":29999,"msg":"unknown"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, 29999, e.Code())
+
+	_, err = FromHTTPResponse(http.StatusOK, []byte(`not json`))
+	assert.Error(t, err)
+}
@@ -1,6 +1,9 @@
 package middleware
 
 import (
+	"errors"
+	"strings"
+
 	"github.com/zhufuyi/pkg/errcode"
 	"github.com/zhufuyi/pkg/gin/response"
 	"github.com/zhufuyi/pkg/jwt"
@@ -9,58 +12,210 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// Auth 鉴权
-func Auth() gin.HandlerFunc {
+// ClaimsKey 鉴权通过后claims在gin.Context中的key名
+const ClaimsKey = "claims"
+
+var errNoToken = errors.New("token not found")
+
+// TokenExtractor 从请求中获取token，没有时返回空字符串
+type TokenExtractor func(c *gin.Context) string
+
+// FromHeader get token from header, the scheme is the prefix of the value, e.g. FromHeader("Authorization", "Bearer"),
+// empty scheme means the value is the token
+func FromHeader(name string, scheme string) TokenExtractor {
+	return func(c *gin.Context) string {
+		value := c.GetHeader(name)
+		if scheme == "" {
+			return value
+		}
+		// scheme不区分大小写，例如Bearer和bearer
+		if len(value) > len(scheme) && strings.EqualFold(value[:len(scheme)], scheme) && value[len(scheme)] == ' ' {
+			return strings.TrimSpace(value[len(scheme)+1:])
+		}
+		return ""
+	}
+}
+
+// FromCookie get token from cookie
+func FromCookie(name string) TokenExtractor {
+	return func(c *gin.Context) string {
+		value, _ := c.Cookie(name)
+		return value
+	}
+}
+
+// FromQuery get token from query parameter
+func FromQuery(name string) TokenExtractor {
+	return func(c *gin.Context) string {
+		return c.Query(name)
+	}
+}
+
+// AuthOption set the jwt auth options.
+type AuthOption func(*authOptions)
+
+type authOptions struct {
+	extractors  []TokenExtractor
+	ignorePaths [][]string
+	verify      func(token string) (interface{}, error)
+}
+
+func (o *authOptions) apply(opts ...AuthOption) {
+	for _, opt := range opts {
+		opt(o)
+	}
+}
+
+func defaultAuthOptions() *authOptions {
+	return &authOptions{
+		extractors: []TokenExtractor{FromHeader("Authorization", "Bearer")},
+		verify: func(token string) (interface{}, error) {
+			return jwt.VerifyToken(token)
+		},
+	}
+}
+
+// WithTokenExtractors set where to get the token, tried in order until a token is found,
+// the default is FromHeader("Authorization", "Bearer")
+func WithTokenExtractors(extractors ...TokenExtractor) AuthOption {
+	return func(o *authOptions) {
+		if len(extractors) > 0 {
+			o.extractors = extractors
+		}
+	}
+}
+
+// WithIgnorePaths skip authentication of the paths, *matches a path segment, **matches the rest,
+// e.g. WithIgnorePaths("/api/v1/login", "/api/v1/public/**")
+func WithIgnorePaths(patterns ...string) AuthOption {
+	return func(o *authOptions) {
+		for _, p := range patterns {
+			o.ignorePaths = append(o.ignorePaths, splitPath(p))
+		}
+	}
+}
+
+// WithVerify set the function to verify token and decode claims, the default is jwt.VerifyToken,
+// the custom claims can be decoded by jwt.ParseToken
+func WithVerify(fn func(token string) (interface{}, error)) AuthOption {
+	return func(o *authOptions) {
+		if fn != nil {
+			o.verify = fn
+		}
+	}
+}
+
+func (o *authOptions) isIgnored(path string) bool {
+	if len(o.ignorePaths) == 0 {
+		return false
+	}
+	segments := splitPath(path)
+	for _, pattern := range o.ignorePaths {
+		if matchSegments(pattern, segments) {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *authOptions) extractToken(c *gin.Context) string {
+	for _, extract := range o.extractors {
+		if token := extract(c); token != "" {
+			return token
+		}
+	}
+	return ""
+}
+
+// 验证token，把claims保存到ctx，*jwt.CustomClaims或实现了GetUID、GetRoles的claims同时保存uid和roles
+func (o *authOptions) authenticate(c *gin.Context) (interface{}, error) {
+	token := o.extractToken(c)
+	if token == "" {
+		return nil, errNoToken
+	}
+	claims, err := o.verify(token)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Set(ClaimsKey, claims)
+	if v, ok := claims.(interface{ GetUID() string }); ok {
+		c.Set("uid", v.GetUID())
+	}
+	if v, ok := claims.(interface{ GetRoles() []string }); ok {
+		c.Set("roles", v.GetRoles())
+	}
+	return claims, nil
+}
+
+// GetClaims get the claims saved by Auth, return false if the claims is not *jwt.CustomClaims
+func GetClaims(c *gin.Context) (*jwt.CustomClaims, bool) {
+	v, ok := c.Get(ClaimsKey)
+	if !ok {
+		return nil, false
+	}
+	claims, ok := v.(*jwt.CustomClaims)
+	return claims, ok
+}
+
+// Auth 鉴权，默认从请求头Authorization获取Bearer token，鉴权通过后claims保存在ctx中，通过GetClaims或c.Get(ClaimsKey)获取
+func Auth(opts ...AuthOption) gin.HandlerFunc {
+	o := defaultAuthOptions()
+	o.apply(opts...)
+
 	return func(c *gin.Context) {
-		authorization := c.GetHeader("Authorization")
-		if len(authorization) < 20 {
-			logger.Warn("authorization is illegal", logger.String("authorization", authorization))
-			response.Error(c, errcode.Unauthorized)
-			c.Abort()
+		if o.isIgnored(c.Request.URL.Path) {
+			c.Next()
 			return
 		}
-		token := authorization[7:] // 去掉Bearer 前缀
-		claims, err := jwt.VerifyToken(token)
-		if err != nil {
-			logger.Warn("VerifyToken error", logger.Err(err))
+
+		if _, err := o.authenticate(c); err != nil {
+			logger.Warn("authenticate error", logger.Err(err), logger.String("path", c.Request.URL.Path))
 			response.Error(c, errcode.Unauthorized)
 			c.Abort()
 			return
 		}
-		c.Set("uid", claims.UID)
 
 		c.Next()
 	}
 }
 
 // AuthAdmin 管理员鉴权
-func AuthAdmin() gin.HandlerFunc {
+func AuthAdmin(opts ...AuthOption) gin.HandlerFunc {
+	o := defaultAuthOptions()
+	o.apply(opts...)
+
 	return func(c *gin.Context) {
-		authorization := c.GetHeader("Authorization")
-		if len(authorization) < 20 {
-			logger.Warn("authorization is illegal", logger.String("authorization", authorization))
-			response.Error(c, errcode.Unauthorized)
-			c.Abort()
+		if o.isIgnored(c.Request.URL.Path) {
+			c.Next()
 			return
 		}
-		token := authorization[7:] // 去掉Bearer 前缀
-		claims, err := jwt.VerifyToken(token)
-		if err != nil {
-			logger.Warn("VerifyToken error", logger.Err(err))
+
+		if _, err := o.authenticate(c); err != nil {
+			logger.Warn("authenticate error", logger.Err(err), logger.String("path", c.Request.URL.Path))
 			response.Error(c, errcode.Unauthorized)
 			c.Abort()
 			return
 		}
 
 		// 判断是否为管理员
-		if claims.Role != "admin" {
-			logger.Warn("prohibition of access", logger.String("uid", claims.UID), logger.String("role", claims.Role))
+		roles := c.GetStringSlice("roles")
+		if !hasRole(roles, "admin") {
+			logger.Warn("prohibition of access", logger.String("uid", c.GetString("uid")), logger.Any("roles", roles))
 			response.Error(c, errcode.Forbidden)
 			c.Abort()
 			return
 		}
-		c.Set("uid", claims.UID)
 
 		c.Next()
 	}
 }
+
+func hasRole(roles []string, role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
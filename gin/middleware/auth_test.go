@@ -1,18 +1,23 @@
 package middleware
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/zhufuyi/pkg/errcode"
 	"github.com/zhufuyi/pkg/gin/response"
 	"github.com/zhufuyi/pkg/gohttp"
 	"github.com/zhufuyi/pkg/jwt"
 	"github.com/zhufuyi/pkg/utils"
 
 	"github.com/gin-gonic/gin"
+	gojwt "github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
 )
 
 var (
@@ -167,3 +172,83 @@ func getAdmin(requestAddr string, authorization string) (string, error) {
 
 	return string(data), nil
 }
+
+type tenantClaims struct {
+	UID      string `json:"uid"`
+	TenantID string `json:"tenantID"`
+	gojwt.StandardClaims
+}
+
+func (c *tenantClaims) GetUID() string {
+	return c.UID
+}
+
+func TestAuthOptions(t *testing.T) {
+	jwt.Init()
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+
+	hello := func(c *gin.Context) {
+		claims, ok := GetClaims(c)
+		if ok {
+			response.Success(c, claims.UID)
+			return
+		}
+		response.Success(c, c.GetString("uid"))
+	}
+	g := r.Group("/api", Auth(
+		WithTokenExtractors(FromHeader("Authorization", "Bearer"), FromCookie("token"), FromQuery("token")),
+		WithIgnorePaths("/api/login", "/api/public/**"),
+	))
+	g.GET("/user", hello)
+	g.GET("/login", hello)
+	g.GET("/public/docs/1", hello)
+	r.GET("/admin", AuthAdmin(WithTokenExtractors(FromHeader("X-Token", ""))), hello)
+	r.GET("/tenant", Auth(WithVerify(func(token string) (interface{}, error) {
+		claims := &tenantClaims{}
+		return claims, jwt.ParseToken(token, claims)
+	})), func(c *gin.Context) {
+		claims := c.MustGet(ClaimsKey).(*tenantClaims)
+		response.Success(c, claims.TenantID+":"+c.GetString("uid"))
+	})
+
+	do := func(path string, setReq func(req *http.Request)) *response.Result {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if setReq != nil {
+			setReq(req)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		result := &response.Result{}
+		_ = json.Unmarshal(w.Body.Bytes(), result)
+		return result
+	}
+
+	token, _ := jwt.GenerateToken("100", "admin")
+	userToken, _ := jwt.GenerateToken("200")
+
+	result := do("/api/user", func(req *http.Request) { req.Header.Set("Authorization", "bearer "+token) })
+	assert.Equal(t, 0, result.Code)
+	assert.Equal(t, "100", result.Data)
+	result = do("/api/user", func(req *http.Request) { req.AddCookie(&http.Cookie{Name: "token", Value: token}) })
+	assert.Equal(t, "100", result.Data)
+	result = do("/api/user?token="+token, nil)
+	assert.Equal(t, "100", result.Data)
+
+	// scheme错误、没有token、token错误
+	assert.Equal(t, errcode.Unauthorized.Code(), do("/api/user", func(req *http.Request) { req.Header.Set("Authorization", "Basic "+token) }).Code)
+	assert.Equal(t, errcode.Unauthorized.Code(), do("/api/user", nil).Code)
+	assert.Equal(t, errcode.Unauthorized.Code(), do("/api/user?token=abc", nil).Code)
+
+	// 跳过鉴权
+	assert.Equal(t, 0, do("/api/login", nil).Code)
+	assert.Equal(t, 0, do("/api/public/docs/1", nil).Code)
+
+	assert.Equal(t, 0, do("/admin", func(req *http.Request) { req.Header.Set("X-Token", token) }).Code)
+	assert.Equal(t, errcode.Forbidden.Code(), do("/admin", func(req *http.Request) { req.Header.Set("X-Token", userToken) }).Code)
+	assert.Equal(t, errcode.Unauthorized.Code(), do("/admin", nil).Code)
+
+	tenantToken, _ := jwt.GenerateTokenWithClaims(&tenantClaims{UID: "300", TenantID: "t1"})
+	result = do("/tenant", func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+tenantToken) })
+	assert.Equal(t, "t1:300", result.Data)
+}
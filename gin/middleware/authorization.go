@@ -0,0 +1,375 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zhufuyi/pkg/errcode"
+	"github.com/zhufuyi/pkg/gin/response"
+	"github.com/zhufuyi/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EnforcerOption set the enforcer options.
+type EnforcerOption func(*enforcerOptions)
+
+type enforcerOptions struct {
+	reloadInterval time.Duration
+	loadTimeout    time.Duration
+}
+
+func (o *enforcerOptions) apply(opts ...EnforcerOption) {
+	for _, opt := range opts {
+		opt(o)
+	}
+}
+
+func defaultEnforcerOptions() *enforcerOptions {
+	return &enforcerOptions{
+		loadTimeout: time.Second * 10,
+	}
+}
+
+// WithReloadInterval reload policies periodically, the default is 0, no hot reload
+func WithReloadInterval(d time.Duration) EnforcerOption {
+	return func(o *enforcerOptions) {
+		o.reloadInterval = d
+	}
+}
+
+// WithLoadTimeout set the timeout of loading policies, the default is 10s
+func WithLoadTimeout(d time.Duration) EnforcerOption {
+	return func(o *enforcerOptions) {
+		if d > 0 {
+			o.loadTimeout = d
+		}
+	}
+}
+
+// AccessRequest 访问请求
+type AccessRequest struct {
+	UID        string
+	Roles      []string
+	Method     string
+	Path       string
+	Attributes map[string]string
+}
+
+type rule struct {
+	Policy
+	segments []string
+	methods  map[string]bool // nil表示所有方法
+	deny     bool
+}
+
+type ruleSet struct {
+	rules   []*rule
+	parents map[string][]string
+}
+
+// Enforcer 根据策略判断是否允许访问，默认拒绝，deny策略优先于allow策略
+type Enforcer struct {
+	loader PolicyLoader
+	opts   *enforcerOptions
+	rules  atomic.Value // *ruleSet
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewEnforcer create an enforcer and load policies, hot reload if WithReloadInterval is set
+func NewEnforcer(loader PolicyLoader, opts ...EnforcerOption) (*Enforcer, error) {
+	o := defaultEnforcerOptions()
+	o.apply(opts...)
+
+	e := &Enforcer{
+		loader: loader,
+		opts:   o,
+		stop:   make(chan struct{}),
+	}
+	if err := e.Reload(context.Background()); err != nil {
+		return nil, err
+	}
+
+	if o.reloadInterval > 0 {
+		go e.watch()
+	}
+	return e, nil
+}
+
+// Reload load and replace the policies, the old policies are kept if failed
+func (e *Enforcer) Reload(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, e.opts.loadTimeout)
+	defer cancel()
+
+	cfg, err := e.loader.Load(ctx)
+	if err != nil {
+		return err
+	}
+	rs, err := compilePolicies(cfg)
+	if err != nil {
+		return err
+	}
+	e.rules.Store(rs)
+	return nil
+}
+
+func (e *Enforcer) watch() {
+	ticker := time.NewTicker(e.opts.reloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := e.Reload(context.Background()); err != nil {
+				logger.Warn("reload policies error", logger.Err(err))
+			}
+		case <-e.stop:
+			return
+		}
+	}
+}
+
+// Close stop hot reload
+func (e *Enforcer) Close() {
+	e.stopOnce.Do(func() {
+		close(e.stop)
+	})
+}
+
+// Enforce whether the request is allowed
+func (e *Enforcer) Enforce(req *AccessRequest) bool {
+	rs := e.rules.Load().(*ruleSet)
+	roles := rs.expandRoles(req.Roles)
+	method := strings.ToUpper(req.Method)
+	segments := splitPath(req.Path)
+
+	allowed := false
+	for _, r := range rs.rules {
+		if !r.matchSubject(req.UID, roles) || !r.matchMethod(method) ||
+			!r.matchConditions(req.UID, req.Attributes) || !matchSegments(r.segments, segments) {
+			continue
+		}
+		if r.deny {
+			return false
+		}
+		allowed = true
+	}
+	return allowed
+}
+
+// Roles get all roles including the inherited roles, sorted by name
+func (e *Enforcer) Roles(roles ...string) []string {
+	rs := e.rules.Load().(*ruleSet)
+	var list []string
+	for r := range rs.expandRoles(roles) {
+		list = append(list, r)
+	}
+	sort.Strings(list)
+	return list
+}
+
+func compilePolicies(cfg *PolicyConfig) (*ruleSet, error) {
+	rs := &ruleSet{parents: cfg.Roles}
+	for i, p := range cfg.Policies {
+		if p.Subject == "" && p.Role == "" {
+			return nil, fmt.Errorf("policy %d: subject and role are both empty", i)
+		}
+		if p.Resource == "" {
+			return nil, fmt.Errorf("policy %d: resource is empty", i)
+		}
+		r := &rule{Policy: p, segments: splitPath(p.Resource)}
+		for _, seg := range r.segments {
+			if _, err := path.Match(seg, ""); err != nil {
+				return nil, fmt.Errorf("policy %d: invalid resource %s", i, p.Resource)
+			}
+		}
+		switch strings.ToLower(p.Effect) {
+		case "", EffectAllow:
+		case EffectDeny:
+			r.deny = true
+		default:
+			return nil, fmt.Errorf("policy %d: invalid effect %s", i, p.Effect)
+		}
+		for _, m := range p.Methods {
+			if m == "*" {
+				r.methods = nil
+				break
+			}
+			if r.methods == nil {
+				r.methods = map[string]bool{}
+			}
+			r.methods[strings.ToUpper(m)] = true
+		}
+		rs.rules = append(rs.rules, r)
+	}
+	return rs, nil
+}
+
+// 展开继承的角色，忽略循环继承
+func (rs *ruleSet) expandRoles(roles []string) map[string]bool {
+	set := map[string]bool{}
+	queue := append([]string{}, roles...)
+	for len(queue) > 0 {
+		role := queue[0]
+		queue = queue[1:]
+		if role == "" || set[role] {
+			continue
+		}
+		set[role] = true
+		queue = append(queue, rs.parents[role]...)
+	}
+	return set
+}
+
+func (r *rule) matchSubject(uid string, roles map[string]bool) bool {
+	if r.Subject != "" && r.Subject != "*" && r.Subject != uid {
+		return false
+	}
+	if r.Subject == "*" && uid == "" {
+		return false
+	}
+	if r.Role != "" && !roles[r.Role] {
+		return false
+	}
+	return true
+}
+
+func (r *rule) matchMethod(method string) bool {
+	return r.methods == nil || r.methods[method]
+}
+
+func (r *rule) matchConditions(uid string, attrs map[string]string) bool {
+	for k, v := range r.Conditions {
+		if v == "$uid" {
+			v = uid
+		}
+		if attrs[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func splitPath(p string) []string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
+
+// *匹配一段路径，**匹配剩余所有路径，:param等同于*
+func matchSegments(pattern []string, segments []string) bool {
+	for i, seg := range pattern {
+		if seg == "**" {
+			return true
+		}
+		if i >= len(segments) {
+			return false
+		}
+		if strings.HasPrefix(seg, ":") {
+			continue
+		}
+		if ok, _ := path.Match(seg, segments[i]); !ok {
+			return false
+		}
+	}
+	return len(pattern) == len(segments)
+}
+
+// ------------------------------------------------------------------------------------------
+
+// AuthorizeOption set the authorization middleware options.
+type AuthorizeOption func(*authorizeOptions)
+
+type authorizeOptions struct {
+	subjectFn   func(c *gin.Context) (uid string, roles []string, err error)
+	attributeFn func(c *gin.Context) map[string]string
+}
+
+func (o *authorizeOptions) apply(opts ...AuthorizeOption) {
+	for _, opt := range opts {
+		opt(o)
+	}
+}
+
+func defaultAuthorizeOptions() *authorizeOptions {
+	return &authorizeOptions{
+		subjectFn: defaultSubject,
+	}
+}
+
+// WithSubjectFunc set the function to get the user id and roles of the request,
+// the default is to get from the context set by Auth, or verify the token in the Authorization header
+func WithSubjectFunc(fn func(c *gin.Context) (uid string, roles []string, err error)) AuthorizeOption {
+	return func(o *authorizeOptions) {
+		if fn != nil {
+			o.subjectFn = fn
+		}
+	}
+}
+
+// WithAttributeFunc set the function to get the attributes of the request, used to match the policy conditions
+func WithAttributeFunc(fn func(c *gin.Context) map[string]string) AuthorizeOption {
+	return func(o *authorizeOptions) {
+		o.attributeFn = fn
+	}
+}
+
+var defaultAuth = defaultAuthOptions()
+
+func defaultSubject(c *gin.Context) (string, []string, error) {
+	if _, ok := c.Get(ClaimsKey); !ok {
+		if _, err := defaultAuth.authenticate(c); err != nil {
+			return "", nil, err
+		}
+	}
+	return c.GetString("uid"), c.GetStringSlice("roles"), nil
+}
+
+// Authorize 根据策略鉴权，用户没有权限时返回errcode.Forbidden
+func Authorize(e *Enforcer, opts ...AuthorizeOption) gin.HandlerFunc {
+	o := defaultAuthorizeOptions()
+	o.apply(opts...)
+
+	return func(c *gin.Context) {
+		uid, roles, err := o.subjectFn(c)
+		if err != nil {
+			logger.Warn("get subject error", logger.Err(err))
+			response.Error(c, errcode.Unauthorized)
+			c.Abort()
+			return
+		}
+
+		req := &AccessRequest{
+			UID:    uid,
+			Roles:  roles,
+			Method: c.Request.Method,
+			Path:   c.Request.URL.Path,
+		}
+		if o.attributeFn != nil {
+			req.Attributes = o.attributeFn(c)
+		}
+
+		if !e.Enforce(req) {
+			logger.Warn("authorization denied",
+				logger.String("uid", uid),
+				logger.Any("roles", roles),
+				logger.String("method", req.Method),
+				logger.String("path", req.Path),
+			)
+			response.Error(c, errcode.Forbidden)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
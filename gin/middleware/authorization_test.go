@@ -0,0 +1,178 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zhufuyi/pkg/errcode"
+	"github.com/zhufuyi/pkg/gin/response"
+	"github.com/zhufuyi/pkg/jwt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type staticLoader struct {
+	cfg *PolicyConfig
+	err error
+}
+
+func (l *staticLoader) Load(_ context.Context) (*PolicyConfig, error) {
+	return l.cfg, l.err
+}
+
+var testPolicies = &PolicyConfig{
+	Policies: []Policy{
+		{Role: "viewer", Resource: "/api/v1/**", Methods: []string{"GET"}},
+		{Role: "editor", Resource: "/api/v1/articles/:id", Methods: []string{"put", "DELETE"}},
+		{Role: "admin", Resource: "/admin/**", Methods: []string{"*"}},
+		{Subject: "100", Resource: "/api/v1/articles/*", Methods: []string{"DELETE"}, Effect: EffectDeny},
+		{Subject: "*", Resource: "/api/v1/users/*/profile", Methods: []string{"PUT"}, Conditions: map[string]string{"owner": "$uid"}},
+	},
+	Roles: map[string][]string{
+		"editor": {"viewer"},
+		"admin":  {"editor"},
+	},
+}
+
+func TestEnforcer(t *testing.T) {
+	e, err := NewEnforcer(&staticLoader{cfg: testPolicies})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	tests := []struct {
+		name string
+		req  *AccessRequest
+		want bool
+	}{
+		{"viewer get", &AccessRequest{UID: "1", Roles: []string{"viewer"}, Method: "GET", Path: "/api/v1/articles/1"}, true},
+		{"viewer put", &AccessRequest{UID: "1", Roles: []string{"viewer"}, Method: "PUT", Path: "/api/v1/articles/1"}, false},
+		{"editor put", &AccessRequest{UID: "1", Roles: []string{"editor"}, Method: "PUT", Path: "/api/v1/articles/1"}, true},
+		{"editor inherit get", &AccessRequest{UID: "1", Roles: []string{"editor"}, Method: "GET", Path: "/api/v1/users"}, true},
+		{"editor put other", &AccessRequest{UID: "1", Roles: []string{"editor"}, Method: "PUT", Path: "/api/v1/articles/1/comments"}, false},
+		{"editor admin", &AccessRequest{UID: "1", Roles: []string{"editor"}, Method: "GET", Path: "/admin/users"}, false},
+		{"admin", &AccessRequest{UID: "1", Roles: []string{"admin"}, Method: "POST", Path: "/admin/users"}, true},
+		{"multiple roles", &AccessRequest{UID: "1", Roles: []string{"guest", "editor"}, Method: "DELETE", Path: "/api/v1/articles/1"}, true},
+		{"deny", &AccessRequest{UID: "100", Roles: []string{"admin"}, Method: "DELETE", Path: "/api/v1/articles/1"}, false},
+		{"no role", &AccessRequest{UID: "1", Method: "GET", Path: "/api/v1/articles"}, false},
+		{"owner", &AccessRequest{UID: "1", Method: "PUT", Path: "/api/v1/users/1/profile", Attributes: map[string]string{"owner": "1"}}, true},
+		{"not owner", &AccessRequest{UID: "1", Method: "PUT", Path: "/api/v1/users/2/profile", Attributes: map[string]string{"owner": "2"}}, false},
+		{"anonymous", &AccessRequest{Method: "PUT", Path: "/api/v1/users/1/profile", Attributes: map[string]string{"owner": ""}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, e.Enforce(tt.req))
+		})
+	}
+
+	assert.Equal(t, []string{"admin", "editor", "viewer"}, e.Roles("admin"))
+}
+
+func TestEnforcerRoleCycle(t *testing.T) {
+	e, err := NewEnforcer(&staticLoader{cfg: &PolicyConfig{
+		Policies: testPolicies.Policies,
+		Roles:    map[string][]string{"editor": {"viewer"}, "admin": {"editor"}, "viewer": {"admin"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"admin", "editor", "viewer"}, e.Roles("viewer"))
+	assert.True(t, e.Enforce(&AccessRequest{UID: "1", Roles: []string{"viewer"}, Method: "GET", Path: "/admin"}))
+}
+
+func TestNewEnforcerError(t *testing.T) {
+	_, err := NewEnforcer(&staticLoader{err: errors.New("load error")})
+	assert.Error(t, err)
+
+	invalid := []Policy{
+		{Resource: "/api"},
+		{Role: "admin"},
+		{Role: "admin", Resource: "/api/[", Methods: []string{"GET"}},
+		{Role: "admin", Resource: "/api", Effect: "unknown"},
+	}
+	for _, p := range invalid {
+		_, err = NewEnforcer(&staticLoader{cfg: &PolicyConfig{Policies: []Policy{p}}})
+		assert.Error(t, err)
+	}
+}
+
+func TestEnforcerHotReload(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "policy.yaml")
+	// 先写临时文件再重命名，避免加载到写了一半的文件
+	writeFile := func(content string) {
+		tmp := filepath.Join(dir, "policy.tmp")
+		_ = os.WriteFile(tmp, []byte(content), 0666)
+		_ = os.Rename(tmp, file)
+	}
+	writeFile("policies:\n  - role: viewer\n    resource: /api/**\n    methods: [GET]\n")
+
+	e, err := NewEnforcer(NewFilePolicyLoader(file), WithReloadInterval(time.Millisecond*50), WithLoadTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	req := &AccessRequest{UID: "1", Roles: []string{"viewer"}, Method: "POST", Path: "/api/articles"}
+	assert.False(t, e.Enforce(req))
+
+	writeFile("policies:\n  - role: viewer\n    resource: /api/**\n    methods: [GET, POST]\n")
+	time.Sleep(time.Millisecond * 200)
+	assert.True(t, e.Enforce(req))
+
+	// 加载失败时保留原来的策略
+	writeFile("policies: {")
+	time.Sleep(time.Millisecond * 200)
+	assert.True(t, e.Enforce(req))
+}
+
+func TestAuthorize(t *testing.T) {
+	jwt.Init()
+	e, err := NewEnforcer(&staticLoader{cfg: testPolicies})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	hello := func(c *gin.Context) { response.Success(c, "hello "+c.GetString("uid")) }
+	r.GET("/api/v1/articles/:id", Authorize(e), hello)
+	r.PUT("/api/v1/articles/:id", Auth(), Authorize(e), hello)
+	r.PUT("/api/v1/users/:id/profile", Authorize(e, WithAttributeFunc(func(c *gin.Context) map[string]string {
+		return map[string]string{"owner": c.Param("id")}
+	})), hello)
+	r.GET("/admin/users", Authorize(e, WithSubjectFunc(func(c *gin.Context) (string, []string, error) {
+		return c.GetHeader("X-Uid"), []string{c.GetHeader("X-Role")}, nil
+	})), hello)
+
+	do := func(method string, path string, header map[string]string) int {
+		req := httptest.NewRequest(method, path, nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		result := &response.Result{}
+		_ = json.Unmarshal(w.Body.Bytes(), result)
+		return result.Code
+	}
+
+	viewer, _ := jwt.GenerateToken("1", "viewer")
+	editor, _ := jwt.GenerateToken("2", "guest", "editor")
+	assert.Equal(t, 0, do("GET", "/api/v1/articles/1", map[string]string{"Authorization": "Bearer " + viewer}))
+	assert.Equal(t, errcode.Forbidden.Code(), do("PUT", "/api/v1/articles/1", map[string]string{"Authorization": "Bearer " + viewer}))
+	assert.Equal(t, 0, do("PUT", "/api/v1/articles/1", map[string]string{"Authorization": "Bearer " + editor}))
+	assert.Equal(t, errcode.Unauthorized.Code(), do("GET", "/api/v1/articles/1", nil))
+	assert.Equal(t, errcode.Unauthorized.Code(), do("GET", "/api/v1/articles/1", map[string]string{"Authorization": "Bearer xxx.xxx.xxx"}))
+	assert.Equal(t, 0, do("PUT", "/api/v1/users/1/profile", map[string]string{"Authorization": "Bearer " + viewer}))
+	assert.Equal(t, errcode.Forbidden.Code(), do("PUT", "/api/v1/users/2/profile", map[string]string{"Authorization": "Bearer " + viewer}))
+	assert.Equal(t, 0, do("GET", "/admin/users", map[string]string{"X-Uid": "3", "X-Role": "admin"}))
+	assert.Equal(t, errcode.Forbidden.Code(), do("GET", "/admin/users", map[string]string{"X-Uid": "3", "X-Role": "editor"}))
+}
@@ -0,0 +1,515 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/zhufuyi/pkg/cache"
+	"github.com/zhufuyi/pkg/gin/response"
+	"github.com/zhufuyi/pkg/goredis"
+	"github.com/zhufuyi/pkg/krand"
+	"github.com/zhufuyi/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// DefaultIdempotencyHeader 幂等键的请求头
+	DefaultIdempotencyHeader = "Idempotency-Key"
+	// IdempotencyReplayedHeader 重放保存的响应时添加的响应头
+	IdempotencyReplayedHeader = "Idempotent-Replayed"
+	// DefaultIdempotencyMaxBodySize 计算请求指纹时读取的请求body的默认最大长度，超过时返回413
+	DefaultIdempotencyMaxBodySize int64 = 1 << 20
+)
+
+// IdempotencyOption set the idempotency options.
+type IdempotencyOption func(*idempotencyOptions)
+
+type idempotencyOptions struct {
+	header      string
+	methods     map[string]bool
+	ttl         time.Duration
+	lockTTL     time.Duration
+	waitTimeout time.Duration
+	required    bool
+	scopeFn     func(c *gin.Context) string
+	locker      *goredis.Locker
+	maxBodySize int64
+}
+
+func (o *idempotencyOptions) apply(opts ...IdempotencyOption) {
+	for _, opt := range opts {
+		opt(o)
+	}
+}
+
+func defaultIdempotencyOptions() *idempotencyOptions {
+	return &idempotencyOptions{
+		header:      DefaultIdempotencyHeader,
+		methods:     map[string]bool{http.MethodPost: true},
+		ttl:         time.Hour * 24,
+		lockTTL:     time.Second * 30,
+		scopeFn:     defaultIdempotencyScope,
+		maxBodySize: DefaultIdempotencyMaxBodySize,
+	}
+}
+
+// 默认作用域是Auth设置的uid，没有经过Auth认证时是客户端ip，避免所有匿名客户端共用一个key空间
+func defaultIdempotencyScope(c *gin.Context) string {
+	if uid := c.GetString("uid"); uid != "" {
+		return "uid:" + uid
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// WithIdempotencyHeader set the header name of the idempotency key, the default is Idempotency-Key
+func WithIdempotencyHeader(name string) IdempotencyOption {
+	return func(o *idempotencyOptions) {
+		if name != "" {
+			o.header = name
+		}
+	}
+}
+
+// WithIdempotencyMethods set the http methods which need idempotency, the default is POST
+func WithIdempotencyMethods(methods ...string) IdempotencyOption {
+	return func(o *idempotencyOptions) {
+		if len(methods) == 0 {
+			return
+		}
+		o.methods = map[string]bool{}
+		for _, m := range methods {
+			o.methods[m] = true
+		}
+	}
+}
+
+// WithIdempotencyTTL set how long the response is saved, the default is 24h
+func WithIdempotencyTTL(d time.Duration) IdempotencyOption {
+	return func(o *idempotencyOptions) {
+		if d > 0 {
+			o.ttl = d
+		}
+	}
+}
+
+// WithIdempotencyLockTTL set the max processing time of a request, the in-flight mark expires after it, the default is 30s
+func WithIdempotencyLockTTL(d time.Duration) IdempotencyOption {
+	return func(o *idempotencyOptions) {
+		if d > 0 {
+			o.lockTTL = d
+		}
+	}
+}
+
+// WithIdempotencyWait wait for the in-flight request with the same key to complete and replay its response,
+// return 409 if timeout, the default is return 409 immediately
+func WithIdempotencyWait(timeout time.Duration) IdempotencyOption {
+	return func(o *idempotencyOptions) {
+		o.waitTimeout = timeout
+	}
+}
+
+// WithIdempotencyRequired return 400 if the request has no idempotency key, the default is to skip
+func WithIdempotencyRequired() IdempotencyOption {
+	return func(o *idempotencyOptions) {
+		o.required = true
+	}
+}
+
+// WithIdempotencyScope set the scope of the idempotency key, different scopes do not affect each other,
+// the default is the user id set by Auth (Idempotency must be used after Auth), or the client ip if there is no user id,
+// the clients behind the same ip share the keys without Auth, set a scope such as the tenant or device id in this case
+func WithIdempotencyScope(fn func(c *gin.Context) string) IdempotencyOption {
+	return func(o *idempotencyOptions) {
+		if fn != nil {
+			o.scopeFn = fn
+		}
+	}
+}
+
+// WithIdempotencyLocker use a distributed lock to check and mark the key atomically across replicas,
+// it is only needed if the store does not implement cache.SetNXCache, the in-flight mark is set by SetNX by default,
+// otherwise the default is a local lock, which is enough for a single instance
+func WithIdempotencyLocker(locker *goredis.Locker) IdempotencyOption {
+	return func(o *idempotencyOptions) {
+		o.locker = locker
+	}
+}
+
+// WithIdempotencyMaxBodySize set the max size of the request body which is read to compute the request fingerprint,
+// return 413 if the body is larger, the default is 1MB
+func WithIdempotencyMaxBodySize(size int64) IdempotencyOption {
+	return func(o *idempotencyOptions) {
+		if size > 0 {
+			o.maxBodySize = size
+		}
+	}
+}
+
+// IdempotencyRecord 保存的响应，Completed为false表示请求正在处理中，Token标识标记处理中的请求
+type IdempotencyRecord struct {
+	Fingerprint string              `json:"fingerprint"`
+	Token       string              `json:"token,omitempty"`
+	Completed   bool                `json:"completed"`
+	Status      int                 `json:"status"`
+	Header      map[string][]string `json:"header"`
+	Body        []byte              `json:"body"`
+}
+
+type idempotencyWriter struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (w *idempotencyWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *idempotencyWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+var (
+	errIdempotencyBusy     = errors.New("a request with the same idempotency key is in progress")
+	errIdempotencyMarkLost = errors.New("the in-flight mark is taken by another request")
+)
+
+// 每个请求都不同的响应头，不保存也不重放
+var idempotencySkipHeaders = map[string]bool{
+	HeaderXRequestIDKey: true,
+	"Set-Cookie":        true,
+	"Date":              true,
+}
+
+// 本地锁，按key分段
+type stripedLock [64]sync.Mutex
+
+func (l *stripedLock) get(key string) *sync.Mutex {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return &l[h.Sum32()%uint32(len(l))]
+}
+
+type idempotency struct {
+	store   cache.Cache
+	nxStore cache.SetNXCache // 不为nil时使用SetNX原子地标记处理中
+	opts    *idempotencyOptions
+	local   stripedLock
+}
+
+// Idempotency save the first response (status, headers, body) of the request with Idempotency-Key header,
+// later requests with the same key and the same request replay the saved response,
+// return 409 if a request with the same key is in progress, 422 if the key is reused with a different request,
+// the response of 5xx is not saved so that the client can retry.
+//
+// The key is scoped by the user id set by Auth or the client ip, see WithIdempotencyScope.
+// If the store implements cache.SetNXCache (redis, memory and two-level caches), the in-flight mark is set atomically by SetNX,
+// which is safe across replicas, otherwise use WithIdempotencyLocker for multiple replicas.
+func Idempotency(store cache.Cache, opts ...IdempotencyOption) gin.HandlerFunc {
+	o := defaultIdempotencyOptions()
+	o.apply(opts...)
+	idem := &idempotency{store: store, opts: o}
+	idem.nxStore, _ = store.(cache.SetNXCache)
+	if idem.nxStore == nil && o.locker == nil {
+		logger.Warn("idempotency store does not implement cache.SetNXCache and no locker is set, " +
+			"the in-flight mark is only atomic in the current process")
+	}
+
+	return func(c *gin.Context) {
+		if !o.methods[c.Request.Method] {
+			c.Next()
+			return
+		}
+		key := c.GetHeader(o.header)
+		if key == "" {
+			if o.required {
+				response.Output(c, http.StatusBadRequest, o.header+" header is required")
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, o.maxBodySize+1))
+		if err != nil {
+			response.Output(c, http.StatusBadRequest, err.Error())
+			c.Abort()
+			return
+		}
+		if int64(len(body)) > o.maxBodySize {
+			response.Output(c, http.StatusRequestEntityTooLarge)
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		cacheKey := "idempotency:" + o.scopeFn(c) + ":" + key
+		fingerprint := requestFingerprint(c.Request, body)
+		ctx := c.Request.Context()
+
+		mark := &IdempotencyRecord{Fingerprint: fingerprint, Token: krand.String(krand.R_All, 16)}
+		rec, err := idem.begin(ctx, cacheKey, mark)
+		if errors.Is(err, errIdempotencyBusy) && o.waitTimeout > 0 {
+			rec, err = idem.wait(ctx, cacheKey, mark)
+		}
+		if err != nil {
+			if errors.Is(err, errIdempotencyBusy) {
+				response.Output(c, http.StatusConflict, err.Error())
+			} else {
+				logger.Warn("idempotency error", logger.Err(err), logger.String("key", cacheKey))
+				response.Output(c, http.StatusServiceUnavailable)
+			}
+			c.Abort()
+			return
+		}
+
+		if rec != nil {
+			if rec.Fingerprint != fingerprint {
+				response.Output(c, http.StatusUnprocessableEntity, o.header+" is reused with a different request")
+				c.Abort()
+				return
+			}
+			replay(c, rec)
+			return
+		}
+
+		// 只保存后面的handler设置的响应头，前面的中间件设置的响应头重放时由当前请求重新设置
+		upstream := c.Writer.Header().Clone()
+		w := &idempotencyWriter{ResponseWriter: c.Writer, body: &bytes.Buffer{}}
+		c.Writer = w
+		defer func() {
+			// 请求失败或panic时删除处理中的标记，客户端可以重试
+			if p := recover(); p != nil {
+				idem.release(cacheKey, mark)
+				panic(p)
+			}
+			idem.finish(cacheKey, mark, upstream, w)
+		}()
+
+		c.Next()
+	}
+}
+
+// 检查key并标记为处理中，返回保存的记录，记录为nil时表示可以处理请求
+func (idem *idempotency) begin(ctx context.Context, cacheKey string, mark *IdempotencyRecord) (*IdempotencyRecord, error) {
+	if idem.nxStore != nil {
+		return idem.beginNX(ctx, cacheKey, mark)
+	}
+
+	unlock, err := idem.lock(ctx, cacheKey)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	rec, err := idem.get(ctx, cacheKey, mark.Fingerprint)
+	if rec != nil || !errors.Is(err, cache.CacheNotFound) {
+		return rec, err
+	}
+
+	err = idem.store.Set(ctx, cacheKey, mark, idem.opts.lockTTL)
+	return nil, err
+}
+
+// 加本地锁，设置了分布式锁时再加分布式锁，store不支持SetNX时检查和写入key需要加锁
+func (idem *idempotency) lock(ctx context.Context, cacheKey string) (func(), error) {
+	mu := idem.local.get(cacheKey)
+	mu.Lock()
+	if idem.opts.locker == nil {
+		return mu.Unlock, nil
+	}
+
+	lock, err := idem.opts.locker.TryLock(ctx, cacheKey+":lock")
+	if err != nil {
+		mu.Unlock()
+		if errors.Is(err, goredis.ErrLockNotObtained) {
+			return nil, errIdempotencyBusy
+		}
+		return nil, err
+	}
+	return func() {
+		_ = lock.Unlock(context.Background())
+		mu.Unlock()
+	}, nil
+}
+
+// 使用SetNX标记为处理中，多个实例之间也是原子的
+func (idem *idempotency) beginNX(ctx context.Context, cacheKey string, mark *IdempotencyRecord) (*IdempotencyRecord, error) {
+	for i := 0; i < 3; i++ {
+		ok, err := idem.nxStore.SetNX(ctx, cacheKey, mark, idem.opts.lockTTL)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return nil, nil
+		}
+
+		rec, err := idem.get(ctx, cacheKey, mark.Fingerprint)
+		if rec != nil || !errors.Is(err, cache.CacheNotFound) {
+			return rec, err
+		}
+		// 处理中的标记刚好过期或被删除，重新标记
+	}
+	return nil, errIdempotencyBusy
+}
+
+// 读取保存的记录，相同请求正在处理中时返回errIdempotencyBusy
+func (idem *idempotency) get(ctx context.Context, cacheKey string, fingerprint string) (*IdempotencyRecord, error) {
+	rec := &IdempotencyRecord{}
+	err := idem.store.Get(ctx, cacheKey, rec)
+	if err != nil {
+		return nil, err
+	}
+	if !rec.Completed && rec.Fingerprint == fingerprint {
+		return nil, errIdempotencyBusy
+	}
+	return rec, nil
+}
+
+// 等待处理中的请求完成
+func (idem *idempotency) wait(ctx context.Context, cacheKey string, mark *IdempotencyRecord) (*IdempotencyRecord, error) {
+	ctx, cancel := context.WithTimeout(ctx, idem.opts.waitTimeout)
+	defer cancel()
+	ticker := time.NewTicker(time.Millisecond * 50)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, errIdempotencyBusy
+		case <-ticker.C:
+			rec, err := idem.begin(ctx, cacheKey, mark)
+			if !errors.Is(err, errIdempotencyBusy) {
+				return rec, err
+			}
+		}
+	}
+}
+
+// 保存响应，处理中的标记已经过期并被其他请求重新标记时不保存
+func (idem *idempotency) finish(cacheKey string, mark *IdempotencyRecord, upstream http.Header, w *idempotencyWriter) {
+	if w.Status() >= http.StatusInternalServerError {
+		idem.release(cacheKey, mark)
+		return
+	}
+
+	rec := &IdempotencyRecord{
+		Fingerprint: mark.Fingerprint,
+		Completed:   true,
+		Status:      w.Status(),
+		Header:      downstreamHeader(upstream, w.Header()),
+		Body:        w.body.Bytes(),
+	}
+	ok, err := idem.compareAndSet(cacheKey, mark, rec, idem.opts.ttl)
+	if err != nil {
+		logger.Warn("save idempotency response error", logger.Err(err), logger.String("key", cacheKey))
+		return
+	}
+	if !ok {
+		logger.Warn("idempotency in-flight mark is expired, the response is not saved", logger.String("key", cacheKey))
+	}
+}
+
+// 删除处理中的标记，客户端可以重试，标记已经不是当前请求的时不删除
+func (idem *idempotency) release(cacheKey string, mark *IdempotencyRecord) {
+	ctx := context.Background()
+	var err error
+	if idem.nxStore != nil {
+		_, err = idem.nxStore.CompareAndDelete(ctx, cacheKey, mark)
+	} else {
+		err = idem.withMark(ctx, cacheKey, mark, func() error { return idem.store.Del(ctx, cacheKey) })
+	}
+	if err != nil && !errors.Is(err, errIdempotencyMarkLost) {
+		logger.Warn("delete idempotency key error", logger.Err(err), logger.String("key", cacheKey))
+	}
+}
+
+// 缓存中仍然是当前请求的标记时才写入
+func (idem *idempotency) compareAndSet(cacheKey string, mark *IdempotencyRecord, rec *IdempotencyRecord, ttl time.Duration) (bool, error) {
+	ctx := context.Background()
+	if idem.nxStore != nil {
+		return idem.nxStore.CompareAndSet(ctx, cacheKey, mark, rec, ttl)
+	}
+
+	err := idem.withMark(ctx, cacheKey, mark, func() error { return idem.store.Set(ctx, cacheKey, rec, ttl) })
+	if errors.Is(err, errIdempotencyMarkLost) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// store不支持SetNX时，加锁检查缓存中仍然是当前请求的标记后执行fn
+func (idem *idempotency) withMark(ctx context.Context, cacheKey string, mark *IdempotencyRecord, fn func() error) error {
+	unlock, err := idem.lock(ctx, cacheKey)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	current := &IdempotencyRecord{}
+	err = idem.store.Get(ctx, cacheKey, current)
+	if err != nil {
+		if errors.Is(err, cache.CacheNotFound) {
+			return errIdempotencyMarkLost
+		}
+		return err
+	}
+	if current.Completed || current.Token != mark.Token {
+		return errIdempotencyMarkLost
+	}
+	return fn()
+}
+
+// 后面的handler新增或修改的响应头
+func downstreamHeader(upstream http.Header, header http.Header) http.Header {
+	h := http.Header{}
+	for k, values := range header {
+		if idempotencySkipHeaders[k] || equalValues(upstream[k], values) {
+			continue
+		}
+		h[k] = values
+	}
+	return h
+}
+
+func equalValues(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func replay(c *gin.Context, rec *IdempotencyRecord) {
+	for k, values := range rec.Header {
+		c.Writer.Header()[k] = values
+	}
+	c.Header(IdempotencyReplayedHeader, "true")
+	c.Status(rec.Status)
+	_, _ = c.Writer.Write(rec.Body)
+	c.Abort()
+}
+
+// 请求的指纹，包括方法、路径、查询参数和body
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.Path + "?" + r.URL.RawQuery + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
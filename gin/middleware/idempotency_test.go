@@ -0,0 +1,265 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zhufuyi/pkg/cache"
+	"github.com/zhufuyi/pkg/gin/response"
+	"github.com/zhufuyi/pkg/goredis"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newIdempotencyRouter(store cache.Cache, opts ...IdempotencyOption) (*gin.Engine, *int32) {
+	var count int32
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(Idempotency(store, opts...))
+	r.POST("/orders", func(c *gin.Context) {
+		n := atomic.AddInt32(&count, 1)
+		if c.Query("slow") != "" {
+			time.Sleep(time.Millisecond * 300)
+		}
+		c.Header("X-Order-Seq", string(rune('0'+n)))
+		c.JSON(http.StatusCreated, gin.H{"seq": n})
+	})
+	r.POST("/fail", func(c *gin.Context) {
+		atomic.AddInt32(&count, 1)
+		response.Output(c, http.StatusInternalServerError)
+	})
+	r.GET("/orders", func(c *gin.Context) {
+		atomic.AddInt32(&count, 1)
+		c.String(http.StatusOK, "list")
+	})
+	return r, &count
+}
+
+func idempotencyKey(key string) map[string]string {
+	return map[string]string{DefaultIdempotencyHeader: key}
+}
+
+func TestIdempotency(t *testing.T) {
+	store, _, s := newTestRedisCache(t)
+	r, count := newIdempotencyRouter(store)
+
+	w := doTestRequest(r, http.MethodPost, "/orders", idempotencyKey("key1"), `{"amount":100}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, `{"seq":1}`, w.Body.String())
+	assert.Empty(t, w.Header().Get(IdempotencyReplayedHeader))
+
+	// 重放保存的响应
+	w = doTestRequest(r, http.MethodPost, "/orders", idempotencyKey("key1"), `{"amount":100}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, `{"seq":1}`, w.Body.String())
+	assert.Equal(t, "1", w.Header().Get("X-Order-Seq"))
+	assert.Equal(t, "true", w.Header().Get(IdempotencyReplayedHeader))
+	assert.Equal(t, int32(1), atomic.LoadInt32(count))
+
+	// 相同的key不同的请求
+	w = doTestRequest(r, http.MethodPost, "/orders", idempotencyKey("key1"), `{"amount":200}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	// 不同的key、没有key、不需要幂等的方法
+	assert.Equal(t, `{"seq":2}`, doTestRequest(r, http.MethodPost, "/orders", idempotencyKey("key2"), `{"amount":100}`).Body.String())
+	assert.Equal(t, `{"seq":3}`, doTestRequest(r, http.MethodPost, "/orders", idempotencyKey(""), `{"amount":100}`).Body.String())
+	doTestRequest(r, http.MethodGet, "/orders", idempotencyKey("key3"), "")
+	doTestRequest(r, http.MethodGet, "/orders", idempotencyKey("key3"), "")
+	assert.Equal(t, int32(5), atomic.LoadInt32(count))
+
+	// 5xx不保存，可以重试
+	assert.Equal(t, http.StatusInternalServerError, doTestRequest(r, http.MethodPost, "/fail", idempotencyKey("key4"), "").Code)
+	assert.Equal(t, http.StatusInternalServerError, doTestRequest(r, http.MethodPost, "/fail", idempotencyKey("key4"), "").Code)
+	assert.Equal(t, int32(7), atomic.LoadInt32(count))
+
+	// 过期后重新处理
+	s.FastForward(time.Hour * 25)
+	assert.Equal(t, `{"seq":8}`, doTestRequest(r, http.MethodPost, "/orders", idempotencyKey("key1"), `{"amount":200}`).Body.String())
+
+	// 缓存不可用
+	s.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, doTestRequest(r, http.MethodPost, "/orders", idempotencyKey("key5"), "").Code)
+}
+
+func TestIdempotencyConcurrent(t *testing.T) {
+	store, client, _ := newTestRedisCache(t)
+
+	// 默认使用SetNX标记处理中，store不支持SetNX时使用分布式锁
+	for _, tc := range []struct {
+		name  string
+		store cache.Cache
+		opts  []IdempotencyOption
+	}{
+		{"setnx", store, nil},
+		{"locker", &plainCache{store}, []IdempotencyOption{WithIdempotencyLocker(goredis.NewLocker(client))}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, count := newIdempotencyRouter(tc.store, tc.opts...)
+			var conflicts, created int32
+			wg := &sync.WaitGroup{}
+			for i := 0; i < 5; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					w := doTestRequest(r, http.MethodPost, "/orders?slow=1", idempotencyKey(tc.name), "{}")
+					switch w.Code {
+					case http.StatusConflict:
+						atomic.AddInt32(&conflicts, 1)
+					case http.StatusCreated:
+						atomic.AddInt32(&created, 1)
+					}
+				}()
+			}
+			wg.Wait()
+			assert.Equal(t, int32(1), atomic.LoadInt32(count))
+			assert.Equal(t, int32(1), created)
+			assert.Equal(t, int32(4), conflicts)
+		})
+	}
+}
+
+func TestIdempotencyWait(t *testing.T) {
+	store, _, _ := newTestRedisCache(t)
+	r, count := newIdempotencyRouter(store, WithIdempotencyWait(time.Second), WithIdempotencyTTL(time.Hour),
+		WithIdempotencyLockTTL(time.Second*10), WithIdempotencyScope(func(c *gin.Context) string { return c.GetHeader("X-Tenant") }))
+
+	bodies := make([]string, 3)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			bodies[i] = doTestRequest(r, http.MethodPost, "/orders?slow=1", idempotencyKey("key1"), "{}").Body.String()
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(count))
+	for _, body := range bodies {
+		assert.Equal(t, `{"seq":1}`, body)
+	}
+}
+
+func TestIdempotencyRequired(t *testing.T) {
+	store, _, _ := newTestRedisCache(t)
+	r, _ := newIdempotencyRouter(store, WithIdempotencyRequired(), WithIdempotencyHeader("X-Request-Key"),
+		WithIdempotencyMethods(http.MethodPost, http.MethodGet))
+
+	assert.Equal(t, http.StatusBadRequest, doTestRequest(r, http.MethodPost, "/orders", idempotencyKey(""), "").Code)
+	req := httptest.NewRequest(http.MethodGet, "/orders", strings.NewReader(""))
+	req.Header.Set("X-Request-Key", "key1")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, "list", w.Body.String())
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, "list", w.Body.String())
+	assert.Equal(t, "true", w.Header().Get(IdempotencyReplayedHeader))
+}
+
+func TestIdempotencyScope(t *testing.T) {
+	store, _, _ := newTestRedisCache(t)
+	r, count := newIdempotencyRouter(store)
+
+	// 没有经过Auth认证时按客户端ip区分
+	header := map[string]string{DefaultIdempotencyHeader: "key1", "X-Forwarded-For": "10.0.0.1"}
+	assert.Equal(t, `{"seq":1}`, doTestRequest(r, http.MethodPost, "/orders", header, "{}").Body.String())
+	assert.Equal(t, `{"seq":1}`, doTestRequest(r, http.MethodPost, "/orders", header, "{}").Body.String())
+	header["X-Forwarded-For"] = "10.0.0.2"
+	assert.Equal(t, `{"seq":2}`, doTestRequest(r, http.MethodPost, "/orders", header, "{}").Body.String())
+
+	// 按Auth设置的uid区分
+	gin.SetMode(gin.ReleaseMode)
+	r = gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("uid", c.GetHeader("X-Uid"))
+	}, Idempotency(store))
+	r.POST("/orders", func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("uid"))
+	})
+	header = map[string]string{DefaultIdempotencyHeader: "key1", "X-Uid": "100"}
+	assert.Equal(t, "100", doTestRequest(r, http.MethodPost, "/orders", header, "{}").Body.String())
+	header["X-Uid"] = "200"
+	assert.Equal(t, "200", doTestRequest(r, http.MethodPost, "/orders", header, "{}").Body.String())
+	assert.Equal(t, int32(2), atomic.LoadInt32(count))
+}
+
+func TestIdempotencyMaxBodySize(t *testing.T) {
+	store, _, _ := newTestRedisCache(t)
+	r, count := newIdempotencyRouter(store, WithIdempotencyMaxBodySize(10))
+
+	w := doTestRequest(r, http.MethodPost, "/orders", idempotencyKey("key1"), `{"amount":1000000}`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	w = doTestRequest(r, http.MethodPost, "/orders", idempotencyKey("key1"), `{"a":1}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, int32(1), atomic.LoadInt32(count))
+}
+
+func TestIdempotencyReplayHeaders(t *testing.T) {
+	store, _, _ := newTestRedisCache(t)
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(RequestID(), func(c *gin.Context) {
+		c.Header("Access-Control-Allow-Origin", "*")
+	}, Idempotency(store))
+	r.POST("/orders", func(c *gin.Context) {
+		c.Header("Location", "/orders/1")
+		c.SetCookie("session", c.GetHeader(HeaderXRequestIDKey), 60, "/", "", false, true)
+		c.JSON(http.StatusCreated, gin.H{"id": 1})
+	})
+
+	w1 := doTestRequest(r, http.MethodPost, "/orders", idempotencyKey("key1"), "{}")
+	w2 := doTestRequest(r, http.MethodPost, "/orders", idempotencyKey("key1"), "{}")
+	assert.Equal(t, "true", w2.Header().Get(IdempotencyReplayedHeader))
+	assert.Equal(t, []string{"/orders/1"}, w2.Header().Values("Location"))
+	// 前面的中间件设置的响应头不重复，每个请求不同的响应头不重放
+	assert.Equal(t, []string{"*"}, w2.Header().Values("Access-Control-Allow-Origin"))
+	assert.Len(t, w2.Header().Values(HeaderXRequestIDKey), 1)
+	assert.NotEqual(t, w1.Header().Get(HeaderXRequestIDKey), w2.Header().Get(HeaderXRequestIDKey))
+	assert.NotEmpty(t, w1.Header().Get("Set-Cookie"))
+	assert.Empty(t, w2.Header().Get("Set-Cookie"))
+}
+
+func TestIdempotencyMarkExpired(t *testing.T) {
+	store, _, s := newTestRedisCache(t)
+
+	for _, tc := range []struct {
+		name  string
+		store cache.Cache
+	}{
+		{"setnx", store},
+		{"local", &plainCache{store}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, _ := newIdempotencyRouter(tc.store)
+
+			// 第一个请求处理超时，处理中的标记过期后第二个请求重新标记
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				assert.Equal(t, `{"seq":1}`, doTestRequest(r, http.MethodPost, "/orders?slow=1", idempotencyKey(tc.name), "{}").Body.String())
+			}()
+			time.Sleep(time.Millisecond * 100)
+			s.FastForward(time.Minute)
+			wg := &sync.WaitGroup{}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.Equal(t, `{"seq":2}`, doTestRequest(r, http.MethodPost, "/orders?slow=1", idempotencyKey(tc.name), "{}").Body.String())
+			}()
+			time.Sleep(time.Millisecond * 100)
+
+			// 第一个请求的响应不覆盖第二个请求的标记
+			<-done
+			w := doTestRequest(r, http.MethodPost, "/orders?slow=1", idempotencyKey(tc.name), "{}")
+			assert.Equal(t, http.StatusConflict, w.Code)
+			wg.Wait()
+			assert.Equal(t, `{"seq":2}`, doTestRequest(r, http.MethodPost, "/orders?slow=1", idempotencyKey(tc.name), "{}").Body.String())
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zhufuyi/pkg/cache"
+	"github.com/zhufuyi/pkg/encoding"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// 测试用的redis缓存，测试结束后关闭miniredis
+func newTestRedisCache(t *testing.T) (cache.Cache, *redis.Client, *miniredis.Miniredis) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	return cache.NewRedisCache(client, "test:", encoding.JSONEncoding{}, nil), client, s
+}
+
+// 发送请求到router，返回响应，值为空的请求头不设置
+func doTestRequest(r http.Handler, method string, path string, header map[string]string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	for k, v := range header {
+		if v != "" {
+			req.Header.Set(k, v)
+		}
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// 只实现了cache.Cache接口的缓存
+type plainCache struct {
+	cache.Cache
+}
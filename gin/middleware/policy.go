@@ -0,0 +1,209 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// 策略效果，deny优先于allow
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// Policy 授权策略，用户或角色可以用哪些http方法访问哪些资源
+type Policy struct {
+	Subject  string   `json:"subject" yaml:"subject"`   // 用户id，*表示所有用户，和Role至少设置一个
+	Role     string   `json:"role" yaml:"role"`         // 角色，包括继承该角色的子角色
+	Resource string   `json:"resource" yaml:"resource"` // 资源路径，*匹配一段路径，**匹配剩余所有路径，:id等同于*，例如 /api/v1/users/:id
+	Methods  []string `json:"methods" yaml:"methods"`   // http方法，为空或*表示所有方法
+	Effect   string   `json:"effect" yaml:"effect"`     // allow或deny，默认allow
+
+	// Conditions 属性条件(ABAC)，所有属性都相等时策略才生效，属性由WithAttributeFunc设置，
+	// 值为$uid时表示等于当前用户id，例如 {"tenant": "t1"} {"owner": "$uid"}
+	Conditions map[string]string `json:"conditions,omitempty" yaml:"conditions,omitempty"`
+}
+
+// PolicyConfig 策略和角色继承关系
+type PolicyConfig struct {
+	Policies []Policy `json:"policies" yaml:"policies"`
+	// Roles 角色继承关系，角色 -> 父角色，角色拥有父角色的所有权限，例如 {"admin": ["editor"], "editor": ["viewer"]}
+	Roles map[string][]string `json:"roles" yaml:"roles"`
+}
+
+// PolicyLoader 加载策略，开启热更新时定时调用
+type PolicyLoader interface {
+	Load(ctx context.Context) (*PolicyConfig, error)
+}
+
+// ------------------------------------------------------------------------------------------
+
+type filePolicyLoader struct {
+	file string
+}
+
+// NewFilePolicyLoader load policies from yaml or json file, e.g.
+//
+//	policies:
+//	  - role: viewer
+//	    resource: /api/v1/**
+//	    methods: [GET]
+//	  - role: editor
+//	    resource: /api/v1/articles/*
+//	    methods: [POST, PUT, DELETE]
+//	  - subject: "100"
+//	    resource: /api/v1/articles/*
+//	    methods: [DELETE]
+//	    effect: deny
+//	roles:
+//	  editor: [viewer]
+//	  admin: [editor]
+func NewFilePolicyLoader(file string) PolicyLoader {
+	return &filePolicyLoader{file: file}
+}
+
+func (l *filePolicyLoader) Load(_ context.Context) (*PolicyConfig, error) {
+	data, err := os.ReadFile(l.file)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &PolicyConfig{}
+	switch strings.ToLower(filepath.Ext(l.file)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	case ".json":
+		err = json.Unmarshal(data, cfg)
+	default:
+		return nil, fmt.Errorf("unsupported policy file type %s, only yaml and json are supported", filepath.Ext(l.file))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse policy file %s error: %v", l.file, err)
+	}
+	return cfg, nil
+}
+
+// ------------------------------------------------------------------------------------------
+
+var (
+	// DefaultPolicyTable 策略表默认名称
+	DefaultPolicyTable = "auth_policy"
+	// DefaultRoleTable 角色继承表默认名称
+	DefaultRoleTable = "auth_role"
+)
+
+// PolicyModel 策略表，methods多个方法用逗号分隔，conditions为json
+type PolicyModel struct {
+	ID         uint64    `gorm:"column:id;primaryKey" json:"id"`
+	Subject    string    `gorm:"column:subject;type:varchar(128)" json:"subject"`
+	Role       string    `gorm:"column:role;type:varchar(128)" json:"role"`
+	Resource   string    `gorm:"column:resource;type:varchar(255);not null" json:"resource"`
+	Methods    string    `gorm:"column:methods;type:varchar(128)" json:"methods"`
+	Effect     string    `gorm:"column:effect;type:varchar(16)" json:"effect"`
+	Conditions string    `gorm:"column:conditions;type:varchar(1024)" json:"conditions"`
+	UpdatedAt  time.Time `gorm:"column:updated_at" json:"updatedAt"`
+}
+
+// RoleModel 角色继承表，每条记录表示role继承parent的权限
+type RoleModel struct {
+	ID     uint64 `gorm:"column:id;primaryKey" json:"id"`
+	Role   string `gorm:"column:role;type:varchar(128);not null" json:"role"`
+	Parent string `gorm:"column:parent;type:varchar(128);not null" json:"parent"`
+}
+
+// GormPolicyOption set the gorm policy loader options.
+type GormPolicyOption func(*gormPolicyOptions)
+
+type gormPolicyOptions struct {
+	policyTable string
+	roleTable   string
+}
+
+func (o *gormPolicyOptions) apply(opts ...GormPolicyOption) {
+	for _, opt := range opts {
+		opt(o)
+	}
+}
+
+func defaultGormPolicyOptions() *gormPolicyOptions {
+	return &gormPolicyOptions{
+		policyTable: DefaultPolicyTable,
+		roleTable:   DefaultRoleTable,
+	}
+}
+
+// WithPolicyTable set the table name of policies
+func WithPolicyTable(table string) GormPolicyOption {
+	return func(o *gormPolicyOptions) {
+		o.policyTable = table
+	}
+}
+
+// WithRoleTable set the table name of role inheritance, empty means no role inheritance
+func WithRoleTable(table string) GormPolicyOption {
+	return func(o *gormPolicyOptions) {
+		o.roleTable = table
+	}
+}
+
+type gormPolicyLoader struct {
+	db   *gorm.DB
+	opts *gormPolicyOptions
+}
+
+// NewGormPolicyLoader load policies from database tables, the table structure see PolicyModel and RoleModel
+func NewGormPolicyLoader(db *gorm.DB, opts ...GormPolicyOption) PolicyLoader {
+	o := defaultGormPolicyOptions()
+	o.apply(opts...)
+	return &gormPolicyLoader{db: db, opts: o}
+}
+
+func (l *gormPolicyLoader) Load(ctx context.Context) (*PolicyConfig, error) {
+	var rows []PolicyModel
+	err := l.db.WithContext(ctx).Table(l.opts.policyTable).Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &PolicyConfig{Roles: map[string][]string{}}
+	for _, row := range rows {
+		p := Policy{
+			Subject:  row.Subject,
+			Role:     row.Role,
+			Resource: row.Resource,
+			Effect:   row.Effect,
+		}
+		for _, m := range strings.Split(row.Methods, ",") {
+			if m = strings.TrimSpace(m); m != "" {
+				p.Methods = append(p.Methods, m)
+			}
+		}
+		if row.Conditions != "" {
+			if err = json.Unmarshal([]byte(row.Conditions), &p.Conditions); err != nil {
+				return nil, fmt.Errorf("invalid conditions of policy id = %d: %v", row.ID, err)
+			}
+		}
+		cfg.Policies = append(cfg.Policies, p)
+	}
+
+	if l.opts.roleTable == "" {
+		return cfg, nil
+	}
+	var roles []RoleModel
+	err = l.db.WithContext(ctx).Table(l.opts.roleTable).Find(&roles).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range roles {
+		cfg.Roles[r.Role] = append(cfg.Roles[r.Role], r.Parent)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zhufuyi/pkg/gotest"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilePolicyLoader(t *testing.T) {
+	dir := t.TempDir()
+
+	file := filepath.Join(dir, "policy.json")
+	_ = os.WriteFile(file, []byte(`{"policies":[{"role":"viewer","resource":"/api/**","methods":["GET"]}],"roles":{"admin":["viewer"]}}`), 0666)
+	cfg, err := NewFilePolicyLoader(file).Load(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "viewer", cfg.Policies[0].Role)
+	assert.Equal(t, []string{"viewer"}, cfg.Roles["admin"])
+
+	file = filepath.Join(dir, "policy.yml")
+	_ = os.WriteFile(file, []byte("policies:\n  - subject: \"100\"\n    resource: /api/users/:id\n    effect: deny\n"), 0666)
+	cfg, err = NewFilePolicyLoader(file).Load(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "100", cfg.Policies[0].Subject)
+	assert.Equal(t, EffectDeny, cfg.Policies[0].Effect)
+
+	_, err = NewFilePolicyLoader(filepath.Join(dir, "policy.toml")).Load(context.Background())
+	assert.Error(t, err)
+	_, err = NewFilePolicyLoader(filepath.Join(dir, "not_found.yml")).Load(context.Background())
+	assert.Error(t, err)
+	_ = os.WriteFile(file, []byte("policies: {"), 0666)
+	_, err = NewFilePolicyLoader(file).Load(context.Background())
+	assert.Error(t, err)
+}
+
+func TestGormPolicyLoader(t *testing.T) {
+	d := gotest.NewDao(nil, nil)
+	defer d.Close()
+	db, mock := d.DB, d.SQLMock
+	mock.ExpectQuery("SELECT \\* FROM `auth_policy`").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "subject", "role", "resource", "methods", "effect", "conditions"}).
+			AddRow(1, "", "editor", "/api/articles/*", "POST, PUT", "", `{"tenant":"t1"}`).
+			AddRow(2, "*", "", "/api/profile", "", "allow", ""))
+	mock.ExpectQuery("SELECT \\* FROM `auth_role`").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "role", "parent"}).
+			AddRow(1, "admin", "editor").
+			AddRow(2, "admin", "viewer"))
+
+	cfg, err := NewGormPolicyLoader(db).Load(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, cfg.Policies, 2)
+	assert.Equal(t, []string{"POST", "PUT"}, cfg.Policies[0].Methods)
+	assert.Equal(t, map[string]string{"tenant": "t1"}, cfg.Policies[0].Conditions)
+	assert.Nil(t, cfg.Policies[1].Methods)
+	assert.Equal(t, []string{"editor", "viewer"}, cfg.Roles["admin"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// 自定义表名，不使用角色继承
+	mock.ExpectQuery("SELECT \\* FROM `my_policy`").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "subject", "resource", "conditions"}).
+			AddRow(1, "100", "/api/**", "{"))
+	_, err = NewGormPolicyLoader(db, WithPolicyTable("my_policy"), WithRoleTable("")).Load(context.Background())
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -1,10 +1,14 @@
 package middleware
 
 import (
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/zhufuyi/pkg/gin/response"
+	"github.com/zhufuyi/pkg/logger"
 	rl "github.com/zhufuyi/pkg/shield/ratelimit"
 
 	"github.com/gin-gonic/gin"
@@ -90,3 +94,127 @@ func RateLimit(opts ...RateLimitOption) gin.HandlerFunc {
 		done(rl.DoneInfo{Err: c.Request.Context().Err()})
 	}
 }
+
+// ------------------------------------------------------------------------------------------
+
+// KeyFunc 获取限流的key，返回空字符串时使用客户端ip
+type KeyFunc func(c *gin.Context) string
+
+// KeyByIP limit by client ip
+func KeyByIP() KeyFunc {
+	return func(c *gin.Context) string {
+		return "ip:" + c.ClientIP()
+	}
+}
+
+// KeyByHeader limit by the value of header, e.g. KeyByHeader("X-Api-Key")
+func KeyByHeader(name string) KeyFunc {
+	return func(c *gin.Context) string {
+		if v := c.GetHeader(name); v != "" {
+			return name + ":" + v
+		}
+		return ""
+	}
+}
+
+// KeyByUID limit by the user id set by Auth
+func KeyByUID() KeyFunc {
+	return func(c *gin.Context) string {
+		if uid := c.GetString("uid"); uid != "" {
+			return "uid:" + uid
+		}
+		return ""
+	}
+}
+
+// KeyRateLimitOption set the key rate limit options.
+type KeyRateLimitOption func(*keyRateLimitOptions)
+
+type keyRateLimitOptions struct {
+	keyFn      KeyFunc
+	withPath   bool
+	failClosed bool
+}
+
+func (o *keyRateLimitOptions) apply(opts ...KeyRateLimitOption) {
+	for _, opt := range opts {
+		opt(o)
+	}
+}
+
+func defaultKeyRateLimitOptions() *keyRateLimitOptions {
+	return &keyRateLimitOptions{
+		keyFn: KeyByIP(),
+	}
+}
+
+// WithKeyFunc set the function to get the limit key, the default is KeyByIP
+func WithKeyFunc(fn KeyFunc) KeyRateLimitOption {
+	return func(o *keyRateLimitOptions) {
+		if fn != nil {
+			o.keyFn = fn
+		}
+	}
+}
+
+// WithKeyPerRoute each route has its own quota, the default is all routes share the quota
+func WithKeyPerRoute() KeyRateLimitOption {
+	return func(o *keyRateLimitOptions) {
+		o.withPath = true
+	}
+}
+
+// WithFailClosed reject the request when the limiter returns an error (e.g. redis is unavailable),
+// the default is to allow the request
+func WithFailClosed() KeyRateLimitOption {
+	return func(o *keyRateLimitOptions) {
+		o.failClosed = true
+	}
+}
+
+// KeyRateLimit limit by key with a fixed quota, e.g. 100 requests per minute per api key, ip or user id,
+// the limiter can be redis token bucket or sliding window which shares the quota across replicas,
+// response headers X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset and Retry-After(rejected only) are set
+func KeyRateLimit(limiter rl.KeyLimiter, opts ...KeyRateLimitOption) gin.HandlerFunc {
+	o := defaultKeyRateLimitOptions()
+	o.apply(opts...)
+
+	return func(c *gin.Context) {
+		key := o.keyFn(c)
+		if key == "" {
+			key = "ip:" + c.ClientIP()
+		}
+		if o.withPath {
+			key += ":" + c.Request.Method + ":" + c.FullPath()
+		}
+
+		result, err := limiter.Take(c.Request.Context(), key)
+		if result != nil {
+			c.Header("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+			c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			c.Header("X-RateLimit-Reset", ceilSeconds(result.ResetAfter))
+		}
+		if err != nil {
+			if errors.Is(err, rl.ErrLimitExceed) {
+				c.Header("Retry-After", ceilSeconds(result.RetryAfter))
+				response.Output(c, http.StatusTooManyRequests, err.Error())
+				c.Abort()
+				return
+			}
+
+			logger.Warn("rate limit error", logger.Err(err), logger.String("key", key))
+			if o.failClosed {
+				response.Output(c, http.StatusServiceUnavailable)
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// 向上取整的秒数
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
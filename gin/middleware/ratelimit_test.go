@@ -3,6 +3,7 @@ package middleware
 import (
 	"math/rand"
 	"net/http"
+	"net/http/httptest"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -10,9 +11,13 @@ import (
 
 	"github.com/zhufuyi/pkg/gin/response"
 	"github.com/zhufuyi/pkg/gohttp"
+	rl "github.com/zhufuyi/pkg/shield/ratelimit"
 	"github.com/zhufuyi/pkg/utils"
 
+	"github.com/alicebob/miniredis/v2"
 	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
 )
 
 func runRateLimiterHTTPServer() string {
@@ -75,3 +80,59 @@ func TestRateLimiter(t *testing.T) {
 			time.Now().Format(time.RFC3339Nano), success, failures)
 	}
 }
+
+func TestKeyRateLimit(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	hello := func(c *gin.Context) { response.Success(c, "hello") }
+	r.GET("/api/key", KeyRateLimit(rl.NewRedisTokenBucket(client, 2, time.Minute, 2), WithKeyFunc(KeyByHeader("X-Api-Key"))), hello)
+	r.GET("/api/ip", KeyRateLimit(rl.NewRedisSlidingWindow(client, 1, time.Minute, rl.WithKeyPrefix("sw:"))), hello)
+	r.GET("/api/uid/:id", func(c *gin.Context) { c.Set("uid", c.Param("id")) },
+		KeyRateLimit(rl.NewRedisSlidingWindow(client, 1, time.Minute, rl.WithKeyPrefix("uid:")), WithKeyFunc(KeyByUID()), WithKeyPerRoute()), hello)
+
+	do := func(path string, apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if apiKey != "" {
+			req.Header.Set("X-Api-Key", apiKey)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		w := do("/api/key", "key1")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "2", w.Header().Get("X-RateLimit-Limit"))
+		assert.Equal(t, []string{"1", "0"}[i], w.Header().Get("X-RateLimit-Remaining"))
+	}
+	w := do("/api/key", "key1")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+	assert.Equal(t, "60", w.Header().Get("X-RateLimit-Reset"))
+	assert.Equal(t, http.StatusOK, do("/api/key", "key2").Code)
+	// 没有api key时按ip限流
+	assert.Equal(t, http.StatusOK, do("/api/key", "").Code)
+	assert.True(t, s.Exists("ratelimit:ip:192.0.2.1"))
+
+	assert.Equal(t, http.StatusOK, do("/api/ip", "").Code)
+	assert.Equal(t, http.StatusTooManyRequests, do("/api/ip", "").Code)
+
+	assert.Equal(t, http.StatusOK, do("/api/uid/1", "").Code)
+	assert.Equal(t, http.StatusTooManyRequests, do("/api/uid/1", "").Code)
+	assert.Equal(t, http.StatusOK, do("/api/uid/2", "").Code)
+	assert.True(t, s.Exists("uid:uid:1:GET:/api/uid/:id"))
+
+	// redis错误时默认不限流
+	s.Close()
+	assert.Equal(t, http.StatusOK, do("/api/ip", "").Code)
+	r.GET("/api/closed", KeyRateLimit(rl.NewRedisSlidingWindow(client, 1, time.Minute), WithFailClosed()), hello)
+	assert.Equal(t, http.StatusServiceUnavailable, do("/api/closed", "").Code)
+}
@@ -0,0 +1,389 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zhufuyi/pkg/cache"
+	"github.com/zhufuyi/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// ResponseCacheHeader 响应头，值为HIT表示响应来自缓存，MISS表示响应由handler生成
+	ResponseCacheHeader = "X-Cache"
+
+	responseCacheKeyPrefix = "respcache:"
+	responseCacheTagPrefix = "respcache:"
+
+	// 只缓存描述响应内容的响应头，其他中间件设置的请求相关的响应头(例如X-Request-ID、X-RateLimit-*)和Set-Cookie不缓存
+	responseCacheHeaders = []string{
+		"Content-Type", "Content-Encoding", "Content-Language", "Content-Disposition",
+		"Cache-Control", "Expires", "Vary", "ETag", "Last-Modified",
+	}
+)
+
+// ResponseCacheOption set the response cache options.
+type ResponseCacheOption func(*responseCacheOptions)
+
+type responseCacheOptions struct {
+	ttl          time.Duration
+	varyHeaders  []string
+	tagsFn       func(c *gin.Context) []string
+	cacheControl string
+	scopeFn      func(c *gin.Context) string
+	headers      []string
+}
+
+func (o *responseCacheOptions) apply(opts ...ResponseCacheOption) {
+	for _, opt := range opts {
+		opt(o)
+	}
+}
+
+func defaultResponseCacheOptions() *responseCacheOptions {
+	return &responseCacheOptions{
+		ttl:     time.Minute,
+		headers: responseCacheHeaders,
+	}
+}
+
+// WithResponseCacheTTL set how long the response is cached, the default is 1 minute
+func WithResponseCacheTTL(d time.Duration) ResponseCacheOption {
+	return func(o *responseCacheOptions) {
+		if d > 0 {
+			o.ttl = d
+		}
+	}
+}
+
+// WithResponseCacheVaryHeaders the request headers which are part of the cache key, the responses are cached separately
+// for different header values, e.g. WithResponseCacheVaryHeaders("Accept", "Accept-Language")
+func WithResponseCacheVaryHeaders(names ...string) ResponseCacheOption {
+	return func(o *responseCacheOptions) {
+		for _, name := range names {
+			o.varyHeaders = append(o.varyHeaders, http.CanonicalHeaderKey(name))
+		}
+	}
+}
+
+// WithResponseCacheTags set extra tags of the cached response, InvalidateResponseCache deletes the responses by tag,
+// the route (e.g. /api/v1/users/:id) and the request path (e.g. /api/v1/users/1) are always tags
+func WithResponseCacheTags(fn func(c *gin.Context) []string) ResponseCacheOption {
+	return func(o *responseCacheOptions) {
+		o.tagsFn = fn
+	}
+}
+
+// WithResponseCacheControl set the Cache-Control header of the response if the handler does not set it,
+// e.g. "public, max-age=60", the default is not set
+func WithResponseCacheControl(value string) ResponseCacheOption {
+	return func(o *responseCacheOptions) {
+		o.cacheControl = value
+	}
+}
+
+// WithResponseCacheScope cache the responses of authenticated requests (with Authorization header or uid in the context),
+// the scope returned by fn is part of the cache key, e.g. return c.GetString("uid") to cache the responses per user,
+// return "" to share the responses between all users if the responses do not depend on the user,
+// the responses of authenticated requests are not cached by default
+func WithResponseCacheScope(fn func(c *gin.Context) string) ResponseCacheOption {
+	return func(o *responseCacheOptions) {
+		o.scopeFn = fn
+	}
+}
+
+// WithResponseCacheHeaders the extra response headers which are cached, by default only the entity headers
+// (Content-Type, Content-Encoding, Cache-Control, Vary, ETag, Last-Modified, etc.) are cached, Set-Cookie is never cached
+func WithResponseCacheHeaders(names ...string) ResponseCacheOption {
+	return func(o *responseCacheOptions) {
+		headers := append([]string{}, o.headers...)
+		for _, name := range names {
+			name = http.CanonicalHeaderKey(name)
+			if name != "Set-Cookie" {
+				headers = append(headers, name)
+			}
+		}
+		o.headers = headers
+	}
+}
+
+// CachedResponse 缓存的响应，Header只包括需要缓存的响应头
+type CachedResponse struct {
+	Status       int                 `json:"status"`
+	Header       map[string][]string `json:"header"`
+	Body         []byte              `json:"body"`
+	ETag         string              `json:"etag"`
+	LastModified time.Time           `json:"lastModified"`
+}
+
+// 先缓冲响应，handler执行完后再决定返回完整响应还是304
+type responseCacheWriter struct {
+	gin.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *responseCacheWriter) WriteHeader(code int) {
+	if code > 0 {
+		w.status = code
+	}
+}
+
+func (w *responseCacheWriter) WriteHeaderNow() {}
+
+func (w *responseCacheWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+func (w *responseCacheWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func (w *responseCacheWriter) Status() int {
+	return w.status
+}
+
+func (w *responseCacheWriter) Size() int {
+	return w.body.Len()
+}
+
+func (w *responseCacheWriter) Written() bool {
+	return w.body.Len() > 0
+}
+
+// ResponseCache cache the full response (status, headers, body) of GET and HEAD requests, keyed by route, query and vary headers,
+// set ETag and Last-Modified headers and return 304 if the conditional request matches,
+// the client can skip the cache by Cache-Control: no-cache (refresh the cache) or no-store (neither read nor write the cache),
+// only 200 responses without Cache-Control: no-store or private are cached, streaming responses are not supported,
+// call InvalidateResponseCache after writing data to delete the stale responses.
+//
+// Requests with Authorization header or uid in the context (set by Auth, ResponseCache must be used after Auth) are
+// not cached by default, otherwise the response of one user would be returned to other users,
+// use WithResponseCacheScope to cache them per user or share them explicitly.
+func ResponseCache(store cache.Cache, opts ...ResponseCacheOption) gin.HandlerFunc {
+	o := defaultResponseCacheOptions()
+	o.apply(opts...)
+	tagStore, _ := store.(cache.TagCache)
+
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			c.Next()
+			return
+		}
+		noCache, noStore := requestCacheControl(c.Request.Header)
+		if noStore || (o.scopeFn == nil && isAuthenticatedRequest(c)) {
+			c.Next()
+			return
+		}
+
+		ctx := c.Request.Context()
+		key := o.cacheKey(c)
+		if !noCache {
+			rec := &CachedResponse{}
+			err := store.Get(ctx, key, rec)
+			if err == nil {
+				writeCachedResponse(c, rec, "HIT")
+				c.Abort()
+				return
+			}
+			if !errors.Is(err, cache.CacheNotFound) {
+				logger.Warn("get cached response error", logger.Err(err), logger.String("key", key))
+			}
+		}
+		if c.Request.Method == http.MethodHead { // HEAD的响应没有body，不保存
+			c.Next()
+			return
+		}
+
+		w := &responseCacheWriter{ResponseWriter: c.Writer, status: http.StatusOK}
+		c.Writer = w
+		defer func() {
+			c.Writer = w.ResponseWriter // panic时恢复原writer，外层的Recovery才能返回500
+		}()
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		if w.status != http.StatusOK || !isCacheableResponse(w.Header()) {
+			c.Status(w.status)
+			_, _ = c.Writer.Write(w.body.Bytes())
+			return
+		}
+
+		if o.cacheControl != "" && w.Header().Get("Cache-Control") == "" {
+			w.Header().Set("Cache-Control", o.cacheControl)
+		}
+		if len(o.varyHeaders) > 0 {
+			w.Header().Set("Vary", strings.Join(o.varyHeaders, ", "))
+		}
+		rec := newCachedResponse(w, o.headers)
+		tags := o.cacheTags(c)
+		var err error
+		if tagStore != nil {
+			err = tagStore.SetWithTags(context.Background(), key, rec, o.ttl, tags...)
+		} else {
+			err = store.Set(context.Background(), key, rec, o.ttl)
+		}
+		if err != nil {
+			logger.Warn("save cached response error", logger.Err(err), logger.String("key", key))
+		}
+		writeCachedResponse(c, rec, "MISS")
+	}
+}
+
+// InvalidateResponseCache delete the cached responses by tags, the tags are the route, the request path or the tags set by
+// WithResponseCacheTags, e.g. call InvalidateResponseCache(ctx, store, "/api/v1/users/"+id, "/api/v1/users") in the dao
+// after updating the user, the store must implement cache.TagCache, otherwise return cache.ErrTagUnsupported
+func InvalidateResponseCache(ctx context.Context, store cache.Cache, tags ...string) error {
+	tc, ok := store.(cache.TagCache)
+	if !ok {
+		return cache.ErrTagUnsupported
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	prefixed := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		prefixed = append(prefixed, responseCacheTagPrefix+tag)
+	}
+	return tc.InvalidateTag(ctx, prefixed...)
+}
+
+// 缓存key由范围、路径、排序后的查询参数和指定的请求头组成，GET和HEAD共用缓存
+func (o *responseCacheOptions) cacheKey(c *gin.Context) string {
+	h := sha256.New()
+	if o.scopeFn != nil {
+		h.Write([]byte("scope:" + o.scopeFn(c) + "\n"))
+	}
+	h.Write([]byte(c.Request.URL.Path + "?" + c.Request.URL.Query().Encode() + "\n")) // Encode按key排序
+	for _, name := range o.varyHeaders {
+		h.Write([]byte(name + ":" + strings.Join(c.Request.Header.Values(name), ",") + "\n"))
+	}
+	return responseCacheKeyPrefix + hex.EncodeToString(h.Sum(nil))
+}
+
+func (o *responseCacheOptions) cacheTags(c *gin.Context) []string {
+	tags := []string{responseCacheTagPrefix + c.Request.URL.Path}
+	if route := c.FullPath(); route != "" && route != c.Request.URL.Path {
+		tags = append(tags, responseCacheTagPrefix+route)
+	}
+	if o.tagsFn != nil {
+		for _, tag := range o.tagsFn(c) {
+			tags = append(tags, responseCacheTagPrefix+tag)
+		}
+	}
+	return tags
+}
+
+func newCachedResponse(w *responseCacheWriter, names []string) *CachedResponse {
+	header := w.Header()
+	body := w.body.Bytes()
+
+	etag := header.Get("ETag")
+	if etag == "" {
+		sum := sha256.Sum256(body)
+		etag = `"` + hex.EncodeToString(sum[:16]) + `"`
+		header.Set("ETag", etag)
+	}
+	lastModified, err := http.ParseTime(header.Get("Last-Modified"))
+	if err != nil {
+		lastModified = time.Now().UTC().Truncate(time.Second)
+		header.Set("Last-Modified", lastModified.Format(http.TimeFormat))
+	}
+	cached := http.Header{}
+	for _, name := range names {
+		if values := header.Values(name); len(values) > 0 {
+			cached[http.CanonicalHeaderKey(name)] = append([]string{}, values...)
+		}
+	}
+
+	return &CachedResponse{
+		Status:       w.status,
+		Header:       cached,
+		Body:         body,
+		ETag:         etag,
+		LastModified: lastModified,
+	}
+}
+
+// 不覆盖当前请求已经设置的响应头
+func writeCachedResponse(c *gin.Context, rec *CachedResponse, xCache string) {
+	header := c.Writer.Header()
+	for k, values := range rec.Header {
+		if _, ok := header[k]; !ok {
+			header[k] = values
+		}
+	}
+	header.Set(ResponseCacheHeader, xCache)
+
+	if isNotModified(c.Request.Header, rec) {
+		header.Del("Content-Type")
+		header.Del("Content-Length")
+		c.Status(http.StatusNotModified)
+		c.Writer.WriteHeaderNow()
+		return
+	}
+	c.Status(rec.Status)
+	_, _ = c.Writer.Write(rec.Body)
+}
+
+// If-None-Match优先于If-Modified-Since
+func isNotModified(reqHeader http.Header, rec *CachedResponse) bool {
+	if inm := reqHeader.Get("If-None-Match"); inm != "" {
+		etag := strings.TrimPrefix(rec.ETag, "W/")
+		for _, v := range strings.Split(inm, ",") {
+			v = strings.TrimSpace(v)
+			if v == "*" || strings.TrimPrefix(v, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+	if ims := reqHeader.Get("If-Modified-Since"); ims != "" {
+		t, err := http.ParseTime(ims)
+		return err == nil && !rec.LastModified.Truncate(time.Second).After(t)
+	}
+	return false
+}
+
+func requestCacheControl(header http.Header) (noCache bool, noStore bool) {
+	for _, v := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(v, ",") {
+			directive = strings.ToLower(strings.TrimSpace(directive))
+			switch {
+			case directive == "no-store":
+				noStore = true
+			case directive == "no-cache", directive == "max-age=0":
+				noCache = true
+			}
+		}
+	}
+	if strings.EqualFold(header.Get("Pragma"), "no-cache") {
+		noCache = true
+	}
+	return noCache, noStore
+}
+
+// 带有Authorization请求头或者经过Auth认证的请求，响应可能和用户相关
+func isAuthenticatedRequest(c *gin.Context) bool {
+	return c.GetHeader("Authorization") != "" || c.GetString("uid") != ""
+}
+
+func isCacheableResponse(header http.Header) bool {
+	for _, v := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(v, ",") {
+			directive = strings.ToLower(strings.TrimSpace(directive))
+			if directive == "no-store" || directive == "private" {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,290 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zhufuyi/pkg/cache"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newResponseCacheRouter(t *testing.T, opts ...ResponseCacheOption) (*gin.Engine, cache.Cache, *int32) {
+	store, _, _ := newTestRedisCache(t)
+
+	var count int32
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(ResponseCache(store, opts...))
+	r.GET("/users/:id", func(c *gin.Context) {
+		n := atomic.AddInt32(&count, 1)
+		c.JSON(http.StatusOK, gin.H{"id": c.Param("id"), "n": n, "lang": c.GetHeader("Accept-Language")})
+	})
+	r.HEAD("/users/:id", func(c *gin.Context) {
+		atomic.AddInt32(&count, 1)
+		c.Status(http.StatusOK)
+	})
+	r.GET("/private", func(c *gin.Context) {
+		atomic.AddInt32(&count, 1)
+		c.Header("Cache-Control", "private")
+		c.String(http.StatusOK, "private")
+	})
+	r.GET("/missing", func(c *gin.Context) {
+		atomic.AddInt32(&count, 1)
+		c.String(http.StatusNotFound, "not found")
+	})
+	r.POST("/users/:id", func(c *gin.Context) {
+		atomic.AddInt32(&count, 1)
+		c.String(http.StatusOK, "updated")
+	})
+	return r, store, &count
+}
+
+func TestResponseCache(t *testing.T) {
+	r, _, count := newResponseCacheRouter(t)
+
+	w1 := doTestRequest(r, http.MethodGet, "/users/1?b=2&a=1", nil, "")
+	assert.Equal(t, http.StatusOK, w1.Code)
+	assert.Equal(t, "MISS", w1.Header().Get(ResponseCacheHeader))
+	assert.NotEmpty(t, w1.Header().Get("ETag"))
+	assert.NotEmpty(t, w1.Header().Get("Last-Modified"))
+	assert.Equal(t, "application/json; charset=utf-8", w1.Header().Get("Content-Type"))
+
+	// 查询参数顺序不同，命中缓存
+	w2 := doTestRequest(r, http.MethodGet, "/users/1?a=1&b=2", nil, "")
+	assert.Equal(t, http.StatusOK, w2.Code)
+	assert.Equal(t, "HIT", w2.Header().Get(ResponseCacheHeader))
+	assert.Equal(t, w1.Body.String(), w2.Body.String())
+	assert.Equal(t, w1.Header().Get("ETag"), w2.Header().Get("ETag"))
+	assert.Equal(t, "application/json; charset=utf-8", w2.Header().Get("Content-Type"))
+	assert.Equal(t, int32(1), atomic.LoadInt32(count))
+
+	// 不同参数
+	w3 := doTestRequest(r, http.MethodGet, "/users/1?a=2", nil, "")
+	assert.Equal(t, "MISS", w3.Header().Get(ResponseCacheHeader))
+	assert.Equal(t, int32(2), atomic.LoadInt32(count))
+
+	// HEAD使用GET的缓存
+	w4 := doTestRequest(r, http.MethodHead, "/users/1?a=2", nil, "")
+	assert.Equal(t, "HIT", w4.Header().Get(ResponseCacheHeader))
+	assert.Equal(t, int32(2), atomic.LoadInt32(count))
+
+	// 非GET请求不缓存
+	doTestRequest(r, http.MethodPost, "/users/1", nil, "")
+	w5 := doTestRequest(r, http.MethodPost, "/users/1", nil, "")
+	assert.Equal(t, "updated", w5.Body.String())
+	assert.Empty(t, w5.Header().Get(ResponseCacheHeader))
+	assert.Equal(t, int32(4), atomic.LoadInt32(count))
+}
+
+func TestResponseCacheNotCacheable(t *testing.T) {
+	r, _, count := newResponseCacheRouter(t)
+
+	for i := 0; i < 2; i++ {
+		w := doTestRequest(r, http.MethodGet, "/missing", nil, "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, "not found", w.Body.String())
+		assert.Empty(t, w.Header().Get("ETag"))
+
+		w = doTestRequest(r, http.MethodGet, "/private", nil, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "private", w.Body.String())
+		assert.Empty(t, w.Header().Get(ResponseCacheHeader))
+	}
+	assert.Equal(t, int32(4), atomic.LoadInt32(count))
+
+	// HEAD未命中时不保存
+	doTestRequest(r, http.MethodHead, "/users/2", nil, "")
+	w := doTestRequest(r, http.MethodGet, "/users/2", nil, "")
+	assert.Equal(t, "MISS", w.Header().Get(ResponseCacheHeader))
+	assert.Contains(t, w.Body.String(), `"id":"2"`)
+}
+
+func TestResponseCacheConditional(t *testing.T) {
+	r, _, count := newResponseCacheRouter(t)
+
+	w := doTestRequest(r, http.MethodGet, "/users/1", nil, "")
+	etag := w.Header().Get("ETag")
+	lastModified := w.Header().Get("Last-Modified")
+
+	w = doTestRequest(r, http.MethodGet, "/users/1", map[string]string{"If-None-Match": `"abc", ` + etag}, "")
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+	assert.Empty(t, w.Header().Get("Content-Type"))
+
+	w = doTestRequest(r, http.MethodGet, "/users/1", map[string]string{"If-None-Match": "W/" + etag}, "")
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	w = doTestRequest(r, http.MethodGet, "/users/1", map[string]string{"If-None-Match": `"abc"`}, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEmpty(t, w.Body.String())
+
+	w = doTestRequest(r, http.MethodGet, "/users/1", map[string]string{"If-Modified-Since": lastModified}, "")
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	before := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+	w = doTestRequest(r, http.MethodGet, "/users/1", map[string]string{"If-Modified-Since": before}, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// If-None-Match优先
+	w = doTestRequest(r, http.MethodGet, "/users/1", map[string]string{"If-None-Match": `"abc"`, "If-Modified-Since": lastModified}, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int32(1), atomic.LoadInt32(count))
+
+	// 未命中缓存时也返回304
+	w = doTestRequest(r, http.MethodGet, "/users/1", map[string]string{"Cache-Control": "no-cache", "If-None-Match": "*"}, "")
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Equal(t, "MISS", w.Header().Get(ResponseCacheHeader))
+	assert.Equal(t, int32(2), atomic.LoadInt32(count))
+}
+
+func TestResponseCacheClientNoCache(t *testing.T) {
+	r, _, count := newResponseCacheRouter(t)
+
+	w1 := doTestRequest(r, http.MethodGet, "/users/1", nil, "")
+
+	// no-cache跳过缓存并刷新缓存
+	w2 := doTestRequest(r, http.MethodGet, "/users/1", map[string]string{"Cache-Control": "no-cache"}, "")
+	assert.Equal(t, "MISS", w2.Header().Get(ResponseCacheHeader))
+	assert.NotEqual(t, w1.Body.String(), w2.Body.String())
+	w3 := doTestRequest(r, http.MethodGet, "/users/1", nil, "")
+	assert.Equal(t, "HIT", w3.Header().Get(ResponseCacheHeader))
+	assert.Equal(t, w2.Body.String(), w3.Body.String())
+
+	w4 := doTestRequest(r, http.MethodGet, "/users/1", map[string]string{"Pragma": "no-cache"}, "")
+	assert.Equal(t, "MISS", w4.Header().Get(ResponseCacheHeader))
+	assert.Equal(t, int32(3), atomic.LoadInt32(count))
+
+	// no-store不读也不写缓存
+	w5 := doTestRequest(r, http.MethodGet, "/users/1", map[string]string{"Cache-Control": "no-store"}, "")
+	assert.Empty(t, w5.Header().Get(ResponseCacheHeader))
+	w6 := doTestRequest(r, http.MethodGet, "/users/1", nil, "")
+	assert.Equal(t, "HIT", w6.Header().Get(ResponseCacheHeader))
+	assert.Equal(t, w4.Body.String(), w6.Body.String())
+	assert.Equal(t, int32(4), atomic.LoadInt32(count))
+}
+
+func TestResponseCacheOptions(t *testing.T) {
+	r, _, count := newResponseCacheRouter(t,
+		WithResponseCacheTTL(time.Minute),
+		WithResponseCacheVaryHeaders("accept-language"),
+		WithResponseCacheControl("public, max-age=60"),
+	)
+
+	w := doTestRequest(r, http.MethodGet, "/users/1", map[string]string{"Accept-Language": "en"}, "")
+	assert.Equal(t, "public, max-age=60", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "Accept-Language", w.Header().Get("Vary"))
+	assert.Contains(t, w.Body.String(), `"lang":"en"`)
+
+	w = doTestRequest(r, http.MethodGet, "/users/1", map[string]string{"Accept-Language": "zh"}, "")
+	assert.Equal(t, "MISS", w.Header().Get(ResponseCacheHeader))
+	assert.Contains(t, w.Body.String(), `"lang":"zh"`)
+
+	w = doTestRequest(r, http.MethodGet, "/users/1", map[string]string{"Accept-Language": "en"}, "")
+	assert.Equal(t, "HIT", w.Header().Get(ResponseCacheHeader))
+	assert.Contains(t, w.Body.String(), `"lang":"en"`)
+	assert.Equal(t, "public, max-age=60", w.Header().Get("Cache-Control"))
+	assert.Equal(t, int32(2), atomic.LoadInt32(count))
+}
+
+func TestResponseCacheAuthenticated(t *testing.T) {
+	r, _, count := newResponseCacheRouter(t)
+
+	// 认证的请求默认不缓存
+	for _, token := range []string{"Bearer a", "Bearer b"} {
+		w := doTestRequest(r, http.MethodGet, "/users/1", map[string]string{"Authorization": token}, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get(ResponseCacheHeader))
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(count))
+
+	// 按用户缓存，不同用户不共享缓存
+	r, _, count = newResponseCacheRouter(t, WithResponseCacheScope(func(c *gin.Context) string {
+		return c.GetHeader("Authorization")
+	}))
+	wa := doTestRequest(r, http.MethodGet, "/users/1", map[string]string{"Authorization": "Bearer a"}, "")
+	assert.Equal(t, "MISS", wa.Header().Get(ResponseCacheHeader))
+	wb := doTestRequest(r, http.MethodGet, "/users/1", map[string]string{"Authorization": "Bearer b"}, "")
+	assert.Equal(t, "MISS", wb.Header().Get(ResponseCacheHeader))
+	assert.NotEqual(t, wa.Body.String(), wb.Body.String())
+	w := doTestRequest(r, http.MethodGet, "/users/1", map[string]string{"Authorization": "Bearer a"}, "")
+	assert.Equal(t, "HIT", w.Header().Get(ResponseCacheHeader))
+	assert.Equal(t, wa.Body.String(), w.Body.String())
+	assert.Equal(t, int32(2), atomic.LoadInt32(count))
+}
+
+func TestInvalidateResponseCache(t *testing.T) {
+	r, store, count := newResponseCacheRouter(t, WithResponseCacheTags(func(c *gin.Context) []string {
+		return []string{"user:" + c.Param("id")}
+	}))
+	ctx := context.Background()
+
+	for i := 1; i <= 3; i++ {
+		doTestRequest(r, http.MethodGet, fmt.Sprintf("/users/%d", i), nil, "")
+	}
+	doTestRequest(r, http.MethodGet, "/users/1?a=1", nil, "")
+	assert.Equal(t, int32(4), atomic.LoadInt32(count))
+
+	isHit := func(path string) bool {
+		return doTestRequest(r, http.MethodGet, path, nil, "").Header().Get(ResponseCacheHeader) == "HIT"
+	}
+
+	// 按请求路径删除，包括不同的查询参数
+	err := InvalidateResponseCache(ctx, store, "/users/1")
+	assert.NoError(t, err)
+	assert.False(t, isHit("/users/1"))
+	assert.False(t, isHit("/users/1?a=1"))
+	assert.True(t, isHit("/users/2"))
+
+	// 按自定义标签删除
+	err = InvalidateResponseCache(ctx, store, "user:2")
+	assert.NoError(t, err)
+	assert.False(t, isHit("/users/2"))
+	assert.True(t, isHit("/users/3"))
+
+	// 按路由删除
+	err = InvalidateResponseCache(ctx, store, "/users/:id")
+	assert.NoError(t, err)
+	assert.False(t, isHit("/users/1"))
+	assert.False(t, isHit("/users/3"))
+
+	assert.NoError(t, InvalidateResponseCache(ctx, store))
+	err = InvalidateResponseCache(ctx, &plainCache{store}, "/users/1")
+	assert.ErrorIs(t, err, cache.ErrTagUnsupported)
+}
+
+func TestResponseCacheHeaders(t *testing.T) {
+	store, _, _ := newTestRedisCache(t)
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(RequestID(), ResponseCache(store, WithResponseCacheHeaders("X-Version", "Set-Cookie")))
+	r.GET("/users/:id", func(c *gin.Context) {
+		c.Header("X-Version", "v1")
+		c.Header("X-Debug", "1")
+		c.SetCookie("session", "abc", 3600, "/", "", false, true)
+		c.JSON(http.StatusOK, gin.H{"id": c.Param("id")})
+	})
+
+	w1 := doTestRequest(r, http.MethodGet, "/users/1", nil, "")
+	assert.Equal(t, "MISS", w1.Header().Get(ResponseCacheHeader))
+	assert.NotEmpty(t, w1.Header().Get("Set-Cookie"))
+
+	// 请求相关的响应头不使用缓存的值，Set-Cookie和没有指定的响应头不缓存
+	w2 := doTestRequest(r, http.MethodGet, "/users/1", nil, "")
+	assert.Equal(t, "HIT", w2.Header().Get(ResponseCacheHeader))
+	assert.NotEmpty(t, w2.Header().Get(HeaderXRequestIDKey))
+	assert.NotEqual(t, w1.Header().Get(HeaderXRequestIDKey), w2.Header().Get(HeaderXRequestIDKey))
+	assert.Len(t, w2.Header().Values(HeaderXRequestIDKey), 1)
+	assert.Empty(t, w2.Header().Get("Set-Cookie"))
+	assert.Empty(t, w2.Header().Get("X-Debug"))
+	assert.Equal(t, "v1", w2.Header().Get("X-Version"))
+	assert.Equal(t, "application/json; charset=utf-8", w2.Header().Get("Content-Type"))
+	assert.Equal(t, w1.Header().Get("ETag"), w2.Header().Get("ETag"))
+	assert.Equal(t, w1.Body.String(), w2.Body.String())
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/zhufuyi/pkg/encoding"
 	"github.com/zhufuyi/pkg/errcode"
 
 	"github.com/gin-gonic/gin"
@@ -106,7 +107,40 @@ func Success(c *gin.Context, data ...interface{}) {
 	respJSONWith200(c, 0, "ok", data...)
 }
 
-// Error 错误
+// Error 错误，根据请求的语言返回翻译后的错误信息
 func Error(c *gin.Context, err *errcode.Error, data ...interface{}) {
-	respJSONWith200(c, err.Code(), err.Msg(), data...)
+	respJSONWith200(c, err.Code(), err.MsgWithLanguage(errcode.GetLanguage(c)), data...)
+}
+
+// Fail 根据错误返回json数据，errcode.CodeError使用自身的http状态码和错误码，
+// grpc返回的错误从详情中还原，其他错误返回内部错误，错误信息根据请求的语言翻译
+func Fail(c *gin.Context, err error, data ...interface{}) {
+	e := errcode.Convert(err)
+	if e == nil {
+		Success(c, data...)
+		return
+	}
+	_ = c.Error(err)
+	e = e.Localize(errcode.GetLanguage(c))
+
+	var FirstData interface{}
+	if len(data) > 0 {
+		FirstData = data[0]
+	}
+	resp := newResp(e.Code(), e.Msg(), FirstData)
+
+	writeJSON(c, e.HTTPStatus(), resp)
+}
+
+// Negotiate 根据请求头Accept选择编码返回数据，例如application/json、application/msgpack、application/x-protobuf，
+// 没有匹配的编码时返回json
+func Negotiate(c *gin.Context, code int, obj interface{}) {
+	mimeType, e := encoding.Negotiate(c.GetHeader("Accept"))
+	data, err := e.Marshal(obj)
+	if err != nil {
+		_ = c.Error(err)
+		writeJSON(c, http.StatusInternalServerError, newResp(errcode.InternalServerError.Code(), errcode.InternalServerError.Msg(), nil))
+		return
+	}
+	c.Data(code, mimeType, data)
 }
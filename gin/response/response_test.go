@@ -1,11 +1,15 @@
 package response
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/zhufuyi/pkg/encoding"
 	"github.com/zhufuyi/pkg/errcode"
 	"github.com/zhufuyi/pkg/gohttp"
 	"github.com/zhufuyi/pkg/utils"
@@ -14,6 +18,8 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+var errUserNotFound = errcode.NewCodeError(20201, "user not found", errcode.WithHTTPStatus(http.StatusNotFound))
+
 var httpResponseCodes = []int{
 	http.StatusOK, http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden,
 	http.StatusNotFound, http.StatusRequestTimeout, http.StatusConflict, http.StatusInternalServerError,
@@ -26,6 +32,8 @@ func runResponseHTTPServer() string {
 	r := gin.Default()
 	r.GET("/success", func(c *gin.Context) { Success(c, gin.H{"foo": "bar"}) })
 	r.GET("/error", func(c *gin.Context) { Error(c, errcode.Unauthorized) })
+	r.GET("/fail", func(c *gin.Context) { Fail(c, errUserNotFound.WithCause(errors.New("record not found"))) })
+	r.GET("/fail/nil", func(c *gin.Context) { Fail(c, nil) })
 	for _, code := range httpResponseCodes {
 		code := code
 		r.GET(fmt.Sprintf("/code/%d", code), func(c *gin.Context) { Output(c, code) })
@@ -67,3 +75,48 @@ func TestRespond(t *testing.T) {
 		assert.Error(t, err)
 	}
 }
+
+func TestFail(t *testing.T) {
+	requestAddr := runResponseHTTPServer()
+
+	resp, err := http.Get(requestAddr + "/fail")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	e, err := errcode.FromHTTPResponse(resp.StatusCode, body)
+	assert.NoError(t, err)
+	assert.True(t, errors.Is(e, errUserNotFound))
+
+	result := &gohttp.StdResult{}
+	err = gohttp.Get(result, requestAddr+"/fail/nil")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, result.Code)
+}
+
+func TestNegotiate(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.GET("/negotiate", func(c *gin.Context) { Negotiate(c, http.StatusOK, gin.H{"foo": "bar"}) })
+	r.GET("/negotiate/error", func(c *gin.Context) { Negotiate(c, http.StatusOK, make(chan int)) })
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/negotiate", nil)
+	req.Header.Set("Accept", "application/msgpack, application/json;q=0.5")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, "application/msgpack", w.Header().Get("Content-Type"))
+	v := map[string]interface{}{}
+	assert.NoError(t, encoding.MsgPackEncoding{}.Unmarshal(w.Body.Bytes(), &v))
+	assert.Equal(t, "bar", v["foo"])
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/negotiate", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, encoding.MIMEJSON, w.Header().Get("Content-Type"))
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/negotiate/error", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
@@ -1,20 +1,25 @@
 package gocron
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"strings"
 	"sync"
-
-	"github.com/robfig/cron/v3"
+	"time"
 )
 
 var (
-	c      *cron.Cron
-	nameID = sync.Map{} // 任务名称和id映射，用在对任务的增删改查
-	idName = sync.Map{} // id和任务名称映射，用在日志打印
+	defaultScheduler *Scheduler // Init创建的默认调度器，包级别的函数都作用于默认调度器
+	defaultMutex     sync.RWMutex
+	nodeID           = getNodeID()
 )
 
+func getDefaultScheduler() *Scheduler {
+	defaultMutex.RLock()
+	defer defaultMutex.RUnlock()
+	return defaultScheduler
+}
+
 // Task 定时任务
 type Task struct {
 	// 秒(0-59) 分(0-59) 时(0-23) 日(1-31) 月(1-12) 星期(0-6)
@@ -23,91 +28,85 @@ type Task struct {
 	TimeSpec string
 
 	Name string // 任务名称
-	Fn   func() // 任务
+	Fn   func() // 任务，设置了Handler时忽略
+
+	Handler       func(ctx context.Context) error // 任务，ctx在超时后取消，返回错误时按重试次数重试
+	Timeout       time.Duration                   // 单次执行的超时时间，0表示不超时
+	RetryCount    int                             // 失败后的重试次数
+	RetryInterval time.Duration                   // 重试间隔
+	Overlap       OverlapPolicy                   // 上一次执行还没结束时的处理策略，默认并行执行
 }
 
 // Init 初始化和启动定时任务
 func Init(opts ...Option) error {
-	o := defaultOptions()
-	o.apply(opts...)
-
-	log := &myLog{zapLog: o.zapLog}
-	cronOpts := []cron.Option{
-		cron.WithSeconds(), // 秒级粒度，默认是分钟级别粒度
-		cron.WithLogger(log),
-		cron.WithChain(
-			cron.Recover(log), // or use cron.DefaultLogger
-		),
-	}
+	s := NewScheduler(opts...)
+	s.Start() // 启动定时器
 
-	c = cron.New(cronOpts...) // 实例化
-	c.Start()                 // 启动定时器
+	defaultMutex.Lock()
+	defaultScheduler = s
+	defaultMutex.Unlock()
 
 	return nil
 }
 
 // Run 添加新的任务
 func Run(tasks ...*Task) error {
-	if c == nil {
+	s := getDefaultScheduler()
+	if s == nil {
 		return errors.New("cron is not initialized")
 	}
-
-	var errs []string
-	for _, task := range tasks {
-		if IsRunningTask(task.Name) {
-			errs = append(errs, fmt.Sprintf("task '%s' is already exists", task.Name))
-			continue
-		}
-
-		id, err := c.AddFunc(task.TimeSpec, task.Fn)
-		if err != nil {
-			errs = append(errs, fmt.Sprintf("run task '%s' error: %v", task.Name, err))
-			continue
-		}
-		idName.Store(id, task.Name)
-		nameID.Store(task.Name, id)
-	}
-
-	if len(errs) > 0 {
-		return errors.New(strings.Join(errs, " || "))
-	}
-
-	return nil
+	return s.Run(tasks...)
 }
 
 // IsRunningTask 判断任务是运行
 func IsRunningTask(name string) bool {
-	_, ok := nameID.Load(name)
-	return ok
+	s := getDefaultScheduler()
+	if s == nil {
+		return false
+	}
+	return s.IsRunningTask(name)
 }
 
 // GetRunningTasks 获取正在运行的任务名称列表
 func GetRunningTasks() []string {
-	var names []string
-	nameID.Range(func(key, value interface{}) bool {
-		names = append(names, key.(string))
-		return true
-	})
-	return names
+	s := getDefaultScheduler()
+	if s == nil {
+		return nil
+	}
+	return s.GetRunningTasks()
 }
 
 // DeleteTask 删除任务
 func DeleteTask(name string) {
-	if id, ok := nameID.Load(name); ok {
-		entryID, isOk := id.(cron.EntryID)
-		if !isOk {
-			return
-		}
-		c.Remove(entryID) // 从定时器中删除
-		nameID.Delete(name)
-		idName.Delete(entryID)
+	s := getDefaultScheduler()
+	if s != nil {
+		s.DeleteTask(name)
+	}
+}
+
+// GetTaskHistory 获取任务的执行记录
+func GetTaskHistory(name string) (TaskHistory, bool) {
+	s := getDefaultScheduler()
+	if s == nil {
+		return TaskHistory{}, false
+	}
+	return s.GetTaskHistory(name)
+}
+
+// GetTaskHistories 获取所有任务的执行记录
+func GetTaskHistories() []TaskHistory {
+	s := getDefaultScheduler()
+	if s == nil {
+		return nil
 	}
+	return s.GetTaskHistories()
 }
 
 // Stop 停止定时任务
 func Stop() {
-	if c != nil {
-		c.Stop()
+	s := getDefaultScheduler()
+	if s != nil {
+		s.Stop()
 	}
 }
 
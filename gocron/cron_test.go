@@ -2,8 +2,15 @@ package gocron
 
 import (
 	"fmt"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/robfig/cron/v3"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestInitAndRun(t *testing.T) {
@@ -121,3 +128,101 @@ func TestEvery(t *testing.T) {
 
 	time.Sleep(time.Second * 7)
 }
+
+func TestSingleInstance(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+
+	sch := NewScheduler(WithLocker(NewRedisLocker(client)), WithLockTTL(time.Second*5))
+
+	count := 0
+	st := &scheduledTask{task: Task{Name: "singleTask"}, schedule: cron.Every(time.Hour)}
+	singleFn := sch.singleInstance(st, func(time.Time) {
+		count++
+	})
+	fn := func() {
+		singleFn(time.Now())
+	}
+	key := DefaultLockPrefix + "singleTask:" + strconv.FormatInt(time.Now().Truncate(time.Hour).Unix(), 10)
+
+	// 同一个周期只执行一次
+	fn()
+	fn()
+	assert.Equal(t, 1, count)
+	val, _ := s.Get(key)
+	assert.Equal(t, nodeID, val)
+	assert.True(t, s.TTL(key) >= time.Hour-time.Second)
+
+	// 其他实例获得锁，跳过执行
+	s.Del(key)
+	_ = s.Set(key, "other")
+	fn()
+	assert.Equal(t, 1, count)
+
+	// 获取锁失败，跳过执行
+	s.Close()
+	fn()
+	assert.Equal(t, 1, count)
+}
+
+func TestLockPeriod(t *testing.T) {
+	sch := NewScheduler(WithLockTTL(time.Second * 10))
+	now := time.Date(2023, 1, 1, 10, 0, 7, int(time.Millisecond*20), time.Local)
+
+	// 按秒对齐
+	spec, _ := specParser.Parse("*/2 * * * * *")
+	period, ttl := sch.lockPeriod(spec, now)
+	assert.Equal(t, time.Date(2023, 1, 1, 10, 0, 7, 0, time.Local), period)
+	assert.Equal(t, time.Second*10, ttl)
+
+	// 按间隔对齐
+	period, ttl = sch.lockPeriod(cron.Every(time.Minute), now)
+	assert.Equal(t, time.Date(2023, 1, 1, 10, 0, 0, 0, time.Local), period)
+	assert.Equal(t, time.Minute, ttl)
+	period, _ = sch.lockPeriod(cron.Every(time.Minute), now.Add(time.Second*50))
+	assert.Equal(t, time.Date(2023, 1, 1, 10, 0, 0, 0, time.Local), period)
+	period, _ = sch.lockPeriod(cron.Every(time.Minute), now.Add(time.Second*55))
+	assert.Equal(t, time.Date(2023, 1, 1, 10, 1, 0, 0, time.Local), period)
+}
+
+func TestRunWithLocker(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+
+	// 两个实例，执行间隔小于锁的过期时间，每个周期都执行且只执行一次
+	mu := sync.Mutex{}
+	counts := map[int64]int{}
+	for i := 0; i < 2; i++ {
+		sch := NewScheduler(WithLocker(NewRedisLocker(client)), WithLockPrefix("test:"), WithLockTTL(time.Second*10))
+		err = sch.Run(&Task{
+			Name:     "lockedTask",
+			TimeSpec: "* * * * * *",
+			Fn: func() {
+				mu.Lock()
+				counts[time.Now().Unix()]++
+				mu.Unlock()
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sch.Start()
+		defer sch.Stop()
+	}
+
+	time.Sleep(time.Millisecond * 3500)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.GreaterOrEqual(t, len(counts), 3)
+	for sec, n := range counts {
+		assert.Equal(t, 1, n, sec)
+	}
+}
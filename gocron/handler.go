@@ -0,0 +1,111 @@
+package gocron
+
+import (
+	"errors"
+
+	"github.com/zhufuyi/pkg/errcode"
+	"github.com/zhufuyi/pkg/gin/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterRoutes 注册默认调度器的管理接口，需要先调用Init
+func RegisterRoutes(group *gin.RouterGroup) {
+	registerRoutes(group, getDefaultScheduler)
+}
+
+// RegisterRoutes 注册调度器的管理接口，查看任务列表和执行记录，暂停、恢复和立即执行任务
+//
+//	GET  /tasks               任务列表，包括下一次和上一次执行时间
+//	GET  /tasks/:name         任务信息和执行记录
+//	POST /tasks/:name/pause   暂停任务
+//	POST /tasks/:name/resume  恢复任务
+//	POST /tasks/:name/trigger 立即执行一次任务
+func (s *Scheduler) RegisterRoutes(group *gin.RouterGroup) {
+	registerRoutes(group, func() *Scheduler { return s })
+}
+
+func registerRoutes(group *gin.RouterGroup, getScheduler func() *Scheduler) {
+	h := &taskHandler{getScheduler: getScheduler}
+	group.GET("/tasks", h.list)
+	group.GET("/tasks/:name", h.get)
+	group.POST("/tasks/:name/pause", h.pause)
+	group.POST("/tasks/:name/resume", h.resume)
+	group.POST("/tasks/:name/trigger", h.trigger)
+}
+
+type taskHandler struct {
+	getScheduler func() *Scheduler
+}
+
+func (h *taskHandler) scheduler(c *gin.Context) (*Scheduler, bool) {
+	s := h.getScheduler()
+	if s == nil {
+		response.Error(c, errcode.ServiceUnavailable)
+		return nil, false
+	}
+	return s, true
+}
+
+func (h *taskHandler) list(c *gin.Context) {
+	s, ok := h.scheduler(c)
+	if !ok {
+		return
+	}
+	response.Success(c, gin.H{"tasks": s.GetTaskInfos()})
+}
+
+func (h *taskHandler) get(c *gin.Context) {
+	s, ok := h.scheduler(c)
+	if !ok {
+		return
+	}
+	name := c.Param("name")
+	info, err := s.GetTaskInfo(name)
+	if err != nil {
+		h.error(c, err)
+		return
+	}
+	history, _ := s.GetTaskHistory(name)
+	response.Success(c, gin.H{"task": info, "history": history})
+}
+
+func (h *taskHandler) pause(c *gin.Context) {
+	s, ok := h.scheduler(c)
+	if !ok {
+		return
+	}
+	h.result(c, s.Pause(c.Param("name")))
+}
+
+func (h *taskHandler) resume(c *gin.Context) {
+	s, ok := h.scheduler(c)
+	if !ok {
+		return
+	}
+	h.result(c, s.Resume(c.Param("name")))
+}
+
+func (h *taskHandler) trigger(c *gin.Context) {
+	s, ok := h.scheduler(c)
+	if !ok {
+		return
+	}
+	h.result(c, s.TriggerNow(c.Param("name")))
+}
+
+func (h *taskHandler) result(c *gin.Context, err error) {
+	if err != nil {
+		h.error(c, err)
+		return
+	}
+	response.Success(c)
+}
+
+func (h *taskHandler) error(c *gin.Context, err error) {
+	if errors.Is(err, ErrTaskNotFound) {
+		response.Error(c, errcode.NotFound)
+		return
+	}
+	response.Error(c, errcode.InternalServerError)
+}
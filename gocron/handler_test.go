@@ -0,0 +1,57 @@
+package gocron
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/zhufuyi/pkg/errcode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func doRequest(r http.Handler, method string, path string) (int, map[string]interface{}) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, nil)
+	r.ServeHTTP(w, req)
+	result := map[string]interface{}{}
+	_ = json.Unmarshal(w.Body.Bytes(), &result)
+	return int(result["code"].(float64)), result
+}
+
+func TestRegisterRoutes(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	s := NewScheduler()
+	s.Start()
+	defer s.Stop()
+	err := s.Run(&Task{Name: "task", TimeSpec: "@every 1h", Fn: func() {}})
+	assert.NoError(t, err)
+
+	r := gin.New()
+	s.RegisterRoutes(r.Group("/admin/cron"))
+
+	code, result := doRequest(r, http.MethodGet, "/admin/cron/tasks")
+	assert.Equal(t, 0, code)
+	tasks := result["data"].(map[string]interface{})["tasks"].([]interface{})
+	assert.Equal(t, 1, len(tasks))
+
+	code, _ = doRequest(r, http.MethodPost, "/admin/cron/tasks/task/pause")
+	assert.Equal(t, 0, code)
+	info, _ := s.GetTaskInfo("task")
+	assert.True(t, info.Paused)
+
+	code, _ = doRequest(r, http.MethodPost, "/admin/cron/tasks/task/resume")
+	assert.Equal(t, 0, code)
+
+	code, _ = doRequest(r, http.MethodPost, "/admin/cron/tasks/task/trigger")
+	assert.Equal(t, 0, code)
+
+	code, result = doRequest(r, http.MethodGet, "/admin/cron/tasks/task")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "task", result["data"].(map[string]interface{})["task"].(map[string]interface{})["name"])
+
+	code, _ = doRequest(r, http.MethodPost, "/admin/cron/tasks/not_exist/pause")
+	assert.Equal(t, errcode.NotFound.Code(), code)
+}
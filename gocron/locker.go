@@ -0,0 +1,77 @@
+package gocron
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// Locker 分布式锁，多实例部署时保证同一个任务在每个周期只有一个实例执行，
+// 获得锁的实例执行任务，锁在ttl后自动过期，不主动释放，防止其他实例因时钟误差在同一周期重复执行
+type Locker interface {
+	// TryLock 尝试获取锁，value为当前实例标识，获取成功返回true
+	TryLock(ctx context.Context, key string, value string, ttl time.Duration) (bool, error)
+}
+
+type redisLocker struct {
+	client *redis.Client
+}
+
+// NewRedisLocker create a locker based on redis
+func NewRedisLocker(client *redis.Client) Locker {
+	return &redisLocker{client: client}
+}
+
+// TryLock set key if not exists
+func (l *redisLocker) TryLock(ctx context.Context, key string, value string, ttl time.Duration) (bool, error) {
+	ok, err := l.client.SetNX(ctx, key, value, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("l.client.SetNX error: %v, key=%s", err, key)
+	}
+	return ok, nil
+}
+
+type etcdLocker struct {
+	client *clientv3.Client
+}
+
+// NewEtcdLocker create a locker based on etcd
+func NewEtcdLocker(client *clientv3.Client) Locker {
+	return &etcdLocker{client: client}
+}
+
+// TryLock put key with lease if not exists
+func (l *etcdLocker) TryLock(ctx context.Context, key string, value string, ttl time.Duration) (bool, error) {
+	seconds := int64(ttl / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	lease, err := l.client.Grant(ctx, seconds)
+	if err != nil {
+		return false, fmt.Errorf("l.client.Grant error: %v, key=%s", err, key)
+	}
+
+	resp, err := l.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, value, clientv3.WithLease(lease.ID))).
+		Commit()
+	if err != nil {
+		_, _ = l.client.Revoke(context.Background(), lease.ID)
+		return false, fmt.Errorf("l.client.Txn error: %v, key=%s", err, key)
+	}
+	if !resp.Succeeded {
+		_, _ = l.client.Revoke(context.Background(), lease.ID)
+		return false, nil
+	}
+	return true, nil
+}
+
+// 当前实例标识，主机名:进程id
+func getNodeID() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d", hostname, os.Getpid())
+}
@@ -1,6 +1,8 @@
 package gocron
 
 import (
+	"sync"
+
 	"github.com/zhufuyi/pkg/logger"
 
 	"github.com/robfig/cron/v3"
@@ -9,6 +11,7 @@ import (
 
 type myLog struct {
 	zapLog *zap.Logger
+	idName *sync.Map // id和任务名称映射
 }
 
 func (l *myLog) Info(msg string, keysAndValues ...interface{}) {
@@ -16,7 +19,7 @@ func (l *myLog) Info(msg string, keysAndValues ...interface{}) {
 		return
 	}
 	msg = "cron_" + msg
-	fields := parseKVs(keysAndValues)
+	fields := parseKVs(keysAndValues, l.idName)
 	if l.zapLog != nil {
 		l.zapLog.Info(msg, fields...)
 	} else {
@@ -24,7 +27,7 @@ func (l *myLog) Info(msg string, keysAndValues ...interface{}) {
 	}
 }
 func (l *myLog) Error(err error, msg string, keysAndValues ...interface{}) {
-	fields := parseKVs(keysAndValues)
+	fields := parseKVs(keysAndValues, l.idName)
 	fields = append(fields, zap.String("err", err.Error()))
 	msg = "cron_" + msg
 	if l.zapLog != nil {
@@ -34,7 +37,7 @@ func (l *myLog) Error(err error, msg string, keysAndValues ...interface{}) {
 	}
 }
 
-func parseKVs(kvs interface{}) []zap.Field {
+func parseKVs(kvs interface{}, idName *sync.Map) []zap.Field {
 	var fields []zap.Field
 
 	infos, ok := kvs.([]interface{})
@@ -53,7 +56,7 @@ func parseKVs(kvs interface{}) []zap.Field {
 
 		// 把id替换为任务名称
 		if key == "entry" {
-			if id, ok := value.(cron.EntryID); ok {
+			if id, ok := value.(cron.EntryID); ok && idName != nil {
 				key = "task"
 				if v, isExist := idName.Load(id); isExist {
 					value = v
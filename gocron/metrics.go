@@ -0,0 +1,45 @@
+package gocron
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	metricsNamespace = "gocron"
+
+	taskRuns = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "task_runs_total",
+			Help:      "Total number of task runs.",
+		}, []string{"task"},
+	)
+
+	taskFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "task_failures_total",
+			Help:      "Total number of failed task runs.",
+		}, []string{"task"},
+	)
+
+	taskDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "task_duration_seconds",
+			Help:      "Task run latencies in seconds, including retries.",
+			Buckets:   []float64{.01, .05, .1, .5, 1, 5, 10, 30, 60, 300, 600},
+		}, []string{"task"},
+	)
+
+	registerOnce sync.Once
+)
+
+// registers the prometheus metrics
+func registerMetrics(registerer prometheus.Registerer) {
+	registerOnce.Do(func() {
+		registerer.MustRegister(taskRuns, taskFailures, taskDuration)
+	})
+}
@@ -1,16 +1,34 @@
 package gocron
 
 import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
 )
 
+var (
+	// DefaultLockTTL 分布式锁默认过期时间
+	DefaultLockTTL = time.Second * 10
+	// DefaultLockPrefix 分布式锁key的默认前缀
+	DefaultLockPrefix = "gocron:lock:"
+)
+
 type options struct {
-	zapLog *zap.Logger
+	zapLog     *zap.Logger
+	registerer prometheus.Registerer
+
+	locker     Locker
+	lockTTL    time.Duration
+	lockPrefix string
 }
 
 func defaultOptions() *options {
 	return &options{
-		zapLog: nil,
+		zapLog:     nil,
+		registerer: prometheus.DefaultRegisterer,
+		lockTTL:    DefaultLockTTL,
+		lockPrefix: DefaultLockPrefix,
 	}
 }
 
@@ -29,3 +47,33 @@ func WithLog(log *zap.Logger) Option {
 		o.zapLog = log
 	}
 }
+
+// WithRegisterer 设置prometheus指标的注册器，指标只注册一次，默认是prometheus.DefaultRegisterer
+func WithRegisterer(registerer prometheus.Registerer) Option {
+	return func(o *options) {
+		o.registerer = registerer
+	}
+}
+
+// WithLocker 设置分布式锁，多实例部署时每个任务在每个周期只有一个实例执行
+func WithLocker(locker Locker) Option {
+	return func(o *options) {
+		o.locker = locker
+	}
+}
+
+// WithLockTTL 设置分布式锁的过期时间，应大于实例之间的时钟误差，每个周期的锁不同，不需要小于任务的执行间隔，默认10秒
+func WithLockTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		if ttl > 0 {
+			o.lockTTL = ttl
+		}
+	}
+}
+
+// WithLockPrefix 设置分布式锁key的前缀，默认gocron:lock:
+func WithLockPrefix(prefix string) Option {
+	return func(o *options) {
+		o.lockPrefix = prefix
+	}
+}
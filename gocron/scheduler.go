@@ -0,0 +1,375 @@
+package gocron
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// ErrTaskNotFound 任务不存在
+var ErrTaskNotFound = errors.New("task not found")
+
+// 和cron.WithSeconds()一致，秒级粒度，秒可以省略
+var specParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// TaskInfo 任务信息
+type TaskInfo struct {
+	Name     string    `json:"name"`     // 任务名称
+	TimeSpec string    `json:"timeSpec"` // 定时规则
+	Paused   bool      `json:"paused"`   // 是否暂停
+	Next     time.Time `json:"next"`     // 下一次执行时间，暂停时为零值
+	Prev     time.Time `json:"prev"`     // 上一次执行时间，没有执行过时为零值
+}
+
+type scheduledTask struct {
+	task     Task
+	job      cron.Job
+	id       cron.EntryID
+	schedule cron.Schedule // 当前的定时规则，用于计算分布式锁的周期
+	paused   bool
+}
+
+// Scheduler 定时任务调度器，每个调度器有独立的定时器、任务和执行记录
+type Scheduler struct {
+	cron *cron.Cron
+	log  *myLog
+	opts *options
+
+	mutex  sync.RWMutex
+	tasks  map[string]*scheduledTask
+	idName *sync.Map // id和任务名称映射，用在日志打印
+
+	histories sync.Map // 任务名称和执行记录映射
+
+	leaderMutex sync.Mutex
+	leaders     map[string]bool // 任务名称和当前实例是否为执行者的映射，用在打印执行者变化的日志
+}
+
+// NewScheduler 实例化调度器，调用Start启动
+func NewScheduler(opts ...Option) *Scheduler {
+	o := defaultOptions()
+	o.apply(opts...)
+	registerMetrics(o.registerer)
+
+	idName := &sync.Map{}
+	log := &myLog{zapLog: o.zapLog, idName: idName}
+	cronOpts := []cron.Option{
+		cron.WithSeconds(), // 秒级粒度，默认是分钟级别粒度
+		cron.WithLogger(log),
+		cron.WithChain(
+			cron.Recover(log), // or use cron.DefaultLogger
+		),
+	}
+
+	return &Scheduler{
+		cron:    cron.New(cronOpts...),
+		log:     log,
+		opts:    o,
+		tasks:   make(map[string]*scheduledTask),
+		idName:  idName,
+		leaders: make(map[string]bool),
+	}
+}
+
+// Start 启动定时器
+func (s *Scheduler) Start() {
+	s.cron.Start()
+}
+
+// Stop 停止定时器，不等待正在执行的任务
+func (s *Scheduler) Stop() {
+	s.cron.Stop()
+}
+
+// Run 添加新的任务
+func (s *Scheduler) Run(tasks ...*Task) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var errs []string
+	for _, task := range tasks {
+		if _, ok := s.tasks[task.Name]; ok {
+			errs = append(errs, fmt.Sprintf("task '%s' is already exists", task.Name))
+			continue
+		}
+
+		if task.Fn == nil && task.Handler == nil {
+			errs = append(errs, fmt.Sprintf("task '%s' fn is nil", task.Name))
+			continue
+		}
+
+		st := &scheduledTask{task: *task}
+		st.job = s.newJob(st)
+		id, err := s.cron.AddJob(task.TimeSpec, st.job)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("run task '%s' error: %v", task.Name, err))
+			continue
+		}
+		st.id = id
+		st.schedule = s.cron.Entry(id).Schedule
+		s.idName.Store(id, task.Name)
+		s.tasks[task.Name] = st
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, " || "))
+	}
+
+	return nil
+}
+
+// IsRunningTask 判断任务是否存在，暂停的任务也返回true
+func (s *Scheduler) IsRunningTask(name string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	_, ok := s.tasks[name]
+	return ok
+}
+
+// GetRunningTasks 获取任务名称列表
+func (s *Scheduler) GetRunningTasks() []string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	names := make([]string, 0, len(s.tasks))
+	for name := range s.tasks {
+		names = append(names, name)
+	}
+	return names
+}
+
+// DeleteTask 删除任务
+func (s *Scheduler) DeleteTask(name string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	st, ok := s.tasks[name]
+	if !ok {
+		return
+	}
+	if !st.paused {
+		s.cron.Remove(st.id) // 从定时器中删除
+	}
+	s.idName.Delete(st.id)
+	delete(s.tasks, name)
+	s.histories.Delete(name)
+}
+
+// Pause 暂停任务，任务从定时器中移除，正在执行的任务不受影响
+func (s *Scheduler) Pause(name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	st, ok := s.tasks[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTaskNotFound, name)
+	}
+	if st.paused {
+		return nil
+	}
+	s.cron.Remove(st.id)
+	s.idName.Delete(st.id)
+	st.paused = true
+	return nil
+}
+
+// Resume 恢复暂停的任务
+func (s *Scheduler) Resume(name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	st, ok := s.tasks[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTaskNotFound, name)
+	}
+	if !st.paused {
+		return nil
+	}
+	return s.schedule(st, st.task.TimeSpec)
+}
+
+// UpdateSpec 修改任务的定时规则，暂停的任务在恢复后使用新的定时规则
+func (s *Scheduler) UpdateSpec(name string, spec string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	st, ok := s.tasks[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTaskNotFound, name)
+	}
+	if _, err := specParser.Parse(spec); err != nil {
+		return fmt.Errorf("parse spec '%s' error: %v", spec, err)
+	}
+
+	if st.paused {
+		st.task.TimeSpec = spec
+		return nil
+	}
+	s.cron.Remove(st.id)
+	s.idName.Delete(st.id)
+	return s.schedule(st, spec)
+}
+
+// 把任务重新加入定时器
+func (s *Scheduler) schedule(st *scheduledTask, spec string) error {
+	schedule, err := specParser.Parse(spec)
+	if err != nil {
+		return fmt.Errorf("parse spec '%s' error: %v", spec, err)
+	}
+	st.id = s.cron.Schedule(schedule, st.job)
+	st.schedule = schedule
+	st.task.TimeSpec = spec
+	st.paused = false
+	s.idName.Store(st.id, st.task.Name)
+	return nil
+}
+
+// TriggerNow 立即执行一次任务，不影响定时规则，暂停的任务也可以执行
+func (s *Scheduler) TriggerNow(name string) error {
+	s.mutex.RLock()
+	st, ok := s.tasks[name]
+	s.mutex.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTaskNotFound, name)
+	}
+
+	go func() {
+		defer func() {
+			if e := recover(); e != nil {
+				s.log.Error(fmt.Errorf("%v", e), "panic", "task", name)
+			}
+		}()
+		st.job.Run()
+	}()
+	return nil
+}
+
+// NextRun 获取任务下一次执行时间，暂停的任务返回零值
+func (s *Scheduler) NextRun(name string) (time.Time, error) {
+	info, err := s.GetTaskInfo(name)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.Next, nil
+}
+
+// GetTaskInfo 获取任务信息
+func (s *Scheduler) GetTaskInfo(name string) (*TaskInfo, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	st, ok := s.tasks[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTaskNotFound, name)
+	}
+	return s.taskInfo(st), nil
+}
+
+// GetTaskInfos 获取所有任务信息，按任务名称排序
+func (s *Scheduler) GetTaskInfos() []*TaskInfo {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	infos := make([]*TaskInfo, 0, len(s.tasks))
+	for _, st := range s.tasks {
+		infos = append(infos, s.taskInfo(st))
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+func (s *Scheduler) taskInfo(st *scheduledTask) *TaskInfo {
+	info := &TaskInfo{
+		Name:     st.task.Name,
+		TimeSpec: st.task.TimeSpec,
+		Paused:   st.paused,
+	}
+	if h, ok := s.GetTaskHistory(st.task.Name); ok {
+		info.Prev = h.LastStart
+	}
+	if !st.paused {
+		info.Next = s.cron.Entry(st.id).Next
+	}
+	return info
+}
+
+// newJob 把任务包装为cron job，依次处理重叠执行策略、分布式锁、超时和重试
+func (s *Scheduler) newJob(st *scheduledTask) cron.Job {
+	t := st.task
+	handler := t.getHandler()
+	fn := func(time.Time) {
+		s.execute(&t, handler)
+	}
+	if s.opts.locker != nil {
+		fn = s.singleInstance(st, fn)
+	}
+
+	// 重叠执行的槽位，execute在超时的任务真正返回后才返回，超时的任务继续占用槽位
+	slot := make(chan struct{}, 1)
+	return cron.FuncJob(func() {
+		firedAt := time.Now() // 排队等待前的触发时间，用于计算分布式锁的周期
+		switch t.Overlap {
+		case OverlapSkip:
+			select {
+			case slot <- struct{}{}:
+			default:
+				s.log.Info("skip", "task", t.Name, "reason", "still running")
+				return
+			}
+			defer func() { <-slot }()
+		case OverlapQueue:
+			slot <- struct{}{}
+			defer func() { <-slot }()
+		}
+		fn(firedAt)
+	})
+}
+
+// singleInstance 获得分布式锁的实例才执行任务，锁的key包括任务名称和本次执行所属的周期，
+// 每个周期的锁都不同，执行间隔小于锁的过期时间也不会跳过执行
+func (s *Scheduler) singleInstance(st *scheduledTask, fn func(firedAt time.Time)) func(firedAt time.Time) {
+	name := st.task.Name
+	return func(firedAt time.Time) {
+		s.mutex.RLock()
+		schedule := st.schedule
+		s.mutex.RUnlock()
+
+		period, ttl := s.lockPeriod(schedule, firedAt)
+		key := s.opts.lockPrefix + name + ":" + strconv.FormatInt(period.Unix(), 10)
+		ok, err := s.opts.locker.TryLock(context.Background(), key, nodeID, ttl)
+		if err != nil {
+			s.log.Error(err, "lock", "task", name, "node", nodeID)
+			return
+		}
+
+		s.leaderMutex.Lock()
+		wasLeader := s.leaders[name]
+		s.leaders[name] = ok
+		s.leaderMutex.Unlock()
+
+		if ok != wasLeader {
+			s.log.Info("leader_changed", "task", name, "node", nodeID, "leader", ok)
+		}
+		if !ok {
+			s.log.Info("skip", "task", name, "node", nodeID, "reason", "locked by other instance")
+			return
+		}
+
+		fn(firedAt)
+	}
+}
+
+// lockPeriod 本次执行所属的周期和锁的过期时间，同一周期各个实例的锁key相同，
+// @every按间隔对齐(各实例的启动时间不同)，其他规则按秒对齐(各实例在自己时钟的同一秒触发)
+func (s *Scheduler) lockPeriod(schedule cron.Schedule, now time.Time) (time.Time, time.Duration) {
+	ttl := s.opts.lockTTL
+	if cd, ok := schedule.(cron.ConstantDelaySchedule); ok && cd.Delay > time.Second {
+		if cd.Delay > ttl {
+			ttl = cd.Delay
+		}
+		return now.Truncate(cd.Delay), ttl
+	}
+	return now.Truncate(time.Second), ttl
+}
@@ -0,0 +1,78 @@
+package gocron
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduler(t *testing.T) {
+	s := NewScheduler()
+	s.Start()
+	defer s.Stop()
+
+	var count int32
+	err := s.Run(&Task{
+		Name:     "task",
+		TimeSpec: "@every 1s",
+		Fn: func() {
+			atomic.AddInt32(&count, 1)
+		},
+	})
+	assert.NoError(t, err)
+	assert.True(t, s.IsRunningTask("task"))
+	assert.Equal(t, []string{"task"}, s.GetRunningTasks())
+
+	// 调度器之间互不影响
+	s2 := NewScheduler()
+	assert.False(t, s2.IsRunningTask("task"))
+	assert.NoError(t, s2.Run(&Task{Name: "task", TimeSpec: "@every 1s", Fn: func() {}}))
+
+	next, err := s.NextRun("task")
+	assert.NoError(t, err)
+	assert.True(t, next.After(time.Now()))
+
+	// 暂停后不再执行
+	assert.NoError(t, s.Pause("task"))
+	next, _ = s.NextRun("task")
+	assert.True(t, next.IsZero())
+	time.Sleep(time.Millisecond * 1500)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&count))
+
+	// 暂停时也可以立即执行
+	assert.NoError(t, s.TriggerNow("task"))
+	time.Sleep(time.Millisecond * 100)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&count))
+	info, err := s.GetTaskInfo("task")
+	assert.NoError(t, err)
+	assert.True(t, info.Paused)
+	assert.False(t, info.Prev.IsZero())
+
+	// 暂停时修改定时规则，恢复后使用新的定时规则
+	assert.NoError(t, s.UpdateSpec("task", "@every 1h"))
+	assert.NoError(t, s.Resume("task"))
+	next, _ = s.NextRun("task")
+	assert.True(t, next.After(time.Now().Add(time.Minute*59)))
+
+	// 修改定时规则
+	assert.NoError(t, s.UpdateSpec("task", "*/1 * * * * *"))
+	next, _ = s.NextRun("task")
+	assert.True(t, next.Before(time.Now().Add(time.Second*2)))
+	time.Sleep(time.Millisecond * 1500)
+	assert.GreaterOrEqual(t, atomic.LoadInt32(&count), int32(2))
+	assert.Equal(t, "*/1 * * * * *", s.GetTaskInfos()[0].TimeSpec)
+
+	assert.Error(t, s.UpdateSpec("task", "invalid spec"))
+	assert.True(t, errors.Is(s.Pause("not_exist"), ErrTaskNotFound))
+	assert.True(t, errors.Is(s.Resume("not_exist"), ErrTaskNotFound))
+	assert.True(t, errors.Is(s.TriggerNow("not_exist"), ErrTaskNotFound))
+	_, err = s.NextRun("not_exist")
+	assert.True(t, errors.Is(err, ErrTaskNotFound))
+
+	s.DeleteTask("task")
+	assert.False(t, s.IsRunningTask("task"))
+	assert.Equal(t, 0, len(s.GetTaskInfos()))
+}
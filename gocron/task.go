@@ -0,0 +1,178 @@
+package gocron
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// OverlapPolicy 上一次执行还没结束时，新一次执行的处理策略
+type OverlapPolicy int
+
+const (
+	// OverlapAllow 并行执行(默认)
+	OverlapAllow OverlapPolicy = iota
+	// OverlapSkip 跳过本次执行
+	OverlapSkip
+	// OverlapQueue 等待上一次执行结束后再执行
+	OverlapQueue
+)
+
+// TaskHistory 任务的执行记录
+type TaskHistory struct {
+	Name         string        `json:"name"`         // 任务名称
+	LastStart    time.Time     `json:"lastStart"`    // 最近一次开始执行时间
+	LastDuration time.Duration `json:"lastDuration"` // 最近一次执行耗时，包括重试
+	LastError    string        `json:"lastError"`    // 最近一次执行的错误，成功时为空
+	RunCount     uint64        `json:"runCount"`     // 执行次数
+	FailCount    uint64        `json:"failCount"`    // 失败次数
+}
+
+type taskHistory struct {
+	mutex sync.RWMutex
+	TaskHistory
+}
+
+func (s *Scheduler) getTaskHistory(name string) *taskHistory {
+	h, _ := s.histories.LoadOrStore(name, &taskHistory{TaskHistory: TaskHistory{Name: name}})
+	return h.(*taskHistory)
+}
+
+func (h *taskHistory) start(t time.Time) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.LastStart = t
+}
+
+func (h *taskHistory) finish(d time.Duration, err error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.LastDuration = d
+	h.RunCount++
+	h.LastError = ""
+	if err != nil {
+		h.FailCount++
+		h.LastError = err.Error()
+	}
+}
+
+func (h *taskHistory) get() TaskHistory {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return h.TaskHistory
+}
+
+// GetTaskHistory 获取任务的执行记录
+func (s *Scheduler) GetTaskHistory(name string) (TaskHistory, bool) {
+	h, ok := s.histories.Load(name)
+	if !ok {
+		return TaskHistory{}, false
+	}
+	return h.(*taskHistory).get(), true
+}
+
+// GetTaskHistories 获取所有任务的执行记录，按任务名称排序
+func (s *Scheduler) GetTaskHistories() []TaskHistory {
+	var list []TaskHistory
+	s.histories.Range(func(key, value interface{}) bool {
+		list = append(list, value.(*taskHistory).get())
+		return true
+	})
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// 获取任务的执行函数，兼容没有context和error的Fn
+func (t *Task) getHandler() func(ctx context.Context) error {
+	if t.Handler != nil {
+		return t.Handler
+	}
+	fn := t.Fn
+	return func(ctx context.Context) error {
+		fn()
+		return nil
+	}
+}
+
+// 执行任务，失败时按重试次数重试，记录执行记录和指标，
+// 超时的执行真正返回后才重试或返回，保证同一次执行的多次尝试不会同时运行
+func (s *Scheduler) execute(task *Task, handler func(ctx context.Context) error) {
+	h := s.getTaskHistory(task.Name)
+	start := time.Now()
+	h.start(start)
+
+	var err error
+	var exited <-chan struct{}
+	for i := 0; i <= task.RetryCount; i++ {
+		if i > 0 {
+			s.waitExited(task.Name, exited)
+			if task.RetryInterval > 0 {
+				time.Sleep(task.RetryInterval)
+			}
+			s.log.Info("retry", "task", task.Name, "attempt", i, "lastErr", err.Error())
+		}
+		exited, err = callWithTimeout(handler, task.Timeout)
+		if err == nil {
+			break
+		}
+	}
+
+	duration := time.Since(start)
+	h.finish(duration, err)
+	taskRuns.WithLabelValues(task.Name).Inc()
+	taskDuration.WithLabelValues(task.Name).Observe(duration.Seconds())
+	if err != nil {
+		taskFailures.WithLabelValues(task.Name).Inc()
+		s.log.Error(err, "run", "task", task.Name, "duration", duration.String())
+	}
+
+	// 超时后仍在运行的任务返回后才结束本次执行，重叠执行策略的槽位一直被占用
+	s.waitExited(task.Name, exited)
+}
+
+// 等待超时的任务返回，exited为nil表示任务已经返回
+func (s *Scheduler) waitExited(name string, exited <-chan struct{}) {
+	if exited == nil {
+		return
+	}
+	<-exited
+	s.log.Info("timeout_exited", "task", name)
+}
+
+// 超时后返回错误，不再等待任务返回，任务需要根据ctx自行退出，
+// 超时时返回的exited在任务真正返回后关闭，没有超时时为nil
+func callWithTimeout(handler func(ctx context.Context) error, timeout time.Duration) (<-chan struct{}, error) {
+	if timeout <= 0 {
+		return nil, call(context.Background(), handler)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		done <- call(ctx, handler)
+	}()
+
+	select {
+	case err := <-done:
+		return nil, err
+	case <-ctx.Done():
+		return exited, fmt.Errorf("task timeout after %s: %w", timeout, ctx.Err())
+	}
+}
+
+// 把panic转换为错误
+func call(ctx context.Context, handler func(ctx context.Context) error) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("panic: %v", e)
+		}
+	}()
+	return handler(ctx)
+}
@@ -0,0 +1,166 @@
+package gocron
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecute(t *testing.T) {
+	sch := NewScheduler(WithRegisterer(prometheus.NewRegistry()))
+
+	// 失败后重试
+	var count int32
+	task := &Task{
+		Name:          "retryTask",
+		RetryCount:    2,
+		RetryInterval: time.Millisecond * 10,
+		Handler: func(ctx context.Context) error {
+			if atomic.AddInt32(&count, 1) < 3 {
+				return errors.New("mock error")
+			}
+			return nil
+		},
+	}
+	sch.execute(task, task.getHandler())
+	assert.Equal(t, int32(3), atomic.LoadInt32(&count))
+	h, ok := sch.GetTaskHistory("retryTask")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1), h.RunCount)
+	assert.Equal(t, uint64(0), h.FailCount)
+	assert.Equal(t, "", h.LastError)
+	assert.Greater(t, h.LastDuration, time.Millisecond*20)
+
+	// 超时
+	task = &Task{
+		Name:    "timeoutTask",
+		Timeout: time.Millisecond * 50,
+		Handler: func(ctx context.Context) error {
+			<-ctx.Done()
+			time.Sleep(time.Millisecond * 100)
+			return nil
+		},
+	}
+	start := time.Now()
+	sch.execute(task, task.getHandler())
+	assert.GreaterOrEqual(t, time.Since(start), time.Millisecond*150) // 等待超时的任务返回
+	h, _ = sch.GetTaskHistory("timeoutTask")
+	assert.Equal(t, uint64(1), h.FailCount)
+	assert.Contains(t, h.LastError, "timeout")
+	assert.Less(t, h.LastDuration, time.Millisecond*100)
+
+	// 超时的任务返回后才重试
+	var running, maxRunning int32
+	count = 0
+	task = &Task{
+		Name:       "timeoutRetryTask",
+		Timeout:    time.Millisecond * 20,
+		RetryCount: 2,
+		Handler: func(ctx context.Context) error {
+			atomic.AddInt32(&count, 1)
+			n := atomic.AddInt32(&running, 1)
+			if n > atomic.LoadInt32(&maxRunning) {
+				atomic.StoreInt32(&maxRunning, n)
+			}
+			time.Sleep(time.Millisecond * 50) // 不处理ctx
+			atomic.AddInt32(&running, -1)
+			return nil
+		},
+	}
+	sch.execute(task, task.getHandler())
+	assert.Equal(t, int32(3), atomic.LoadInt32(&count))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&maxRunning))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&running))
+
+	// panic转换为错误
+	task = &Task{
+		Name: "panicTask",
+		Fn: func() {
+			panic("mock panic")
+		},
+	}
+	sch.execute(task, task.getHandler())
+	h, _ = sch.GetTaskHistory("panicTask")
+	assert.Equal(t, "panic: mock panic", h.LastError)
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(taskRuns.WithLabelValues("panicTask")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(taskFailures.WithLabelValues("timeoutTask")))
+	assert.Equal(t, float64(0), testutil.ToFloat64(taskFailures.WithLabelValues("retryTask")))
+	assert.GreaterOrEqual(t, len(sch.GetTaskHistories()), 3)
+}
+
+func TestOverlap(t *testing.T) {
+	err := Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Stop()
+
+	var skipCount, queueCount, queueRunning, maxQueueRunning int32
+	var timeoutCount, timeoutRunning, maxTimeoutRunning int32
+	err = Run(
+		&Task{
+			Name:     "skipTask",
+			TimeSpec: "@every 1s",
+			Overlap:  OverlapSkip,
+			Handler: func(ctx context.Context) error {
+				atomic.AddInt32(&skipCount, 1)
+				time.Sleep(time.Second * 10)
+				return nil
+			},
+		},
+		&Task{
+			Name:     "queueTask",
+			TimeSpec: "@every 1s",
+			Overlap:  OverlapQueue,
+			Handler: func(ctx context.Context) error {
+				atomic.AddInt32(&queueCount, 1)
+				n := atomic.AddInt32(&queueRunning, 1)
+				if n > atomic.LoadInt32(&maxQueueRunning) {
+					atomic.StoreInt32(&maxQueueRunning, n)
+				}
+				time.Sleep(time.Millisecond * 1500)
+				atomic.AddInt32(&queueRunning, -1)
+				return nil
+			},
+		},
+		&Task{
+			Name:     "timeoutSkipTask",
+			TimeSpec: "@every 1s",
+			Overlap:  OverlapSkip,
+			Timeout:  time.Millisecond * 100,
+			Handler: func(ctx context.Context) error {
+				atomic.AddInt32(&timeoutCount, 1)
+				n := atomic.AddInt32(&timeoutRunning, 1)
+				if n > atomic.LoadInt32(&maxTimeoutRunning) {
+					atomic.StoreInt32(&maxTimeoutRunning, n)
+				}
+				time.Sleep(time.Millisecond * 1500) // 超时后不退出
+				atomic.AddInt32(&timeoutRunning, -1)
+				return nil
+			},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Millisecond * 3500)
+	// 上一次执行没有结束，跳过后面的执行
+	assert.Equal(t, int32(1), atomic.LoadInt32(&skipCount))
+	// 排队执行，同时只有一个在执行
+	assert.GreaterOrEqual(t, atomic.LoadInt32(&queueCount), int32(2))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&maxQueueRunning))
+	// 超时的任务没有返回前仍然占用槽位，不会和下一次执行重叠
+	assert.GreaterOrEqual(t, atomic.LoadInt32(&timeoutCount), int32(1))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&maxTimeoutRunning))
+
+	err = Run(&Task{Name: "nilTask", TimeSpec: "@every 1s"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,319 @@
+package goredis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/zhufuyi/pkg/krand"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	// ErrLockNotObtained 锁已被其他客户端持有
+	ErrLockNotObtained = errors.New("redis lock not obtained")
+	// ErrLockNotHeld 锁不存在或已被其他客户端持有
+	ErrLockNotHeld = errors.New("redis lock not held")
+
+	// DefaultLockExpiration 锁默认过期时间
+	DefaultLockExpiration = time.Second * 10
+	// DefaultLockMinRetryDelay 等待锁的最小重试间隔
+	DefaultLockMinRetryDelay = time.Millisecond * 10
+	// DefaultLockMaxRetryDelay 等待锁的最大重试间隔
+	DefaultLockMaxRetryDelay = time.Millisecond * 500
+)
+
+// 只有持有者(token相同)才能删除锁
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// 只有持有者(token相同)才能续期
+var renewScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// LockOption set the lock options.
+type LockOption func(*lockOptions)
+
+type lockOptions struct {
+	expiration    time.Duration
+	minRetryDelay time.Duration
+	maxRetryDelay time.Duration
+	watchdog      bool
+}
+
+func (o *lockOptions) apply(opts ...LockOption) {
+	for _, opt := range opts {
+		opt(o)
+	}
+}
+
+func defaultLockOptions() *lockOptions {
+	return &lockOptions{
+		expiration:    DefaultLockExpiration,
+		minRetryDelay: DefaultLockMinRetryDelay,
+		maxRetryDelay: DefaultLockMaxRetryDelay,
+		watchdog:      true, // 默认开启自动续期
+	}
+}
+
+// WithLockExpiration set the lease time of the lock, the default is 10s
+func WithLockExpiration(d time.Duration) LockOption {
+	return func(o *lockOptions) {
+		if d > 0 {
+			o.expiration = d
+		}
+	}
+}
+
+// WithLockRetryDelay set the min and max retry delay when waiting for the lock,
+// the delay doubles after each failed attempt until it reaches max
+func WithLockRetryDelay(min time.Duration, max time.Duration) LockOption {
+	return func(o *lockOptions) {
+		if min > 0 {
+			o.minRetryDelay = min
+		}
+		if max >= o.minRetryDelay {
+			o.maxRetryDelay = max
+		}
+	}
+}
+
+// WithoutWatchdog disable automatic lease renewal, the lock expires after expiration
+func WithoutWatchdog() LockOption {
+	return func(o *lockOptions) {
+		o.watchdog = false
+	}
+}
+
+// Locker 分布式锁，单节点模式下只使用一个redis，
+// Redlock模式下需要在多数(n/2+1)独立的redis节点上加锁成功才算获得锁
+type Locker struct {
+	clients []*redis.Client
+	quorum  int
+	opts    *lockOptions
+}
+
+// NewLocker create a distributed lock based on a redis client
+func NewLocker(client *redis.Client, opts ...LockOption) *Locker {
+	return NewRedlock([]*redis.Client{client}, opts...)
+}
+
+// NewRedlock create a distributed lock based on multiple independent redis nodes (Redlock algorithm)
+func NewRedlock(clients []*redis.Client, opts ...LockOption) *Locker {
+	o := defaultLockOptions()
+	o.apply(opts...)
+
+	return &Locker{
+		clients: clients,
+		quorum:  len(clients)/2 + 1,
+		opts:    o,
+	}
+}
+
+// TryLock 尝试获取一次锁，锁被其他客户端持有时返回ErrLockNotObtained
+func (l *Locker) TryLock(ctx context.Context, key string) (*Lock, error) {
+	token := krand.String(krand.R_All, 20)
+	ok, err := l.acquire(ctx, key, token)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrLockNotObtained
+	}
+	return l.newLock(key, token), nil
+}
+
+// Lock 获取锁，锁被其他客户端持有时按退避间隔重试，直到获得锁或ctx结束
+func (l *Locker) Lock(ctx context.Context, key string) (*Lock, error) {
+	token := krand.String(krand.R_All, 20)
+	delay := l.opts.minRetryDelay
+	for {
+		ok, err := l.acquire(ctx, key, token)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return l.newLock(key, token), nil
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("%w: %v, key=%s", ErrLockNotObtained, ctx.Err(), key)
+		case <-timer.C:
+		}
+
+		delay *= 2
+		if delay > l.opts.maxRetryDelay {
+			delay = l.opts.maxRetryDelay
+		}
+	}
+}
+
+// 在所有节点上加锁，多数节点成功且锁仍在有效期内才算成功，失败时释放已加的锁
+func (l *Locker) acquire(ctx context.Context, key string, token string) (bool, error) {
+	start := time.Now()
+	var count, failed int
+	var lastErr error
+	for _, client := range l.clients {
+		ok, err := client.SetNX(ctx, key, token, l.opts.expiration).Result()
+		if err != nil {
+			failed++
+			lastErr = err
+			continue
+		}
+		if ok {
+			count++
+		}
+	}
+
+	// 扣除加锁耗时和时钟漂移后的有效时间
+	drift := l.opts.expiration/100 + time.Millisecond*2
+	validity := l.opts.expiration - time.Since(start) - drift
+	if count >= l.quorum && validity > 0 {
+		return true, nil
+	}
+
+	_, _ = l.release(context.Background(), key, token)
+	// 可用节点不足多数时返回错误，不再重试
+	if len(l.clients)-failed < l.quorum {
+		return false, fmt.Errorf("client.SetNX error: %v, key=%s", lastErr, key)
+	}
+	return false, nil
+}
+
+// 在所有节点上释放锁，返回释放成功的节点数量
+func (l *Locker) release(ctx context.Context, key string, token string) (int, error) {
+	var count int
+	var lastErr error
+	for _, client := range l.clients {
+		n, err := releaseScript.Run(ctx, client, []string{key}, token).Int()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		count += n
+	}
+	return count, lastErr
+}
+
+// 在所有节点上续期，返回续期成功的节点数量
+func (l *Locker) renew(ctx context.Context, key string, token string) (int, error) {
+	var count int
+	var lastErr error
+	for _, client := range l.clients {
+		n, err := renewScript.Run(ctx, client, []string{key}, token, l.opts.expiration.Milliseconds()).Int()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		count += n
+	}
+	return count, lastErr
+}
+
+func (l *Locker) newLock(key string, token string) *Lock {
+	lock := &Lock{
+		locker: l,
+		key:    key,
+		token:  token,
+		stop:   make(chan struct{}),
+	}
+	if l.opts.watchdog {
+		lock.lost = make(chan struct{})
+		go lock.watchdog()
+	}
+	return lock
+}
+
+// Lock 已获得的锁
+type Lock struct {
+	locker *Locker
+	key    string
+	token  string
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	lost     chan struct{}
+}
+
+// Key 锁的key
+func (l *Lock) Key() string {
+	return l.key
+}
+
+// Token 持有者标识，每次加锁生成的随机字符串
+func (l *Lock) Token() string {
+	return l.token
+}
+
+// Lost 自动续期失败(锁已过期或被其他客户端持有)或停止续期时关闭，
+// 没有开启自动续期时返回nil
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Refresh 手动续期，锁不再被持有时返回ErrLockNotHeld
+func (l *Lock) Refresh(ctx context.Context) error {
+	count, err := l.locker.renew(ctx, l.key, l.token)
+	if count >= l.locker.quorum {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("renew error: %v, key=%s", err, l.key)
+	}
+	return ErrLockNotHeld
+}
+
+// Unlock 停止自动续期并释放锁，只能释放自己持有的锁，锁不再被持有时返回ErrLockNotHeld
+func (l *Lock) Unlock(ctx context.Context) error {
+	l.stopWatchdog()
+
+	count, err := l.locker.release(ctx, l.key, l.token)
+	if count >= l.locker.quorum {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("release error: %v, key=%s", err, l.key)
+	}
+	return ErrLockNotHeld
+}
+
+func (l *Lock) stopWatchdog() {
+	l.stopOnce.Do(func() {
+		close(l.stop)
+	})
+}
+
+// 每隔1/3过期时间续期一次，续期失败时停止
+func (l *Lock) watchdog() {
+	defer close(l.lost)
+
+	ticker := time.NewTicker(l.locker.opts.expiration / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), l.locker.opts.expiration/3)
+			err := l.Refresh(ctx)
+			cancel()
+			if err == ErrLockNotHeld {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package goredis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMiniRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, redis.NewClient(&redis.Options{Addr: s.Addr()})
+}
+
+func TestLocker(t *testing.T) {
+	s, client := newMiniRedis(t)
+	defer s.Close()
+	ctx := context.Background()
+	locker := NewLocker(client, WithLockExpiration(time.Second), WithoutWatchdog())
+
+	lock, err := locker.TryLock(ctx, "lock:order")
+	assert.NoError(t, err)
+	assert.Equal(t, "lock:order", lock.Key())
+	assert.Equal(t, lock.Token(), mustGet(s, "lock:order"))
+
+	// 锁被持有时获取失败
+	_, err = locker.TryLock(ctx, "lock:order")
+	assert.Equal(t, ErrLockNotObtained, err)
+
+	// 非持有者不能释放锁
+	other := &Lock{locker: locker, key: "lock:order", token: "other", stop: make(chan struct{})}
+	err = other.Unlock(ctx)
+	assert.Equal(t, ErrLockNotHeld, err)
+	assert.True(t, s.Exists("lock:order"))
+
+	err = lock.Refresh(ctx)
+	assert.NoError(t, err)
+	err = lock.Unlock(ctx)
+	assert.NoError(t, err)
+	assert.False(t, s.Exists("lock:order"))
+	err = lock.Unlock(ctx)
+	assert.Equal(t, ErrLockNotHeld, err)
+
+	// 过期后可以被其他客户端获取
+	_, err = locker.TryLock(ctx, "lock:order")
+	assert.NoError(t, err)
+	s.FastForward(time.Second * 2)
+	lock, err = locker.TryLock(ctx, "lock:order")
+	assert.NoError(t, err)
+	assert.NoError(t, lock.Unlock(ctx))
+}
+
+func mustGet(s *miniredis.Miniredis, key string) string {
+	val, _ := s.Get(key)
+	return val
+}
+
+func TestLockerWait(t *testing.T) {
+	s, client := newMiniRedis(t)
+	defer s.Close()
+	ctx := context.Background()
+	locker := NewLocker(client, WithLockRetryDelay(time.Millisecond*10, time.Millisecond*50))
+
+	lock, err := locker.Lock(ctx, "lock:wait")
+	assert.NoError(t, err)
+
+	// 等待超时
+	ctx2, cancel := context.WithTimeout(ctx, time.Millisecond*200)
+	defer cancel()
+	_, err = locker.Lock(ctx2, "lock:wait")
+	assert.True(t, errors.Is(err, ErrLockNotObtained))
+
+	// 持有者释放后获得锁
+	go func() {
+		time.Sleep(time.Millisecond * 100)
+		_ = lock.Unlock(ctx)
+	}()
+	ctx3, cancel3 := context.WithTimeout(ctx, time.Second)
+	defer cancel3()
+	lock2, err := locker.Lock(ctx3, "lock:wait")
+	assert.NoError(t, err)
+	assert.NoError(t, lock2.Unlock(ctx))
+}
+
+func TestLockerWatchdog(t *testing.T) {
+	s, client := newMiniRedis(t)
+	defer s.Close()
+	ctx := context.Background()
+	locker := NewLocker(client, WithLockExpiration(time.Millisecond*300))
+
+	lock, err := locker.TryLock(ctx, "lock:watchdog")
+	assert.NoError(t, err)
+
+	// 自动续期后过期时间被重置
+	s.FastForward(time.Millisecond * 200)
+	time.Sleep(time.Millisecond * 150)
+	assert.Greater(t, s.TTL("lock:watchdog"), time.Millisecond*200)
+
+	// 锁被删除后停止续期
+	s.Del("lock:watchdog")
+	select {
+	case <-lock.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("watchdog not stopped")
+	}
+	assert.Equal(t, ErrLockNotHeld, lock.Unlock(ctx))
+}
+
+func TestRedlock(t *testing.T) {
+	var clients []*redis.Client
+	var servers []*miniredis.Miniredis
+	for i := 0; i < 3; i++ {
+		s, client := newMiniRedis(t)
+		defer s.Close()
+		servers = append(servers, s)
+		clients = append(clients, client)
+	}
+	ctx := context.Background()
+	locker := NewRedlock(clients, WithoutWatchdog())
+
+	// 一个节点被其他客户端持有，多数节点成功仍然获得锁
+	assert.NoError(t, servers[0].Set("lock:redlock", "other"))
+	lock, err := locker.TryLock(ctx, "lock:redlock")
+	assert.NoError(t, err)
+	assert.NoError(t, lock.Unlock(ctx))
+	v, _ := servers[0].Get("lock:redlock")
+	assert.Equal(t, "other", v)
+
+	// 多数节点被持有时获取失败，并释放已加的锁
+	assert.NoError(t, servers[1].Set("lock:redlock", "other"))
+	_, err = locker.TryLock(ctx, "lock:redlock")
+	assert.Equal(t, ErrLockNotObtained, err)
+	assert.False(t, servers[2].Exists("lock:redlock"))
+
+	// 多数节点不可用时返回错误
+	servers[1].Close()
+	servers[2].Close()
+	_, err = locker.TryLock(ctx, "lock:redlock2")
+	assert.Error(t, err)
+	assert.NotEqual(t, ErrLockNotObtained, err)
+}
@@ -0,0 +1,33 @@
+package interceptor
+
+import (
+	"context"
+
+	"github.com/zhufuyi/pkg/errcode"
+
+	"google.golang.org/grpc"
+)
+
+// ---------------------------------- server interceptor ----------------------------------
+
+// UnaryServerI18n 根据客户端metadata中的lang或accept-language翻译返回的错误信息unary拦截器
+func UnaryServerI18n() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		if err != nil {
+			err = errcode.LocalizeError(ctx, err)
+		}
+		return resp, err
+	}
+}
+
+// StreamServerI18n 根据客户端metadata中的lang或accept-language翻译返回的错误信息stream拦截器
+func StreamServerI18n() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		err := handler(srv, ss)
+		if err != nil {
+			err = errcode.LocalizeError(ss.Context(), err)
+		}
+		return err
+	}
+}
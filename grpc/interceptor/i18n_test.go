@@ -0,0 +1,39 @@
+package interceptor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/zhufuyi/pkg/errcode"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryServerI18n(t *testing.T) {
+	errcode.LoadMessages("zh", map[int]string{30002: "未授权"})
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("lang", "zh"))
+
+	interceptor := UnaryServerI18n()
+	_, err := interceptor(ctx, nil, unaryServerInfo, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, errcode.StatusUnauthorized.Err()
+	})
+	st, _ := status.FromError(err)
+	assert.Equal(t, "未授权", st.Message())
+
+	_, err = interceptor(ctx, nil, unaryServerInfo, unaryServerHandler)
+	assert.NoError(t, err)
+}
+
+func TestStreamServerI18n(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("accept-language", "zh-CN"))
+
+	interceptor := StreamServerI18n()
+	err := interceptor(nil, newStreamServer(ctx), streamServerInfo, func(srv interface{}, stream grpc.ServerStream) error {
+		return errcode.StatusUnauthorized.Err()
+	})
+	st, _ := status.FromError(err)
+	assert.Equal(t, "未授权", st.Message())
+}
@@ -2,6 +2,9 @@ package interceptor
 
 import (
 	"context"
+	"net/http"
+	"path"
+	"strings"
 
 	"github.com/zhufuyi/pkg/jwt"
 
@@ -9,30 +12,73 @@ import (
 	grpc_auth "github.com/grpc-ecosystem/go-grpc-middleware/auth"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
 // ---------------------------------- server interceptor ----------------------------------
 
 var (
-	// auth Scheme
+	// 默认的auth Scheme
 	authScheme = "Bearer"
 
-	// 鉴权信息在ctx中key名
+	// 鉴权信息在ctx中默认的key名
 	authCtxClaimsName = "tokenInfo"
-
-	// 跳过认证方法集合
-	authIgnoreMethods = map[string]struct{}{}
 )
 
+// 拦截器附加claims的key，不受WithAuthClaimsName影响
+type authClaimsKey struct{}
+
+// TokenExtractor 从请求的metadata获取token，没有时返回空字符串
+type TokenExtractor func(ctx context.Context) string
+
+// TokenFromMetadata get token from metadata, the scheme is the prefix of the value, e.g. TokenFromMetadata("authorization", "Bearer"),
+// empty scheme means the value is the token
+func TokenFromMetadata(key string, scheme string) TokenExtractor {
+	return func(ctx context.Context) string {
+		md, _ := metadata.FromIncomingContext(ctx)
+		values := md.Get(key)
+		if len(values) == 0 {
+			return ""
+		}
+		if scheme == "" {
+			return values[0]
+		}
+		fields := strings.SplitN(values[0], " ", 2)
+		if len(fields) < 2 || !strings.EqualFold(fields[0], scheme) {
+			return ""
+		}
+		return strings.TrimSpace(fields[1])
+	}
+}
+
+// TokenFromCookie get token from the cookie forwarded by grpc-gateway (metadata grpcgateway-cookie or cookie)
+func TokenFromCookie(name string) TokenExtractor {
+	return func(ctx context.Context) string {
+		md, _ := metadata.FromIncomingContext(ctx)
+		for _, key := range []string{"grpcgateway-cookie", "cookie"} {
+			for _, v := range md.Get(key) {
+				req := http.Request{Header: http.Header{"Cookie": []string{v}}}
+				if c, err := req.Cookie(name); err == nil && c.Value != "" {
+					return c.Value
+				}
+			}
+		}
+		return ""
+	}
+}
+
 // AuthOption 设置鉴权字段
 type AuthOption func(*AuthOptions)
 
 // AuthOptions 鉴权设置
 type AuthOptions struct {
-	authScheme    string
-	ctxClaimsName string
-	ignoreMethods map[string]struct{}
+	authScheme     string
+	ctxClaimsName  string
+	ignoreMethods  map[string]struct{}
+	ignorePatterns []string
+	extractors     []TokenExtractor
+	verify         func(token string) (interface{}, error)
 }
 
 func defaultAuthOptions() *AuthOptions {
@@ -40,6 +86,9 @@ func defaultAuthOptions() *AuthOptions {
 		authScheme:    authScheme,
 		ctxClaimsName: authCtxClaimsName,
 		ignoreMethods: make(map[string]struct{}), // 忽略鉴权的方法
+		verify: func(token string) (interface{}, error) {
+			return jwt.VerifyToken(token)
+		},
 	}
 }
 
@@ -63,27 +112,96 @@ func WithAuthClaimsName(claimsName string) AuthOption {
 	}
 }
 
-// WithAuthIgnoreMethods 忽略鉴权的方法
+// WithAuthIgnoreMethods 忽略鉴权的方法，支持*通配符
 // fullMethodName格式: /packageName.serviceName/methodName，
-// 示例/api.userExample.v1.userExampleService/GetByID
+// 示例/api.userExample.v1.userExampleService/GetByID，/api.userExample.v1.userExampleService/*
 func WithAuthIgnoreMethods(fullMethodNames ...string) AuthOption {
 	return func(o *AuthOptions) {
 		for _, method := range fullMethodNames {
+			if strings.Contains(method, "*") {
+				o.ignorePatterns = append(o.ignorePatterns, method)
+				continue
+			}
 			o.ignoreMethods[method] = struct{}{}
 		}
 	}
 }
 
-// GetAuthorization 根据token组合成鉴权信息
+// WithAuthTokenExtractors 设置获取token的方式，按顺序获取直到有token，默认是TokenFromMetadata("authorization", authScheme)
+func WithAuthTokenExtractors(extractors ...TokenExtractor) AuthOption {
+	return func(o *AuthOptions) {
+		o.extractors = extractors
+	}
+}
+
+// WithAuthVerify 设置验证token和解析claims的函数，默认是jwt.VerifyToken，自定义claims可以使用jwt.ParseToken解析
+func WithAuthVerify(fn func(token string) (interface{}, error)) AuthOption {
+	return func(o *AuthOptions) {
+		if fn != nil {
+			o.verify = fn
+		}
+	}
+}
+
+func (o *AuthOptions) isIgnored(fullMethod string) bool {
+	if _, ok := o.ignoreMethods[fullMethod]; ok {
+		return true
+	}
+	for _, pattern := range o.ignorePatterns {
+		if ok, _ := path.Match(pattern, fullMethod); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// 验证token，并把claims附加到ctx
+func (o *AuthOptions) verifyCtx(ctx context.Context) (context.Context, error) {
+	extractors := o.extractors
+	if len(extractors) == 0 {
+		extractors = []TokenExtractor{TokenFromMetadata("authorization", o.authScheme)}
+	}
+	var token string
+	for _, extract := range extractors {
+		if token = extract(ctx); token != "" {
+			break
+		}
+	}
+	if token == "" {
+		return nil, status.Errorf(codes.Unauthenticated, "token not found")
+	}
+
+	claims, err := o.verify(token)
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "%v", err)
+	}
+	ctx = context.WithValue(ctx, o.ctxClaimsName, claims) //nolint
+	return context.WithValue(ctx, authClaimsKey{}, claims), nil
+}
+
+// GetAuthorization 根据token和默认的scheme组合成鉴权信息
 func GetAuthorization(token string) string {
 	return authScheme + " " + token
 }
 
-// GetAuthCtxKey 获取Claims的名称
+// GetAuthCtxKey 获取Claims默认的名称
 func GetAuthCtxKey() string {
 	return authCtxClaimsName
 }
 
+// GetAuthClaims 获取鉴权通过后附加到ctx的claims，不是*jwt.CustomClaims时返回false，
+// claimsName为空时获取拦截器附加的claims，不管WithAuthClaimsName设置的名称，不为空时按名称获取
+func GetAuthClaims(ctx context.Context, claimsName ...string) (*jwt.CustomClaims, bool) {
+	var v interface{}
+	if len(claimsName) > 0 && claimsName[0] != "" {
+		v = ctx.Value(claimsName[0]) //nolint
+	} else {
+		v = ctx.Value(authClaimsKey{})
+	}
+	claims, ok := v.(*jwt.CustomClaims)
+	return claims, ok
+}
+
 // JwtVerify 从context获取authorization来验证是否合法，authorization组成格式：authScheme token
 func JwtVerify(ctx context.Context) (context.Context, error) {
 	token, err := grpc_auth.AuthFromMD(ctx, authScheme)
@@ -105,18 +223,15 @@ func JwtVerify(ctx context.Context) (context.Context, error) {
 func UnaryServerJwtAuth(opts ...AuthOption) grpc.UnaryServerInterceptor {
 	o := defaultAuthOptions()
 	o.apply(opts...)
-	authScheme = o.authScheme
-	authCtxClaimsName = o.ctxClaimsName
-	authIgnoreMethods = o.ignoreMethods
 
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
 		var newCtx context.Context
 		var err error
 
-		if _, ok := authIgnoreMethods[info.FullMethod]; ok {
+		if o.isIgnored(info.FullMethod) {
 			newCtx = ctx
 		} else {
-			newCtx, err = JwtVerify(ctx)
+			newCtx, err = o.verifyCtx(ctx)
 			if err != nil {
 				return nil, err
 			}
@@ -130,18 +245,15 @@ func UnaryServerJwtAuth(opts ...AuthOption) grpc.UnaryServerInterceptor {
 func StreamServerJwtAuth(opts ...AuthOption) grpc.StreamServerInterceptor {
 	o := defaultAuthOptions()
 	o.apply(opts...)
-	authScheme = o.authScheme
-	authCtxClaimsName = o.ctxClaimsName
-	authIgnoreMethods = o.ignoreMethods
 
 	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
 		var newCtx context.Context
 		var err error
 
-		if _, ok := authIgnoreMethods[info.FullMethod]; ok {
+		if o.isIgnored(info.FullMethod) {
 			newCtx = stream.Context()
 		} else {
-			newCtx, err = JwtVerify(stream.Context())
+			newCtx, err = o.verifyCtx(stream.Context())
 			if err != nil {
 				return err
 			}
@@ -6,8 +6,12 @@ import (
 
 	"github.com/zhufuyi/pkg/jwt"
 
+	gojwt "github.com/golang-jwt/jwt"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 func TestJwtVerify(t *testing.T) {
@@ -95,3 +99,113 @@ func Test_defaultAuthOptions(t *testing.T) {
 	o := defaultAuthOptions()
 	assert.NotNil(t, o)
 }
+
+type tenantClaims struct {
+	UID      string `json:"uid"`
+	TenantID string `json:"tenantID"`
+	gojwt.StandardClaims
+}
+
+func TestUnaryServerJwtAuthOptions(t *testing.T) {
+	jwt.Init()
+	token, _ := jwt.GenerateToken("100", "admin")
+
+	var claims interface{}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		claims = ctx.Value(GetAuthCtxKey())
+		return nil, nil
+	}
+	interceptor := UnaryServerJwtAuth(
+		WithAuthTokenExtractors(TokenFromMetadata("authorization", "Bearer"), TokenFromMetadata("x-token", ""), TokenFromCookie("token")),
+		WithAuthIgnoreMethods("/api.user.v1.User/Login", "/api.public.v1.*/*"),
+	)
+	info := func(method string) *grpc.UnaryServerInfo {
+		return &grpc.UnaryServerInfo{FullMethod: method}
+	}
+
+	for _, md := range []metadata.MD{
+		{"authorization": []string{"bearer " + token}},
+		{"x-token": []string{token}},
+		{"grpcgateway-cookie": []string{"foo=bar; token=" + token}},
+	} {
+		claims = nil
+		_, err := interceptor(metadata.NewIncomingContext(context.Background(), md), nil, info("/api.user.v1.User/Get"), handler)
+		assert.NoError(t, err)
+		assert.Equal(t, "100", claims.(*jwt.CustomClaims).UID)
+	}
+
+	_, err := interceptor(metadata.NewIncomingContext(context.Background(), metadata.MD{"authorization": []string{"Basic " + token}}),
+		nil, info("/api.user.v1.User/Get"), handler)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = interceptor(context.Background(), nil, info("/api.user.v1.User/Get"), handler)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// 跳过鉴权
+	_, err = interceptor(context.Background(), nil, info("/api.user.v1.User/Login"), handler)
+	assert.NoError(t, err)
+	_, err = interceptor(context.Background(), nil, info("/api.public.v1.Docs/List"), handler)
+	assert.NoError(t, err)
+
+	// 自定义claims
+	interceptor = UnaryServerJwtAuth(WithAuthClaimsName("claims"), WithAuthVerify(func(token string) (interface{}, error) {
+		c := &tenantClaims{}
+		return c, jwt.ParseToken(token, c)
+	}))
+	tenantToken, _ := jwt.GenerateTokenWithClaims(&tenantClaims{UID: "200", TenantID: "t1"})
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.MD{"authorization": []string{GetAuthorization(tenantToken)}})
+	_, err = interceptor(ctx, nil, info("/api.user.v1.User/Get"), func(ctx context.Context, req interface{}) (interface{}, error) {
+		claims = ctx.Value("claims")
+		return nil, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "t1", claims.(*tenantClaims).TenantID)
+
+	// 创建拦截器不修改默认的名称和scheme，其他拦截器不受影响
+	interceptor = UnaryServerJwtAuth(WithAuthClaimsName("claims"), WithAuthScheme("Token"))
+	assert.Equal(t, "tokenInfo", GetAuthCtxKey())
+	assert.Equal(t, "Bearer "+token, GetAuthorization(token))
+	var uid, namedUID string
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.MD{"authorization": []string{"Token " + token}})
+	_, err = interceptor(ctx, nil, info("/api.user.v1.User/Get"), func(ctx context.Context, req interface{}) (interface{}, error) {
+		if c, ok := GetAuthClaims(ctx); ok {
+			uid = c.UID
+		}
+		if c, ok := GetAuthClaims(ctx, "claims"); ok {
+			namedUID = c.UID
+		}
+		assert.Nil(t, ctx.Value(GetAuthCtxKey()))
+		return nil, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "100", uid)
+	assert.Equal(t, "100", namedUID)
+
+	interceptor = UnaryServerJwtAuth()
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.MD{"authorization": []string{GetAuthorization(token)}})
+	_, err = interceptor(ctx, nil, info("/api.user.v1.User/Get"), handler)
+	assert.NoError(t, err)
+	assert.Equal(t, "100", claims.(*jwt.CustomClaims).UID)
+}
+
+func TestStreamServerJwtAuthOptions(t *testing.T) {
+	jwt.Init()
+	token, _ := jwt.GenerateToken("100")
+
+	interceptor := StreamServerJwtAuth(WithAuthIgnoreMethods("/test.v1.Stream/*"))
+	err := interceptor(nil, newStreamServer(context.Background()), streamServerInfo, streamServerHandler)
+	assert.Error(t, err)
+
+	var uid string
+	handler := func(srv interface{}, stream grpc.ServerStream) error {
+		claims, _ := GetAuthClaims(stream.Context())
+		uid = claims.UID
+		return nil
+	}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.MD{"authorization": []string{GetAuthorization(token)}})
+	err = interceptor(nil, newStreamServer(ctx), streamServerInfo, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, "100", uid)
+
+	err = interceptor(nil, newStreamServer(context.Background()), &grpc.StreamServerInfo{FullMethod: "/test.v1.Stream/Watch"}, streamServerHandler)
+	assert.NoError(t, err)
+}
@@ -2,12 +2,19 @@ package interceptor
 
 import (
 	"context"
+	"errors"
+	"math"
+	"net"
+	"strconv"
 	"time"
 
 	"github.com/zhufuyi/pkg/errcode"
+	"github.com/zhufuyi/pkg/logger"
 	rl "github.com/zhufuyi/pkg/shield/ratelimit"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 )
 
 // ---------------------------------- server interceptor ----------------------------------
@@ -113,3 +120,131 @@ func StreamServerRateLimit(opts ...RatelimitOption) grpc.StreamServerInterceptor
 		return err
 	}
 }
+
+// RateLimitKeyFunc 获取限流的key，返回空字符串时使用客户端ip
+type RateLimitKeyFunc func(ctx context.Context, fullMethod string) string
+
+// RateLimitKeyByIP limit by client ip
+func RateLimitKeyByIP() RateLimitKeyFunc {
+	return func(ctx context.Context, _ string) string {
+		return "ip:" + peerIP(ctx)
+	}
+}
+
+// RateLimitKeyByMetadata limit by the value of metadata, e.g. RateLimitKeyByMetadata("x-api-key")
+func RateLimitKeyByMetadata(key string) RateLimitKeyFunc {
+	return func(ctx context.Context, _ string) string {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if values := md.Get(key); len(values) > 0 && values[0] != "" {
+			return key + ":" + values[0]
+		}
+		return ""
+	}
+}
+
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// KeyRateLimitOption set the key rate limit options.
+type KeyRateLimitOption func(*keyRateLimitOptions)
+
+type keyRateLimitOptions struct {
+	failClosed bool
+}
+
+func (o *keyRateLimitOptions) apply(opts ...KeyRateLimitOption) {
+	for _, opt := range opts {
+		opt(o)
+	}
+}
+
+// WithFailClosed reject the request when the limiter returns an error (e.g. redis is unavailable),
+// the default is to allow the request
+func WithFailClosed() KeyRateLimitOption {
+	return func(o *keyRateLimitOptions) {
+		o.failClosed = true
+	}
+}
+
+// UnaryServerKeyRateLimit server-side unary limit by key with a fixed quota, the limiter can be redis token bucket or sliding window,
+// header x-ratelimit-limit, x-ratelimit-remaining, x-ratelimit-reset and retry-after(rejected only) are set,
+// the request is allowed if the limiter returns an error other than ErrLimitExceed, see WithFailClosed
+func UnaryServerKeyRateLimit(limiter rl.KeyLimiter, keyFn RateLimitKeyFunc, opts ...KeyRateLimitOption) grpc.UnaryServerInterceptor {
+	take := newKeyRateLimit(limiter, keyFn, opts...)
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		err := take(ctx, info.FullMethod, func(md metadata.MD) error { return grpc.SetHeader(ctx, md) })
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerKeyRateLimit server-side stream limit by key with a fixed quota, each stream consumes a quota,
+// see UnaryServerKeyRateLimit
+func StreamServerKeyRateLimit(limiter rl.KeyLimiter, keyFn RateLimitKeyFunc, opts ...KeyRateLimitOption) grpc.StreamServerInterceptor {
+	take := newKeyRateLimit(limiter, keyFn, opts...)
+
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		err := take(ss.Context(), info.FullMethod, ss.SetHeader)
+		if err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// 消耗key的一个配额并设置header，返回拒绝请求的错误
+func newKeyRateLimit(limiter rl.KeyLimiter, keyFn RateLimitKeyFunc, opts ...KeyRateLimitOption) func(ctx context.Context, fullMethod string, setHeader func(metadata.MD) error) error {
+	o := &keyRateLimitOptions{}
+	o.apply(opts...)
+	if keyFn == nil {
+		keyFn = RateLimitKeyByIP()
+	}
+
+	return func(ctx context.Context, fullMethod string, setHeader func(metadata.MD) error) error {
+		key := keyFn(ctx, fullMethod)
+		if key == "" {
+			key = "ip:" + peerIP(ctx)
+		}
+
+		result, err := limiter.Take(ctx, key)
+		if result != nil {
+			md := metadata.Pairs(
+				"x-ratelimit-limit", strconv.Itoa(result.Limit),
+				"x-ratelimit-remaining", strconv.Itoa(result.Remaining),
+				"x-ratelimit-reset", ceilSeconds(result.ResetAfter),
+			)
+			if errors.Is(err, rl.ErrLimitExceed) {
+				md.Set("retry-after", ceilSeconds(result.RetryAfter))
+			}
+			_ = setHeader(md)
+		}
+		if err != nil {
+			if errors.Is(err, rl.ErrLimitExceed) {
+				return errcode.StatusLimitExceed.ToRPCErr(err.Error())
+			}
+
+			logger.Warn("rate limit error", logger.Err(err), logger.String("key", key), logger.String("method", fullMethod))
+			if o.failClosed {
+				return errcode.StatusServiceUnavailable.ToRPCErr()
+			}
+		}
+		return nil
+	}
+}
+
+// 向上取整的秒数
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
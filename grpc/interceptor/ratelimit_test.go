@@ -2,10 +2,20 @@ package interceptor
 
 import (
 	"context"
-	"github.com/stretchr/testify/assert"
-	"google.golang.org/grpc"
+	"net"
 	"testing"
 	"time"
+
+	rl "github.com/zhufuyi/pkg/shield/ratelimit"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
 )
 
 func TestUnaryServerRateLimit(t *testing.T) {
@@ -34,3 +44,99 @@ func TestStreamServerRateLimit(t *testing.T) {
 	err := interceptor(nil, nil, nil, handler)
 	assert.NoError(t, err)
 }
+
+type headerStream struct {
+	grpc.ServerTransportStream
+	header metadata.MD
+}
+
+func (s *headerStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func TestUnaryServerKeyRateLimit(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+
+	interceptor := UnaryServerKeyRateLimit(rl.NewRedisSlidingWindow(client, 2, time.Minute), RateLimitKeyByMetadata("x-api-key"))
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	}
+	newCtx := func(apiKey string) (context.Context, *headerStream) {
+		stream := &headerStream{}
+		ctx := grpc.NewContextWithServerTransportStream(context.Background(), stream)
+		ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 8282}})
+		if apiKey != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("x-api-key", apiKey))
+		}
+		return ctx, stream
+	}
+
+	for i := 0; i < 2; i++ {
+		ctx, stream := newCtx("key1")
+		_, err = interceptor(ctx, nil, unaryServerInfo, handler)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"2"}, stream.header.Get("x-ratelimit-limit"))
+	}
+	ctx, stream := newCtx("key1")
+	_, err = interceptor(ctx, nil, unaryServerInfo, handler)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, []string{"0"}, stream.header.Get("x-ratelimit-remaining"))
+	assert.Equal(t, []string{"60"}, stream.header.Get("retry-after"))
+
+	// 没有api key时按ip限流
+	ctx, _ = newCtx("")
+	_, err = interceptor(ctx, nil, unaryServerInfo, handler)
+	assert.NoError(t, err)
+	assert.True(t, s.Exists("ratelimit:ip:127.0.0.1"))
+
+	// redis错误时默认不限流，WithFailClosed时拒绝请求
+	s.Close()
+	_, err = UnaryServerKeyRateLimit(rl.NewRedisTokenBucket(client, 1, time.Second, 1), nil)(context.Background(), nil, unaryServerInfo, handler)
+	assert.NoError(t, err)
+	_, err = UnaryServerKeyRateLimit(rl.NewRedisTokenBucket(client, 1, time.Second, 1), nil, WithFailClosed())(context.Background(), nil, unaryServerInfo, handler)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+type headerServerStream struct {
+	streamServer
+	header metadata.MD
+}
+
+func (s *headerServerStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func TestStreamServerKeyRateLimit(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+
+	interceptor := StreamServerKeyRateLimit(rl.NewRedisTokenBucket(client, 1, time.Minute, 1), nil, WithFailClosed())
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 8282}})
+
+	stream := &headerServerStream{streamServer: streamServer{ctx: ctx}}
+	err = interceptor(nil, stream, streamServerInfo, streamServerHandler)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1"}, stream.header.Get("x-ratelimit-limit"))
+	assert.Equal(t, []string{"0"}, stream.header.Get("x-ratelimit-remaining"))
+
+	stream = &headerServerStream{streamServer: streamServer{ctx: ctx}}
+	err = interceptor(nil, stream, streamServerInfo, streamServerHandler)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, []string{"60"}, stream.header.Get("retry-after"))
+	assert.True(t, s.Exists("ratelimit:ip:127.0.0.1"))
+
+	s.Close()
+	err = interceptor(nil, newStreamServer(ctx), streamServerInfo, streamServerHandler)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
@@ -10,24 +10,49 @@ import (
 
 // CustomClaims 自定义Claims
 type CustomClaims struct {
-	UID  string `json:"uid"`
-	Role string `json:"role"`
+	UID   string   `json:"uid"`
+	Role  string   `json:"role"`
+	Roles []string `json:"roles,omitempty"` // 多个角色，第一个角色同时保存在Role
 	jwt.StandardClaims
 }
 
-// GenerateToken 生成token
+// GetUID get the user id
+func (c *CustomClaims) GetUID() string {
+	return c.UID
+}
+
+// GetRoles get all roles of the user, including Role and Roles, without duplicates
+func (c *CustomClaims) GetRoles() []string {
+	var roles []string
+	seen := map[string]bool{}
+	for _, r := range append([]string{c.Role}, c.Roles...) {
+		if r == "" || seen[r] {
+			continue
+		}
+		seen[r] = true
+		roles = append(roles, r)
+	}
+	return roles
+}
+
+// GenerateToken 生成token，可以设置多个角色
 func GenerateToken(uid string, role ...string) (string, error) {
 	if opt == nil {
 		return "", errInit
 	}
 
 	roleVal := ""
+	var roles []string
 	if len(role) > 0 {
 		roleVal = role[0]
 	}
+	if len(role) > 1 {
+		roles = role
+	}
 	claims := CustomClaims{
 		uid,
 		roleVal,
+		roles,
 		jwt.StandardClaims{
 			ExpiresAt: time.Now().Add(opt.expire).Unix(),
 			Issuer:    opt.issuer,
@@ -40,34 +65,60 @@ func GenerateToken(uid string, role ...string) (string, error) {
 
 // VerifyToken 验证token
 func VerifyToken(tokenString string) (*CustomClaims, error) {
+	claims := &CustomClaims{}
+	if err := ParseToken(tokenString, claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// ParseToken 验证token，并解析到自定义的claims，claims必须是指针，例如
+//
+//	type MyClaims struct {
+//		UID      string `json:"uid"`
+//		TenantID string `json:"tenantID"`
+//		jwt.StandardClaims
+//	}
+//	claims := &MyClaims{}
+//	err := ParseToken(token, claims)
+func ParseToken(tokenString string, claims jwt.Claims) error {
 	if opt == nil {
-		return nil, errInit
+		return errInit
 	}
 
-	token, err := jwt.ParseWithClaims(tokenString, &CustomClaims{}, func(token *jwt.Token) (interface{}, error) {
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
 		return opt.signingKey, nil
 	})
 	if err != nil {
 		ve, ok := err.(*jwt.ValidationError)
 		if ok {
 			if ve.Errors&jwt.ValidationErrorMalformed != 0 {
-				return nil, errFormat
+				return errFormat
 			} else if ve.Errors&jwt.ValidationErrorExpired != 0 {
-				return nil, errExpired
+				return errExpired
 			} else if ve.Errors&jwt.ValidationErrorUnverifiable != 0 {
-				return nil, errUnverifiable
+				return errUnverifiable
 			} else if ve.Errors&jwt.ValidationErrorSignatureInvalid != 0 {
-				return nil, errSignature
+				return errSignature
 			} else {
-				return nil, ve
+				return ve
 			}
 		}
-		return nil, errSignature
+		return errSignature
+	}
+
+	if !token.Valid {
+		return errSignature
 	}
+	return nil
+}
 
-	if claims, ok := token.Claims.(*CustomClaims); ok && token.Valid {
-		return claims, nil
+// GenerateTokenWithClaims 使用自定义的claims生成token，过期时间等字段需要在claims中设置
+func GenerateTokenWithClaims(claims jwt.Claims) (string, error) {
+	if opt == nil {
+		return "", errInit
 	}
 
-	return nil, errSignature
+	token := jwt.NewWithClaims(opt.signingMethod, claims)
+	return token.SignedString(opt.signingKey)
 }
@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -64,3 +65,50 @@ func TestVerifyToken(t *testing.T) {
 	v, err = VerifyToken(token)
 	assert.Equal(t, err, errExpired)
 }
+
+func TestCustomClaims_GetRoles(t *testing.T) {
+	Init()
+
+	token, err := GenerateToken("123", "admin", "editor", "admin")
+	assert.NoError(t, err)
+	v, err := VerifyToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "admin", v.Role)
+	assert.Equal(t, []string{"admin", "editor"}, v.GetRoles())
+
+	token, err = GenerateToken("123")
+	assert.NoError(t, err)
+	v, err = VerifyToken(token)
+	assert.NoError(t, err)
+	assert.Empty(t, v.GetRoles())
+}
+
+type myClaims struct {
+	UID      string `json:"uid"`
+	TenantID string `json:"tenantID"`
+	jwt.StandardClaims
+}
+
+func TestParseToken(t *testing.T) {
+	opt = nil
+	_, err := GenerateTokenWithClaims(&myClaims{})
+	assert.Error(t, err)
+	assert.Error(t, ParseToken("token", &myClaims{}))
+
+	Init()
+	token, err := GenerateTokenWithClaims(&myClaims{
+		UID:            "123",
+		TenantID:       "t1",
+		StandardClaims: jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Hour).Unix()},
+	})
+	assert.NoError(t, err)
+	claims := &myClaims{}
+	assert.NoError(t, ParseToken(token, claims))
+	assert.Equal(t, "t1", claims.TenantID)
+
+	assert.Equal(t, errFormat, ParseToken("xxx.xxx.xxx", claims))
+	assert.Equal(t, errSignature, ParseToken(token+"xxx", claims))
+
+	token, _ = GenerateTokenWithClaims(&myClaims{StandardClaims: jwt.StandardClaims{ExpiresAt: time.Now().Add(-time.Hour).Unix()}})
+	assert.Equal(t, errExpired, ParseToken(token, claims))
+}
@@ -3,6 +3,8 @@ package npub
 import (
 	"strings"
 
+	"github.com/zhufuyi/pkg/encoding"
+
 	"github.com/nats-io/nats.go"
 )
 
@@ -42,6 +44,23 @@ func (n *Client) PushJSON(topic string, v interface{}) error {
 	return eConn.Publish(topic, v)
 }
 
+// Push 使用MIME类型对应的编码推送数据，MIME类型保存在消息头Content-Type中，订阅者通过nsub.Decode解码
+func (n *Client) Push(topic string, mimeType string, v interface{}) error {
+	e, err := encoding.ForContentType(mimeType)
+	if err != nil {
+		return err
+	}
+	data, err := e.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	msg := nats.NewMsg(topic)
+	msg.Header.Set("Content-Type", mimeType)
+	msg.Data = data
+	return n.Conn.PublishMsg(msg)
+}
+
 // PushString 推送字符串数据
 func (n *Client) PushString(topic string, msg []byte) error {
 	return n.Conn.Publish(topic, msg)
@@ -43,3 +43,16 @@ func TestClient_PushJSON(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestClient_Push(t *testing.T) {
+	defer func() { recover() }()
+
+	msg := struct {
+		Name string `json:"name"`
+	}{"张三"}
+
+	err := GetClient().Push("foo.msgpack", "application/msgpack", &msg)
+	if err != nil {
+		t.Error(err)
+	}
+}
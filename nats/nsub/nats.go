@@ -6,6 +6,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/zhufuyi/pkg/encoding"
+
 	"github.com/nats-io/nats.go"
 )
 
@@ -69,6 +71,19 @@ func (c *Client) SubscribeSync(ctx context.Context, topic string, pushData chan
 	}
 }
 
+// Decode 根据消息头Content-Type选择编码解码数据，没有Content-Type时使用json
+func Decode(msg *nats.Msg, v interface{}) error {
+	var contentType string
+	if msg.Header != nil {
+		contentType = msg.Header.Get("Content-Type")
+	}
+	e, err := encoding.ForContentType(contentType)
+	if err != nil {
+		return err
+	}
+	return e.Unmarshal(msg.Data, v)
+}
+
 // GetClient 获取nats操作对象
 func GetClient() *Client {
 	if client == nil {
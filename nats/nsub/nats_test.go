@@ -6,8 +6,12 @@ import (
 	"testing"
 	"time"
 
+	"github.com/zhufuyi/pkg/encoding"
 	"github.com/zhufuyi/pkg/nats/npub"
 	"github.com/zhufuyi/pkg/utils"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
 )
 
 var natsAddr = []string{"nats://192.168.101.88:4222"}
@@ -69,3 +73,25 @@ func TestClient_SubscribeSync(t *testing.T) {
 		}
 	}
 }
+
+func TestDecode(t *testing.T) {
+	type user struct {
+		Name string `json:"name"`
+	}
+
+	msg := nats.NewMsg("foo")
+	msg.Header.Set("Content-Type", "application/msgpack")
+	msg.Data, _ = encoding.MsgPackEncoding{}.Marshal(&user{Name: "foo"})
+	u := &user{}
+	assert.NoError(t, Decode(msg, u))
+	assert.Equal(t, "foo", u.Name)
+
+	// 没有Content-Type时使用json
+	msg = &nats.Msg{Subject: "foo", Data: []byte(`{"name":"bar"}`)}
+	assert.NoError(t, Decode(msg, u))
+	assert.Equal(t, "bar", u.Name)
+
+	msg = nats.NewMsg("foo")
+	msg.Header.Set("Content-Type", "text/unknown")
+	assert.ErrorIs(t, Decode(msg, u), encoding.ErrUnsupportedMediaType)
+}
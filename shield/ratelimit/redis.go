@@ -0,0 +1,244 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/zhufuyi/pkg/krand"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	_ KeyLimiter = &RedisTokenBucket{}
+	_ KeyLimiter = &RedisSlidingWindow{}
+
+	// DefaultKeyPrefix redis限流key的默认前缀
+	DefaultKeyPrefix = "ratelimit:"
+	// DefaultKey Allow方法使用的key，所有请求共用一个配额
+	DefaultKey = "default"
+)
+
+// Result 按key限流的结果，用于设置响应头X-RateLimit-*和Retry-After
+type Result struct {
+	Limit      int           // 配额
+	Remaining  int           // 剩余配额
+	ResetAfter time.Duration // 配额完全恢复需要的时间
+	RetryAfter time.Duration // 被拒绝时多久之后可以重试，允许时为0
+}
+
+// KeyLimiter 按key限流，例如按api key、ip或用户id限流，在多个实例间共享配额
+type KeyLimiter interface {
+	Limiter
+	// Take 消耗key的一个配额，超过限制时返回ErrLimitExceed，result不为nil
+	Take(ctx context.Context, key string) (*Result, error)
+}
+
+// ForKey return a Limiter which limits by the key
+func ForKey(l KeyLimiter, key string) Limiter {
+	return &keyLimiter{l: l, key: key}
+}
+
+type keyLimiter struct {
+	l   KeyLimiter
+	key string
+}
+
+func (k *keyLimiter) Allow() (DoneFunc, error) {
+	if _, err := k.l.Take(context.Background(), k.key); err != nil {
+		return nil, err
+	}
+	return func(DoneInfo) {}, nil
+}
+
+// RedisOption set the redis limiter options.
+type RedisOption func(*redisOptions)
+
+type redisOptions struct {
+	prefix string
+}
+
+func (o *redisOptions) apply(opts ...RedisOption) {
+	for _, opt := range opts {
+		opt(o)
+	}
+}
+
+func defaultRedisOptions() *redisOptions {
+	return &redisOptions{
+		prefix: DefaultKeyPrefix,
+	}
+}
+
+// WithKeyPrefix set the prefix of redis key, the default is ratelimit:
+func WithKeyPrefix(prefix string) RedisOption {
+	return func(o *redisOptions) {
+		o.prefix = prefix
+	}
+}
+
+// ------------------------------------------------------------------------------------------
+
+// 使用redis的时间(毫秒)，多个实例的时钟不一致时不影响限流
+const redisNowScript = `
+redis.replicate_commands()
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+`
+
+// 令牌桶，按时间补充令牌，返回 {是否允许, 剩余令牌(向下取整), 重试等待毫秒, 补满等待毫秒}
+var tokenBucketScript = redis.NewScript(redisNowScript + `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local data = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(data[1])
+local ts = tonumber(data[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / 1000)
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = math.ceil((1 - tokens) * 1000 / rate)
+end
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "ts", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil(burst * 1000 / rate) + 1000)
+return {allowed, math.floor(tokens), retry, math.ceil((burst - tokens) * 1000 / rate)}
+`)
+
+// RedisTokenBucket 基于redis的令牌桶限流，允许突发请求，多个实例共享配额
+type RedisTokenBucket struct {
+	client redis.UniversalClient
+	rate   float64 // 每秒补充的令牌数
+	burst  int
+	opts   *redisOptions
+}
+
+// NewRedisTokenBucket create a token bucket limiter, limit requests per period, burst is the bucket size,
+// e.g. NewRedisTokenBucket(client, 100, time.Minute, 100) allows 100 requests per minute
+func NewRedisTokenBucket(client redis.UniversalClient, limit int, period time.Duration, burst int, opts ...RedisOption) *RedisTokenBucket {
+	o := defaultRedisOptions()
+	o.apply(opts...)
+	if limit <= 0 || period <= 0 {
+		panic("ratelimit: limit and period must be greater than 0")
+	}
+	if burst <= 0 {
+		burst = limit
+	}
+	return &RedisTokenBucket{
+		client: client,
+		rate:   float64(limit) / period.Seconds(),
+		burst:  burst,
+		opts:   o,
+	}
+}
+
+// Take consume a token of the key
+func (l *RedisTokenBucket) Take(ctx context.Context, key string) (*Result, error) {
+	vals, err := tokenBucketScript.Run(ctx, l.client, []string{l.opts.prefix + key},
+		strconv.FormatFloat(l.rate, 'f', -1, 64), l.burst).Int64Slice()
+	if err != nil {
+		return nil, err
+	}
+	return parseResult(l.burst, vals)
+}
+
+// Allow consume a token of DefaultKey, satisfy the Limiter interface
+func (l *RedisTokenBucket) Allow() (DoneFunc, error) {
+	return ForKey(l, DefaultKey).Allow()
+}
+
+// ------------------------------------------------------------------------------------------
+
+// 滑动窗口日志，窗口内每个请求记录在有序集合中，返回 {是否允许, 剩余次数, 重试等待毫秒, 窗口重置等待毫秒}
+var slidingWindowScript = redis.NewScript(redisNowScript + `
+local window = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now - window)
+local count = redis.call("ZCARD", KEYS[1])
+local allowed = 0
+if count < limit then
+	redis.call("ZADD", KEYS[1], now, ARGV[3])
+	redis.call("PEXPIRE", KEYS[1], window)
+	count = count + 1
+	allowed = 1
+end
+local oldest = redis.call("ZRANGE", KEYS[1], 0, 0, "WITHSCORES")
+local reset = 0
+if oldest[2] then
+	reset = tonumber(oldest[2]) + window - now
+end
+local retry = 0
+if allowed == 0 then
+	retry = reset
+end
+return {allowed, limit - count, retry, reset}
+`)
+
+// RedisSlidingWindow 基于redis的滑动窗口限流，任意一个窗口内的请求数不超过限制，多个实例共享配额
+type RedisSlidingWindow struct {
+	client redis.UniversalClient
+	limit  int
+	window time.Duration
+	opts   *redisOptions
+
+	seq    uint64
+	nodeID string
+}
+
+// NewRedisSlidingWindow create a sliding window limiter, limit requests in any window,
+// e.g. NewRedisSlidingWindow(client, 100, time.Minute) allows 100 requests per minute
+func NewRedisSlidingWindow(client redis.UniversalClient, limit int, window time.Duration, opts ...RedisOption) *RedisSlidingWindow {
+	o := defaultRedisOptions()
+	o.apply(opts...)
+	if limit <= 0 || window < time.Millisecond {
+		panic("ratelimit: limit and window must be greater than 0")
+	}
+	return &RedisSlidingWindow{
+		client: client,
+		limit:  limit,
+		window: window,
+		opts:   o,
+		nodeID: krand.String(krand.R_All, 16),
+	}
+}
+
+// Take consume a request of the key
+func (l *RedisSlidingWindow) Take(ctx context.Context, key string) (*Result, error) {
+	member := fmt.Sprintf("%s-%d", l.nodeID, atomic.AddUint64(&l.seq, 1)) // 同一毫秒的请求不能重复
+	vals, err := slidingWindowScript.Run(ctx, l.client, []string{l.opts.prefix + key},
+		l.window.Milliseconds(), l.limit, member).Int64Slice()
+	if err != nil {
+		return nil, err
+	}
+	return parseResult(l.limit, vals)
+}
+
+// Allow consume a request of DefaultKey, satisfy the Limiter interface
+func (l *RedisSlidingWindow) Allow() (DoneFunc, error) {
+	return ForKey(l, DefaultKey).Allow()
+}
+
+func parseResult(limit int, vals []int64) (*Result, error) {
+	if len(vals) != 4 {
+		return nil, fmt.Errorf("ratelimit: unexpected script result %v", vals)
+	}
+	result := &Result{
+		Limit:      limit,
+		Remaining:  int(vals[1]),
+		RetryAfter: time.Duration(vals[2]) * time.Millisecond,
+		ResetAfter: time.Duration(vals[3]) * time.Millisecond,
+	}
+	if vals[0] != 1 {
+		return result, ErrLimitExceed
+	}
+	return result, nil
+}
@@ -0,0 +1,125 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRedisClient(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	return s, redis.NewClient(&redis.Options{Addr: s.Addr()})
+}
+
+func TestRedisTokenBucket(t *testing.T) {
+	s, client := newRedisClient(t)
+	now := time.Now()
+	s.SetTime(now) // 限流使用redis的时间
+	l := NewRedisTokenBucket(client, 10, time.Second, 5, WithKeyPrefix("test:"))
+	ctx := context.Background()
+
+	// 突发5个请求
+	for i := 0; i < 5; i++ {
+		result, err := l.Take(ctx, "user1")
+		assert.NoError(t, err)
+		assert.Equal(t, 5, result.Limit)
+		assert.Equal(t, 4-i, result.Remaining)
+	}
+	result, err := l.Take(ctx, "user1")
+	assert.ErrorIs(t, err, ErrLimitExceed)
+	assert.Equal(t, 0, result.Remaining)
+	assert.Equal(t, time.Millisecond*100, result.RetryAfter)
+	assert.Equal(t, time.Millisecond*500, result.ResetAfter)
+
+	// 其他key不受影响
+	_, err = l.Take(ctx, "user2")
+	assert.NoError(t, err)
+
+	// 每100毫秒补充一个令牌
+	now = now.Add(time.Millisecond * 250)
+	s.SetTime(now)
+	for i := 0; i < 2; i++ {
+		_, err = l.Take(ctx, "user1")
+		assert.NoError(t, err)
+	}
+	_, err = l.Take(ctx, "user1")
+	assert.ErrorIs(t, err, ErrLimitExceed)
+
+	// 令牌不超过桶的容量
+	now = now.Add(time.Hour)
+	s.SetTime(now)
+	result, err = l.Take(ctx, "user1")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, result.Remaining)
+
+	assert.Panics(t, func() { NewRedisTokenBucket(client, 0, time.Second, 0) })
+}
+
+func TestRedisSlidingWindow(t *testing.T) {
+	s, client := newRedisClient(t)
+	now := time.Now()
+	s.SetTime(now)
+	l := NewRedisSlidingWindow(client, 3, time.Second)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		result, err := l.Take(ctx, "ip1")
+		assert.NoError(t, err)
+		assert.Equal(t, 2-i, result.Remaining)
+		now = now.Add(time.Millisecond * 100)
+		s.SetTime(now)
+	}
+	result, err := l.Take(ctx, "ip1")
+	assert.ErrorIs(t, err, ErrLimitExceed)
+	assert.Equal(t, 3, result.Limit)
+	assert.Equal(t, 0, result.Remaining)
+	assert.Equal(t, time.Millisecond*700, result.RetryAfter)
+
+	// 第一个请求滑出窗口后可以再请求一次
+	now = now.Add(time.Millisecond * 700)
+	s.SetTime(now)
+	result, err = l.Take(ctx, "ip1")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, result.Remaining)
+	_, err = l.Take(ctx, "ip1")
+	assert.ErrorIs(t, err, ErrLimitExceed)
+
+	assert.Panics(t, func() { NewRedisSlidingWindow(client, 1, 0) })
+	// 每个实例的nodeID不同，同一毫秒的请求不会覆盖
+	assert.NotEqual(t, l.nodeID, NewRedisSlidingWindow(client, 3, time.Second).nodeID)
+}
+
+func TestKeyLimiterAllow(t *testing.T) {
+	s, client := newRedisClient(t)
+
+	var limiters = []KeyLimiter{
+		NewRedisTokenBucket(client, 2, time.Minute, 0),
+		NewRedisSlidingWindow(client, 2, time.Minute, WithKeyPrefix("sw:")),
+	}
+	for _, l := range limiters {
+		for i := 0; i < 2; i++ {
+			done, err := l.Allow()
+			assert.NoError(t, err)
+			done(DoneInfo{})
+		}
+		_, err := l.Allow()
+		assert.ErrorIs(t, err, ErrLimitExceed)
+
+		_, err = ForKey(l, "other").Allow()
+		assert.NoError(t, err)
+	}
+
+	// redis错误
+	s.Close()
+	_, err := limiters[0].Take(context.Background(), "foo")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrLimitExceed)
+}
@@ -0,0 +1,199 @@
+package snowflake
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Generator id生成器，IDWorker和SegmentGenerator生成int64类型的id，
+// UUIDv7Generator和ULIDGenerator生成按时间排序的字符串id，不包含主机信息，不需要分配worker id
+type Generator[T int64 | string] interface {
+	NextID() (T, error)
+}
+
+var (
+	_ Generator[int64]  = (*IDWorker)(nil)
+	_ Generator[int64]  = (*SegmentGenerator)(nil)
+	_ Generator[string] = (*UUIDv7Generator)(nil)
+	_ Generator[string] = (*ULIDGenerator)(nil)
+)
+
+func nowMillis() int64 {
+	return time.Now().UnixMilli()
+}
+
+// ---------------------------------------------------------------------------------------
+
+// UUIDv7Generator 生成UUID version 7，前48位为毫秒时间戳，同一毫秒内使用12位计数器保证单调递增
+type UUIDv7Generator struct {
+	mu      sync.Mutex
+	lastMs  int64
+	counter uint16
+}
+
+// NewUUIDv7Generator create a UUIDv7 generator
+func NewUUIDv7Generator() *UUIDv7Generator {
+	return &UUIDv7Generator{}
+}
+
+// NextID return a UUIDv7 string, e.g. 0189d9a4-6f1c-7a3e-8f6b-2c1d0e9a4b7f
+func (g *UUIDv7Generator) NextID() (string, error) {
+	var b [16]byte
+	_, err := rand.Read(b[:])
+	if err != nil {
+		return "", fmt.Errorf("rand.Read error: %v", err)
+	}
+
+	g.mu.Lock()
+	ms := nowMillis()
+	if ms <= g.lastMs {
+		// 同一毫秒或时钟回拨，计数器加1，计数器用完时借用下一毫秒
+		ms = g.lastMs
+		g.counter++
+		if g.counter > 0xfff {
+			ms++
+			g.counter = binary.BigEndian.Uint16(b[6:8]) & 0x7ff
+		}
+	} else {
+		// 新的毫秒使用随机的初始值，最高位为0，留出递增空间
+		g.counter = binary.BigEndian.Uint16(b[6:8]) & 0x7ff
+	}
+	g.lastMs = ms
+	counter := g.counter
+	g.mu.Unlock()
+
+	b[0] = byte(ms >> 40)
+	b[1] = byte(ms >> 32)
+	b[2] = byte(ms >> 24)
+	b[3] = byte(ms >> 16)
+	b[4] = byte(ms >> 8)
+	b[5] = byte(ms)
+	b[6] = 0x70 | byte(counter>>8) // version 7
+	b[7] = byte(counter)
+	b[8] = 0x80 | b[8]&0x3f // variant 10
+
+	return formatUUID(b), nil
+}
+
+func formatUUID(b [16]byte) string {
+	var buf [36]byte
+	hex.Encode(buf[0:8], b[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], b[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], b[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], b[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], b[10:])
+	return string(buf[:])
+}
+
+// ---------------------------------------------------------------------------------------
+
+// crockford base32
+const ulidEncoding = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULIDGenerator 生成ULID，前48位为毫秒时间戳，后80位为随机数，同一毫秒内随机数加1保证单调递增
+type ULIDGenerator struct {
+	mu      sync.Mutex
+	lastMs  int64
+	lastRnd [10]byte
+}
+
+// NewULIDGenerator create a monotonic ULID generator
+func NewULIDGenerator() *ULIDGenerator {
+	return &ULIDGenerator{}
+}
+
+// NextID return a 26 characters ULID string, e.g. 01H6GZ8Q3W5X9V2K7M4N1P0R8T
+func (g *ULIDGenerator) NextID() (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := nowMillis()
+	if ms <= g.lastMs && incrBytes(g.lastRnd[:]) {
+		// 同一毫秒或时钟回拨，随机数加1
+		ms = g.lastMs
+	} else {
+		if ms <= g.lastMs {
+			// 随机数溢出，借用下一毫秒
+			ms = g.lastMs + 1
+		}
+		_, err := rand.Read(g.lastRnd[:])
+		if err != nil {
+			return "", fmt.Errorf("rand.Read error: %v", err)
+		}
+	}
+	g.lastMs = ms
+
+	var b [16]byte
+	b[0] = byte(ms >> 40)
+	b[1] = byte(ms >> 32)
+	b[2] = byte(ms >> 24)
+	b[3] = byte(ms >> 16)
+	b[4] = byte(ms >> 8)
+	b[5] = byte(ms)
+	copy(b[6:], g.lastRnd[:])
+
+	return encodeULID(b), nil
+}
+
+// 大端字节数组加1，溢出时返回false
+func incrBytes(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// 128位编码为26个字符，第一个字符只使用3位
+func encodeULID(b [16]byte) string {
+	var buf [26]byte
+	for i := 0; i < 26; i++ {
+		var v byte
+		for j := 0; j < 5; j++ {
+			bit := i*5 + j - 2 // 前面补2个0
+			v <<= 1
+			if bit >= 0 && b[bit/8]&(0x80>>(bit%8)) != 0 {
+				v |= 1
+			}
+		}
+		buf[i] = ulidEncoding[v]
+	}
+	return string(buf[:])
+}
+
+// ---------------------------------------------------------------------------------------
+
+var (
+	uuidGen = NewUUIDv7Generator()
+	ulidGen = NewULIDGenerator()
+)
+
+// NewUUIDv7 create a UUIDv7 string, return empty string when failed
+func NewUUIDv7() string {
+	id, err := uuidGen.NextID()
+	if err != nil {
+		fmt.Printf("create uuid failed, %s\n", err.Error())
+		return ""
+	}
+	return id
+}
+
+// NewULID create a ULID string, return empty string when failed
+func NewULID() string {
+	id, err := ulidGen.NextID()
+	if err != nil {
+		fmt.Printf("create ulid failed, %s\n", err.Error())
+		return ""
+	}
+	return id
+}
@@ -0,0 +1,93 @@
+package snowflake
+
+import (
+	"regexp"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUUIDv7(t *testing.T) {
+	g := NewUUIDv7Generator()
+	re := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	var ids []string
+	for i := 0; i < 10000; i++ {
+		id, err := g.NextID()
+		assert.NoError(t, err)
+		ids = append(ids, id)
+	}
+	assert.True(t, re.MatchString(ids[0]), ids[0])
+	// 单调递增
+	assert.True(t, sort.StringsAreSorted(ids))
+	assert.Equal(t, len(ids), countUnique(ids))
+
+	assert.Len(t, NewUUIDv7(), 36)
+}
+
+func TestULID(t *testing.T) {
+	g := NewULIDGenerator()
+	re := regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`)
+
+	var ids []string
+	for i := 0; i < 10000; i++ {
+		id, err := g.NextID()
+		assert.NoError(t, err)
+		ids = append(ids, id)
+	}
+	assert.True(t, re.MatchString(ids[0]), ids[0])
+	assert.True(t, sort.StringsAreSorted(ids))
+	assert.Equal(t, len(ids), countUnique(ids))
+
+	// 随机数溢出时借用下一毫秒
+	for i := range g.lastRnd {
+		g.lastRnd[i] = 0xff
+	}
+	g.lastMs = nowMillis() + 10
+	last := g.lastMs
+	_, err := g.NextID()
+	assert.NoError(t, err)
+	assert.Equal(t, last+1, g.lastMs)
+
+	assert.Len(t, NewULID(), 26)
+}
+
+func TestGeneratorConcurrent(t *testing.T) {
+	g := NewULIDGenerator()
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var ids []string
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				id, _ := g.NextID()
+				mu.Lock()
+				ids = append(ids, id)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 10000, countUnique(ids))
+}
+
+func TestEncodeULID(t *testing.T) {
+	var b [16]byte
+	assert.Equal(t, "00000000000000000000000000", encodeULID(b))
+	for i := range b {
+		b[i] = 0xff
+	}
+	assert.Equal(t, "7ZZZZZZZZZZZZZZZZZZZZZZZZZ", encodeULID(b))
+}
+
+func countUnique(ids []string) int {
+	m := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		m[id] = struct{}{}
+	}
+	return len(m)
+}
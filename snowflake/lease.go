@@ -0,0 +1,382 @@
+package snowflake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/zhufuyi/pkg/krand"
+	"github.com/zhufuyi/pkg/logger"
+
+	"github.com/go-redis/redis/v8"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+var (
+	// ErrNoWorkerID 所有worker id都已被其他实例租用
+	ErrNoWorkerID = errors.New("no available worker id")
+	// ErrLeaseLost 租约已过期并被其他实例租用
+	ErrLeaseLost = errors.New("worker id lease lost")
+
+	// DefaultLeasePrefix 租用worker id的key前缀
+	DefaultLeasePrefix = "snowflake:worker:"
+	// DefaultLeaseTTL 租约默认过期时间，实例异常退出后worker id在过期后可以被其他实例租用
+	DefaultLeaseTTL = time.Second * 30
+)
+
+// WorkerIDLeaser 从redis或etcd租用worker id，同一时间一个worker id只会被一个实例租用
+type WorkerIDLeaser interface {
+	// Acquire 租用一个空闲的worker id，取值范围[0, maxWorkerID]
+	Acquire(ctx context.Context, maxWorkerID int64) (int64, error)
+	// Renew 续期，租约已被其他实例持有时返回ErrLeaseLost
+	Renew(ctx context.Context, workerID int64) error
+	// Release 释放worker id
+	Release(ctx context.Context, workerID int64) error
+	// TTL 租约过期时间
+	TTL() time.Duration
+}
+
+// LeaserOption set the leaser options.
+type LeaserOption func(*leaserOptions)
+
+type leaserOptions struct {
+	prefix string
+	ttl    time.Duration
+}
+
+func (o *leaserOptions) apply(opts ...LeaserOption) {
+	for _, opt := range opts {
+		opt(o)
+	}
+}
+
+func defaultLeaserOptions() *leaserOptions {
+	return &leaserOptions{
+		prefix: DefaultLeasePrefix,
+		ttl:    DefaultLeaseTTL,
+	}
+}
+
+// WithLeasePrefix set the key prefix of the leased worker id
+func WithLeasePrefix(prefix string) LeaserOption {
+	return func(o *leaserOptions) {
+		o.prefix = prefix
+	}
+}
+
+// WithLeaseTTL set the ttl of the lease, the default is 30s
+func WithLeaseTTL(d time.Duration) LeaserOption {
+	return func(o *leaserOptions) {
+		if d > 0 {
+			o.ttl = d
+		}
+	}
+}
+
+// 当前实例标识，主机名:进程id:随机字符串
+func newToken() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d:%s", hostname, os.Getpid(), krand.String(krand.R_All, 8))
+}
+
+// 从随机位置开始查找空闲的worker id，减少多个实例同时启动时的冲突
+func tryAcquire(maxWorkerID int64, fn func(workerID int64) (bool, error)) (int64, error) {
+	n := maxWorkerID + 1
+	start := rand.Int63n(n)
+	for i := int64(0); i < n; i++ {
+		workerID := (start + i) % n
+		ok, err := fn(workerID)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			return workerID, nil
+		}
+	}
+	return 0, ErrNoWorkerID
+}
+
+// 续期，key已过期时重新设置，key被其他实例持有时返回0
+var renewScript = redis.NewScript(`
+local val = redis.call("GET", KEYS[1])
+if val == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+if not val then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	return 1
+end
+return 0
+`)
+
+// 只有持有者才能释放
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+type redisLeaser struct {
+	client *redis.Client
+	token  string
+	opts   *leaserOptions
+}
+
+// NewRedisLeaser create a worker id leaser based on redis
+func NewRedisLeaser(client *redis.Client, opts ...LeaserOption) WorkerIDLeaser {
+	o := defaultLeaserOptions()
+	o.apply(opts...)
+	return &redisLeaser{client: client, token: newToken(), opts: o}
+}
+
+func (l *redisLeaser) key(workerID int64) string {
+	return fmt.Sprintf("%s%d", l.opts.prefix, workerID)
+}
+
+// Acquire set key if not exists
+func (l *redisLeaser) Acquire(ctx context.Context, maxWorkerID int64) (int64, error) {
+	return tryAcquire(maxWorkerID, func(workerID int64) (bool, error) {
+		ok, err := l.client.SetNX(ctx, l.key(workerID), l.token, l.opts.ttl).Result()
+		if err != nil {
+			return false, fmt.Errorf("l.client.SetNX error: %v, workerID=%d", err, workerID)
+		}
+		return ok, nil
+	})
+}
+
+// Renew extend the ttl of the key
+func (l *redisLeaser) Renew(ctx context.Context, workerID int64) error {
+	n, err := renewScript.Run(ctx, l.client, []string{l.key(workerID)}, l.token, l.opts.ttl.Milliseconds()).Int()
+	if err != nil {
+		return fmt.Errorf("renew error: %v, workerID=%d", err, workerID)
+	}
+	if n == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// TTL return the ttl of the lease
+func (l *redisLeaser) TTL() time.Duration {
+	return l.opts.ttl
+}
+
+// Release delete the key held by self
+func (l *redisLeaser) Release(ctx context.Context, workerID int64) error {
+	_, err := releaseScript.Run(ctx, l.client, []string{l.key(workerID)}, l.token).Result()
+	if err != nil {
+		return fmt.Errorf("release error: %v, workerID=%d", err, workerID)
+	}
+	return nil
+}
+
+type etcdLeaser struct {
+	client *clientv3.Client
+	token  string
+	opts   *leaserOptions
+
+	mu      sync.Mutex
+	leaseID clientv3.LeaseID
+}
+
+// NewEtcdLeaser create a worker id leaser based on etcd
+func NewEtcdLeaser(client *clientv3.Client, opts ...LeaserOption) WorkerIDLeaser {
+	o := defaultLeaserOptions()
+	o.apply(opts...)
+	return &etcdLeaser{client: client, token: newToken(), opts: o}
+}
+
+func (l *etcdLeaser) key(workerID int64) string {
+	return fmt.Sprintf("%s%d", l.opts.prefix, workerID)
+}
+
+// Acquire put key with lease if not exists
+func (l *etcdLeaser) Acquire(ctx context.Context, maxWorkerID int64) (int64, error) {
+	seconds := int64(l.opts.ttl / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	lease, err := l.client.Grant(ctx, seconds)
+	if err != nil {
+		return 0, fmt.Errorf("l.client.Grant error: %v", err)
+	}
+
+	workerID, err := tryAcquire(maxWorkerID, func(workerID int64) (bool, error) {
+		key := l.key(workerID)
+		resp, err := l.client.Txn(ctx).
+			If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+			Then(clientv3.OpPut(key, l.token, clientv3.WithLease(lease.ID))).
+			Commit()
+		if err != nil {
+			return false, fmt.Errorf("l.client.Txn error: %v, workerID=%d", err, workerID)
+		}
+		return resp.Succeeded, nil
+	})
+	if err != nil {
+		_, _ = l.client.Revoke(context.Background(), lease.ID)
+		return 0, err
+	}
+
+	l.mu.Lock()
+	l.leaseID = lease.ID
+	l.mu.Unlock()
+	return workerID, nil
+}
+
+// Renew keep the lease alive once
+func (l *etcdLeaser) Renew(ctx context.Context, workerID int64) error {
+	l.mu.Lock()
+	leaseID := l.leaseID
+	l.mu.Unlock()
+
+	_, err := l.client.KeepAliveOnce(ctx, leaseID)
+	if err != nil {
+		if errors.Is(err, rpctypes.ErrLeaseNotFound) {
+			return ErrLeaseLost
+		}
+		return fmt.Errorf("l.client.KeepAliveOnce error: %v, workerID=%d", err, workerID)
+	}
+	return nil
+}
+
+// TTL return the ttl of the lease
+func (l *etcdLeaser) TTL() time.Duration {
+	return l.opts.ttl
+}
+
+// Release revoke the lease, the key is deleted together
+func (l *etcdLeaser) Release(ctx context.Context, workerID int64) error {
+	l.mu.Lock()
+	leaseID := l.leaseID
+	l.mu.Unlock()
+
+	_, err := l.client.Revoke(ctx, leaseID)
+	if err != nil {
+		return fmt.Errorf("l.client.Revoke error: %v, workerID=%d", err, workerID)
+	}
+	return nil
+}
+
+// ---------------------------------------------------------------------------------------
+
+var (
+	leaseMutex sync.Mutex
+	leaser     WorkerIDLeaser
+	leaseStop  chan struct{}
+	leaseDone  chan struct{}
+)
+
+// InitWithLeaser 从redis或etcd租用worker id并初始化SnowFlake，后台定时续期，停止服务时调用Close释放worker id，
+// 租约丢失时暂停生成id并重新租用worker id，错误通过WithLeaseErrorHandler通知
+func InitWithLeaser(ctx context.Context, l WorkerIDLeaser, opts ...Option) error {
+	o := defaultOptions()
+	o.apply(opts...)
+	// 续期间隔太长时租约可能在两次续期之间过期，被其他实例租用后生成重复的id
+	if o.heartbeatInterval*3 > l.TTL() {
+		return fmt.Errorf("heartbeat interval %v must not be greater than 1/3 of lease ttl %v", o.heartbeatInterval, l.TTL())
+	}
+
+	leaseMutex.Lock()
+	defer leaseMutex.Unlock()
+	if leaser != nil {
+		return errors.New("worker id has been leased, call Close first")
+	}
+
+	deadline := time.Now().Add(l.TTL())
+	workerID, err := l.Acquire(ctx, getMaxWorkerID(o.workerIDBits))
+	if err != nil {
+		return err
+	}
+	err = Init(workerID, opts...)
+	if err != nil {
+		_ = l.Release(context.Background(), workerID)
+		return err
+	}
+
+	leaser = l
+	leaseStop = make(chan struct{})
+	leaseDone = make(chan struct{})
+	go heartbeat(l, iw, o, deadline, leaseStop, leaseDone)
+	return nil
+}
+
+// 定时续期，租约到期时间为发送续期请求的时间加上ttl，续期请求最多持续一个interval，
+// 剩余时间不足一个interval时先暂停生成id，避免租约过期后被其他实例租用，生成重复的id，
+// 租约丢失时重新租用worker id
+func heartbeat(l WorkerIDLeaser, w *IDWorker, o *options, deadline time.Time, stop chan struct{}, done chan struct{}) {
+	defer close(done)
+
+	interval := o.heartbeatInterval
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		workerID := w.WorkerID()
+		if time.Until(deadline) <= interval {
+			w.suspend(fmt.Errorf("%w, the lease may expire before it is renewed", ErrLeaseLost))
+		}
+
+		sent := time.Now()
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		err := l.Renew(ctx, workerID)
+		cancel()
+		if err == nil {
+			deadline = sent.Add(l.TTL())
+			w.resume(workerID)
+			continue
+		}
+		if !errors.Is(err, ErrLeaseLost) {
+			o.leaseErrorHandler(workerID, err)
+			if time.Until(deadline) > interval {
+				continue // 下一次续期前租约不会过期
+			}
+			err = fmt.Errorf("%w, not renewed before the lease expires: %v", ErrLeaseLost, err)
+		}
+		w.suspend(err)
+		o.leaseErrorHandler(workerID, err)
+
+		sent = time.Now()
+		ctx, cancel = context.WithTimeout(context.Background(), interval)
+		newWorkerID, err := l.Acquire(ctx, w.MaxWorkerID())
+		cancel()
+		if err != nil {
+			o.leaseErrorHandler(workerID, fmt.Errorf("re-acquire worker id error: %w", err))
+			continue // 下一次心跳时再续期或重新租用
+		}
+		deadline = sent.Add(l.TTL())
+		w.resume(newWorkerID)
+	}
+}
+
+func defaultLeaseErrorHandler(workerID int64, err error) {
+	logger.Warn("worker id lease error", logger.Err(err), logger.Int64("workerID", workerID))
+}
+
+// Close 停止续期并释放租用的worker id
+func Close() error {
+	leaseMutex.Lock()
+	defer leaseMutex.Unlock()
+	if leaser == nil {
+		return nil
+	}
+
+	close(leaseStop)
+	<-leaseDone
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	err := leaser.Release(ctx, iw.WorkerID())
+	leaser = nil
+	return err
+}
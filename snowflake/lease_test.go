@@ -0,0 +1,206 @@
+package snowflake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisLeaser(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	ctx := context.Background()
+
+	l1 := NewRedisLeaser(client, WithLeaseTTL(time.Second*10))
+	l2 := NewRedisLeaser(client, WithLeaseTTL(time.Second*10))
+
+	// 不同实例租用不同的worker id
+	id1, err := l1.Acquire(ctx, 1)
+	assert.NoError(t, err)
+	id2, err := l2.Acquire(ctx, 1)
+	assert.NoError(t, err)
+	assert.NotEqual(t, id1, id2)
+	_, err = l2.Acquire(ctx, 1)
+	assert.ErrorIs(t, err, ErrNoWorkerID)
+
+	// 续期
+	s.FastForward(time.Second * 8)
+	assert.NoError(t, l1.Renew(ctx, id1))
+	s.FastForward(time.Second * 8)
+	assert.True(t, s.Exists(fmt.Sprintf("%s%d", DefaultLeasePrefix, id1)))
+	assert.False(t, s.Exists(fmt.Sprintf("%s%d", DefaultLeasePrefix, id2)))
+
+	// 过期后被其他实例租用
+	id3, err := NewRedisLeaser(client).Acquire(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, id2, id3)
+	assert.ErrorIs(t, l2.Renew(ctx, id2), ErrLeaseLost)
+
+	// 只能释放自己持有的worker id
+	assert.NoError(t, l2.Release(ctx, id2))
+	assert.True(t, s.Exists(fmt.Sprintf("%s%d", DefaultLeasePrefix, id3)))
+	assert.NoError(t, l1.Release(ctx, id1))
+	assert.False(t, s.Exists(fmt.Sprintf("%s%d", DefaultLeasePrefix, id1)))
+}
+
+func TestInitWithLeaser(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+
+	leaser := NewRedisLeaser(client, WithLeasePrefix("test:worker:"))
+	err = InitWithLeaser(context.Background(), leaser, WithBits(4, 12), WithHeartbeatInterval(time.Millisecond*50))
+	assert.NoError(t, err)
+	assert.Error(t, InitWithLeaser(context.Background(), leaser))
+
+	id := NewID()
+	_, workerID, _ := Decode(id)
+	key := fmt.Sprintf("test:worker:%d", workerID)
+	assert.True(t, s.Exists(key))
+
+	// 心跳续期
+	s.FastForward(time.Second * 20)
+	time.Sleep(time.Millisecond * 100)
+	s.FastForward(time.Second * 20)
+	assert.True(t, s.Exists(key))
+
+	// 释放worker id
+	assert.NoError(t, Close())
+	assert.False(t, s.Exists(key))
+	assert.NoError(t, Close())
+
+	// 续期间隔必须远小于租约过期时间
+	err = InitWithLeaser(context.Background(), NewRedisLeaser(client, WithLeaseTTL(time.Second*30)), WithHeartbeatInterval(time.Second*20))
+	assert.Error(t, err)
+}
+
+func TestLeaseLost(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+
+	errCh := make(chan error, 10)
+	leaser := NewRedisLeaser(client, WithLeasePrefix("test:worker:"), WithLeaseTTL(time.Second))
+	err = InitWithLeaser(context.Background(), leaser, WithBits(1, 12),
+		WithHeartbeatInterval(time.Millisecond*50),
+		WithLeaseErrorHandler(func(workerID int64, err error) {
+			select {
+			case errCh <- err:
+			default:
+			}
+		}))
+	assert.NoError(t, err)
+	defer Close()
+
+	// 两个worker id都被其他实例租用，暂停生成id
+	workerID := iw.WorkerID()
+	otherID := 1 - workerID
+	assert.NoError(t, s.Set(fmt.Sprintf("test:worker:%d", workerID), "other"))
+	assert.NoError(t, s.Set(fmt.Sprintf("test:worker:%d", otherID), "other"))
+	select {
+	case err = <-errCh:
+		assert.ErrorIs(t, err, ErrLeaseLost)
+	case <-time.After(time.Second):
+		t.Fatal("lease lost is not notified")
+	}
+	_, err = iw.NextID()
+	assert.ErrorIs(t, err, ErrLeaseLost)
+	assert.Equal(t, int64(-1), NewID())
+
+	// 其他worker id空闲后重新租用，恢复生成id
+	s.Del(fmt.Sprintf("test:worker:%d", otherID))
+	assert.Eventually(t, func() bool {
+		_, err := iw.NextID()
+		return err == nil
+	}, time.Second, time.Millisecond*20)
+	_, newWorkerID, _ := Decode(NewID())
+	assert.Equal(t, otherID, newWorkerID)
+	assert.True(t, s.Exists(fmt.Sprintf("test:worker:%d", otherID)))
+}
+
+// 设置hang后Renew一直阻塞直到超时，Acquire返回错误，租约到期时间从发送续期请求开始计算
+type hangLeaser struct {
+	ttl      time.Duration
+	hang     int32
+	mu       sync.Mutex
+	lastSent time.Time // 最后一次成功续期的发送时间
+}
+
+func (l *hangLeaser) Acquire(ctx context.Context, maxWorkerID int64) (int64, error) {
+	if atomic.LoadInt32(&l.hang) == 1 {
+		return 0, errors.New("unavailable")
+	}
+	l.mu.Lock()
+	l.lastSent = time.Now()
+	l.mu.Unlock()
+	return 0, nil
+}
+
+func (l *hangLeaser) Renew(ctx context.Context, workerID int64) error {
+	sent := time.Now()
+	if atomic.LoadInt32(&l.hang) == 1 {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	time.Sleep(l.ttl / 5) // 续期成功也有延迟
+	l.mu.Lock()
+	l.lastSent = sent
+	l.mu.Unlock()
+	return nil
+}
+
+func (l *hangLeaser) Release(ctx context.Context, workerID int64) error {
+	return nil
+}
+
+func (l *hangLeaser) TTL() time.Duration {
+	return l.ttl
+}
+
+func TestLeaseRenewHang(t *testing.T) {
+	leaser := &hangLeaser{ttl: time.Millisecond * 300}
+	err := InitWithLeaser(context.Background(), leaser, WithHeartbeatInterval(time.Millisecond*100),
+		WithLeaseErrorHandler(func(workerID int64, err error) {}))
+	assert.NoError(t, err)
+	defer Close()
+
+	time.Sleep(time.Millisecond * 250)
+	atomic.StoreInt32(&leaser.hang, 1)
+
+	// 续期一直阻塞，租约到期前停止生成id
+	var lastID time.Time
+	start := time.Now()
+	for time.Since(start) < time.Second {
+		if _, err := iw.NextID(); err == nil {
+			lastID = time.Now()
+		} else {
+			assert.ErrorIs(t, err, ErrLeaseLost)
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+	leaser.mu.Lock()
+	expire := leaser.lastSent.Add(leaser.ttl)
+	leaser.mu.Unlock()
+	assert.False(t, lastID.IsZero())
+	assert.True(t, lastID.Before(expire), "id generated %v after the lease expired", lastID.Sub(expire))
+	_, err = iw.NextID()
+	assert.ErrorIs(t, err, ErrLeaseLost)
+}
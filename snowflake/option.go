@@ -0,0 +1,90 @@
+package snowflake
+
+import "time"
+
+var (
+	// DefaultEpoch 默认起始时间(2016-05-30 21:12:35 +0800)
+	DefaultEpoch = time.UnixMilli(1464613955000)
+	// DefaultWorkerIDBits worker id默认占用的位数，最多1024个worker
+	DefaultWorkerIDBits = 10
+	// DefaultSequenceBits 序列号默认占用的位数，每个worker每毫秒最多生成4096个id
+	DefaultSequenceBits = 12
+	// DefaultMaxClockDrift 默认容忍的时钟回拨时间，回拨时间在范围内时等待，超过时返回错误
+	DefaultMaxClockDrift = time.Millisecond * 10
+	// DefaultHeartbeatInterval 租用worker id的默认续期间隔，不能超过租约过期时间的1/3
+	DefaultHeartbeatInterval = time.Second * 10
+)
+
+// Option set the id worker options.
+type Option func(*options)
+
+type options struct {
+	epoch             time.Time
+	workerIDBits      int
+	sequenceBits      int
+	maxClockDrift     time.Duration
+	heartbeatInterval time.Duration
+	leaseErrorHandler func(workerID int64, err error)
+}
+
+func (o *options) apply(opts ...Option) {
+	for _, opt := range opts {
+		opt(o)
+	}
+}
+
+func defaultOptions() *options {
+	return &options{
+		epoch:             DefaultEpoch,
+		workerIDBits:      DefaultWorkerIDBits,
+		sequenceBits:      DefaultSequenceBits,
+		maxClockDrift:     DefaultMaxClockDrift,
+		heartbeatInterval: DefaultHeartbeatInterval,
+		leaseErrorHandler: defaultLeaseErrorHandler,
+	}
+}
+
+// WithEpoch set the start time of the timestamp, it cannot be changed after ids are generated
+func WithEpoch(epoch time.Time) Option {
+	return func(o *options) {
+		o.epoch = epoch
+	}
+}
+
+// WithBits set the bits of worker id and sequence, the timestamp uses the remaining 63-workerIDBits-sequenceBits bits
+func WithBits(workerIDBits int, sequenceBits int) Option {
+	return func(o *options) {
+		o.workerIDBits = workerIDBits
+		o.sequenceBits = sequenceBits
+	}
+}
+
+// WithMaxClockDrift set the tolerance of clock moving backwards, wait for the clock to catch up within the tolerance,
+// 0 means return error immediately
+func WithMaxClockDrift(d time.Duration) Option {
+	return func(o *options) {
+		if d >= 0 {
+			o.maxClockDrift = d
+		}
+	}
+}
+
+// WithHeartbeatInterval set the renewal interval of the leased worker id, it must not be greater than 1/3 of the lease ttl
+func WithHeartbeatInterval(d time.Duration) Option {
+	return func(o *options) {
+		if d > 0 {
+			o.heartbeatInterval = d
+		}
+	}
+}
+
+// WithLeaseErrorHandler set the handler of heartbeat errors, it is called when renewal fails, the lease is lost
+// (err wraps ErrLeaseLost, NewID stops generating ids until a worker id is leased again) or re-acquiring fails,
+// the default handler logs the error
+func WithLeaseErrorHandler(fn func(workerID int64, err error)) Option {
+	return func(o *options) {
+		if fn != nil {
+			o.leaseErrorHandler = fn
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package snowflake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/zhufuyi/pkg/logger"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrBizTagNotFound 号段表中没有业务标识对应的记录
+	ErrBizTagNotFound = errors.New("biz tag not found")
+
+	// DefaultSegmentTable 号段表默认名称
+	DefaultSegmentTable = "id_segment"
+	// DefaultPreloadRatio 当前号段剩余id比例低于该值时预加载下一个号段
+	DefaultPreloadRatio = 0.8
+	// DefaultSegmentTimeout 从数据库获取号段的超时时间
+	DefaultSegmentTimeout = time.Second * 5
+)
+
+// IDSegment 号段表，每个业务一条记录，max_id为已分配的最大id，每次从数据库获取step个id，
+// 使用前先插入记录，例如 INSERT INTO id_segment(biz_tag, max_id, step) VALUES('order', 0, 1000)
+type IDSegment struct {
+	BizTag    string    `gorm:"column:biz_tag;type:varchar(128);primaryKey" json:"bizTag"`
+	MaxID     int64     `gorm:"column:max_id;not null;default:0" json:"maxID"`
+	Step      int64     `gorm:"column:step;not null" json:"step"`
+	UpdatedAt time.Time `gorm:"column:updated_at" json:"updatedAt"`
+}
+
+// SegmentOption set the segment generator options.
+type SegmentOption func(*segmentOptions)
+
+type segmentOptions struct {
+	table        string
+	preloadRatio float64
+	timeout      time.Duration
+}
+
+func (o *segmentOptions) apply(opts ...SegmentOption) {
+	for _, opt := range opts {
+		opt(o)
+	}
+}
+
+func defaultSegmentOptions() *segmentOptions {
+	return &segmentOptions{
+		table:        DefaultSegmentTable,
+		preloadRatio: DefaultPreloadRatio,
+		timeout:      DefaultSegmentTimeout,
+	}
+}
+
+// WithSegmentTable set the table name of the segment
+func WithSegmentTable(table string) SegmentOption {
+	return func(o *segmentOptions) {
+		o.table = table
+	}
+}
+
+// WithPreloadRatio preload the next segment when the ratio of remaining ids in the current segment is lower than ratio,
+// range (0, 1], the default is 0.8
+func WithPreloadRatio(ratio float64) SegmentOption {
+	return func(o *segmentOptions) {
+		if ratio > 0 && ratio <= 1 {
+			o.preloadRatio = ratio
+		}
+	}
+}
+
+// WithSegmentTimeout set the timeout of getting segment from database
+func WithSegmentTimeout(d time.Duration) SegmentOption {
+	return func(o *segmentOptions) {
+		if d > 0 {
+			o.timeout = d
+		}
+	}
+}
+
+// 号段范围[cursor, max]
+type segment struct {
+	cursor int64
+	max    int64
+	step   int64
+}
+
+func (s *segment) remaining() int64 {
+	return s.max - s.cursor + 1
+}
+
+// SegmentGenerator 号段模式id生成器，从mysql批量获取id，在内存中分配，
+// 双缓冲: 当前号段剩余id不足时在后台预加载下一个号段，当前号段用完后直接切换，不需要等待数据库
+type SegmentGenerator struct {
+	db     *gorm.DB
+	bizTag string
+	opts   *segmentOptions
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	current *segment
+	next    *segment
+	loading bool
+	loadErr error
+}
+
+// NewSegmentGenerator create a segment id generator, bizTag is the primary key of the segment table
+func NewSegmentGenerator(db *gorm.DB, bizTag string, opts ...SegmentOption) *SegmentGenerator {
+	o := defaultSegmentOptions()
+	o.apply(opts...)
+
+	g := &SegmentGenerator{
+		db:     db,
+		bizTag: bizTag,
+		opts:   o,
+	}
+	g.cond = sync.NewCond(&g.mu)
+	return g
+}
+
+// NextID return the next id
+func (g *SegmentGenerator) NextID() (int64, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for {
+		if g.current != nil && g.current.cursor <= g.current.max {
+			id := g.current.cursor
+			g.current.cursor++
+			g.preload()
+			return id, nil
+		}
+
+		// 当前号段用完，切换到预加载的号段
+		if g.next != nil {
+			g.current, g.next = g.next, nil
+			continue
+		}
+
+		// 正在加载，等待加载完成
+		if g.loading {
+			g.cond.Wait()
+			if g.next == nil && g.loadErr != nil {
+				return 0, g.loadErr
+			}
+			continue
+		}
+
+		// 同步加载
+		g.loading = true
+		g.mu.Unlock()
+		seg, err := g.fetch()
+		g.mu.Lock()
+		g.setLoaded(seg, err)
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// 剩余id比例低于阈值时在后台加载下一个号段，调用时持有锁
+func (g *SegmentGenerator) preload() {
+	if g.loading || g.next != nil {
+		return
+	}
+	if float64(g.current.remaining()) >= float64(g.current.step)*g.opts.preloadRatio {
+		return
+	}
+
+	g.loading = true
+	go func() {
+		seg, err := g.fetch()
+		g.mu.Lock()
+		g.setLoaded(seg, err)
+		g.mu.Unlock()
+		if err != nil {
+			// 错误保存在loadErr，当前号段用完后同步加载，仍然失败时返回给调用方
+			logger.Warn("preload segment error", logger.Err(err), logger.String("bizTag", g.bizTag))
+		}
+	}()
+}
+
+// 调用时持有锁
+func (g *SegmentGenerator) setLoaded(seg *segment, err error) {
+	g.loading = false
+	g.loadErr = err
+	if err == nil {
+		g.next = seg
+	}
+	g.cond.Broadcast()
+}
+
+// 在事务中增加max_id并读取新的号段
+func (g *SegmentGenerator) fetch() (*segment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), g.opts.timeout)
+	defer cancel()
+
+	row := &IDSegment{}
+	err := g.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Table(g.opts.table).Where("biz_tag = ?", g.bizTag).
+			Updates(map[string]interface{}{
+				"max_id":     gorm.Expr("max_id + step"),
+				"updated_at": time.Now(),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrBizTagNotFound
+		}
+		return tx.Table(g.opts.table).Where("biz_tag = ?", g.bizTag).Take(row).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get segment error: %w, bizTag=%s", err, g.bizTag)
+	}
+	if row.Step <= 0 {
+		return nil, fmt.Errorf("invalid step %d, bizTag=%s", row.Step, g.bizTag)
+	}
+
+	return &segment{
+		cursor: row.MaxID - row.Step + 1,
+		max:    row.MaxID,
+		step:   row.Step,
+	}, nil
+}
@@ -0,0 +1,61 @@
+package snowflake
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zhufuyi/pkg/gotest"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func expectSegment(mock sqlmock.Sqlmock, maxID int64, step int64) {
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `id_segment` SET .*max_id.*WHERE biz_tag = ?").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT \\* FROM `id_segment` WHERE biz_tag = ?").
+		WithArgs("order").
+		WillReturnRows(sqlmock.NewRows([]string{"biz_tag", "max_id", "step", "updated_at"}).
+			AddRow("order", maxID, step, time.Now()))
+	mock.ExpectCommit()
+}
+
+func TestSegmentGenerator(t *testing.T) {
+	d := gotest.NewDao(nil, nil)
+	defer d.Close()
+	db, mock := d.DB, d.SQLMock
+	for i := int64(1); i <= 4; i++ {
+		expectSegment(mock, i*10, 10)
+	}
+
+	g := NewSegmentGenerator(db, "order")
+	for i := int64(1); i <= 25; i++ {
+		id, err := g.NextID()
+		assert.NoError(t, err)
+		assert.Equal(t, i, id)
+	}
+
+	// 第3个号段使用超过20%时已经在后台预加载第4个号段
+	time.Sleep(time.Millisecond * 100)
+	g.mu.Lock()
+	require.NotNil(t, g.next)
+	assert.Equal(t, int64(31), g.next.cursor)
+	g.mu.Unlock()
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSegmentGeneratorError(t *testing.T) {
+	d := gotest.NewDao(nil, nil)
+	defer d.Close()
+	db, mock := d.DB, d.SQLMock
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `ids` SET .*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	g := NewSegmentGenerator(db, "order", WithSegmentTable("ids"), WithPreloadRatio(0.5), WithSegmentTimeout(time.Second))
+	_, err := g.NextID()
+	assert.ErrorIs(t, err, ErrBizTagNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
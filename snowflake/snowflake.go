@@ -7,6 +7,7 @@
 // +---------------+----------------+------------+
 // |timestamp(ms)  | worker node id | sequence	 |
 // +---------------+----------------+------------+
+// the default layout, bits of worker id and sequence can be changed by WithBits
 
 // Copyright (C) 2016 by zheng-ji.info
 
@@ -19,14 +20,11 @@ import (
 	"time"
 )
 
-const (
-	epoch = 1464613955000 // 毫秒
-
-	sequenceBits = 12 // Num of Sequence Bits
-	workerIDBits = 10 // Num of WorkerId Bits
-
-	workerIDShift  = 12 // workerIDBits  = sequenceBits
-	timestampShift = 22 // timestampShift = sequenceBits + workerIDBits
+var (
+	// ErrClockMovedBackwards 时钟回拨超过容忍时间
+	ErrClockMovedBackwards = errors.New("clock moved backwards, refuse to generate id")
+	// ErrTimestampOverflow 时间戳超过可用位数
+	ErrTimestampOverflow = errors.New("timestamp overflow, refuse to generate id")
 )
 
 // IDWorker Struct
@@ -38,14 +36,31 @@ type IDWorker struct {
 	sequenceMask int64
 	maxWorkerID  int64
 
+	epoch          int64 // 毫秒
+	workerIDShift  int64
+	timestampShift int64
+	maxTimestamp   int64
+	maxClockDrift  time.Duration
+	suspendErr     error // 租约丢失时不为nil，暂停生成id
+
 	lock *sync.Mutex
 }
 
 // NewIDWorker Func: Generate NewIdWorker with Given workerId
-func NewIDWorker(workerID int64) (iw *IDWorker, err error) {
+func NewIDWorker(workerID int64, opts ...Option) (iw *IDWorker, err error) {
+	o := defaultOptions()
+	o.apply(opts...)
+
+	if o.workerIDBits < 0 || o.sequenceBits < 1 || o.workerIDBits+o.sequenceBits >= 63 {
+		return nil, fmt.Errorf("invalid bits, workerIDBits=%d, sequenceBits=%d", o.workerIDBits, o.sequenceBits)
+	}
+	if o.epoch.After(time.Now()) {
+		return nil, fmt.Errorf("epoch %v is in the future", o.epoch)
+	}
+
 	iw = new(IDWorker)
 
-	iw.maxWorkerID = getMaxWorkerID()
+	iw.maxWorkerID = getMaxWorkerID(o.workerIDBits)
 
 	if workerID > iw.maxWorkerID || workerID < 0 {
 		return nil, errors.New("worker not fit")
@@ -54,20 +69,25 @@ func NewIDWorker(workerID int64) (iw *IDWorker, err error) {
 	iw.workerID = workerID
 	iw.lastTimeStamp = -1
 	iw.sequence = 0
-	iw.sequenceMask = getSequenceMask()
+	iw.sequenceMask = getSequenceMask(o.sequenceBits)
+	iw.epoch = o.epoch.UnixMilli()
+	iw.workerIDShift = int64(o.sequenceBits)
+	iw.timestampShift = int64(o.sequenceBits + o.workerIDBits)
+	iw.maxTimestamp = -1 ^ -1<<(63-iw.timestampShift)
+	iw.maxClockDrift = o.maxClockDrift
 	iw.lock = new(sync.Mutex)
 	return iw, nil
 }
 
 // 最大支持的WorkerID
-// 1023
-func getMaxWorkerID() int64 {
+// 默认1023
+func getMaxWorkerID(workerIDBits int) int64 {
 	return -1 ^ -1<<workerIDBits
 }
 
 // 最大支持的Sequence
-// 4095
-func getSequenceMask() int64 {
+// 默认4095
+func getSequenceMask(sequenceBits int) int64 {
 	return -1 ^ -1<<sequenceBits
 }
 
@@ -76,14 +96,12 @@ func (iw *IDWorker) genTimestamp() int64 {
 	return time.Now().UnixNano() / 1000000
 }
 
+// 等待直到下一毫秒
 func (iw *IDWorker) reGenTimestamp(last int64) int64 {
 	ts := iw.genTimestamp()
-	for {
-		if ts < last {
-			ts = iw.genTimestamp()
-		} else {
-			break
-		}
+	for ts <= last {
+		time.Sleep(time.Microsecond * 100)
+		ts = iw.genTimestamp()
 	}
 	return ts
 }
@@ -93,8 +111,22 @@ func (iw *IDWorker) NextID() (ts int64, err error) {
 	iw.lock.Lock()
 	defer iw.lock.Unlock()
 
+	if iw.suspendErr != nil {
+		return 0, iw.suspendErr
+	}
+
 	ts = iw.genTimestamp()
 
+	// 时钟回拨在容忍时间内时等待时钟追上，超过时返回错误
+	if ts < iw.lastTimeStamp {
+		drift := time.Duration(iw.lastTimeStamp-ts) * time.Millisecond
+		if drift > iw.maxClockDrift {
+			return 0, fmt.Errorf("%w, moved backwards %v", ErrClockMovedBackwards, drift)
+		}
+		time.Sleep(drift)
+		ts = iw.reGenTimestamp(iw.lastTimeStamp - 1)
+	}
+
 	if ts == iw.lastTimeStamp {
 		iw.sequence = (iw.sequence + 1) & iw.sequenceMask
 
@@ -105,26 +137,60 @@ func (iw *IDWorker) NextID() (ts int64, err error) {
 		iw.sequence = 0
 	}
 
-	if ts < iw.lastTimeStamp {
-		err = errors.New("Clock moved backwards, Refuse gen id")
-		return 0, err
+	if ts-iw.epoch > iw.maxTimestamp {
+		return 0, ErrTimestampOverflow
 	}
 
 	iw.lastTimeStamp = ts
 
-	ts = (ts-epoch)<<timestampShift | iw.workerID<<workerIDShift | iw.sequence
+	ts = (ts-iw.epoch)<<iw.timestampShift | iw.workerID<<iw.workerIDShift | iw.sequence
 
 	return ts, nil
 }
 
+// WorkerID return the worker id
+func (iw *IDWorker) WorkerID() int64 {
+	iw.lock.Lock()
+	defer iw.lock.Unlock()
+	return iw.workerID
+}
+
+// 租约丢失时暂停生成id，避免和租用了同一个worker id的实例生成重复的id
+func (iw *IDWorker) suspend(err error) {
+	iw.lock.Lock()
+	iw.suspendErr = err
+	iw.lock.Unlock()
+}
+
+// 续期成功或重新租用worker id后恢复生成id，lastTimeStamp不变，切换worker id后生成的id仍然递增
+func (iw *IDWorker) resume(workerID int64) {
+	iw.lock.Lock()
+	iw.workerID = workerID
+	iw.suspendErr = nil
+	iw.lock.Unlock()
+}
+
+// MaxWorkerID return the max worker id supported by the bit layout
+func (iw *IDWorker) MaxWorkerID() int64 {
+	return iw.maxWorkerID
+}
+
+// Decode 解析id，返回生成时间、worker id和序列号，必须使用生成id时相同的epoch和位数
+func (iw *IDWorker) Decode(id int64) (timestamp time.Time, workerID int64, sequence int64) {
+	timestamp = time.UnixMilli(id>>iw.timestampShift + iw.epoch)
+	workerID = id >> iw.workerIDShift & iw.maxWorkerID
+	sequence = id & iw.sequenceMask
+	return timestamp, workerID, sequence
+}
+
 // ---------------------------------------------------------------------------------------
 
 var iw *IDWorker
 
 // Init 初始化SnowFlake
-func Init(workID int64) error {
+func Init(workID int64, opts ...Option) error {
 	var err error
-	iw, err = NewIDWorker(workID)
+	iw, err = NewIDWorker(workID, opts...)
 	if err != nil {
 		return err
 	}
@@ -152,3 +218,12 @@ func NewID() int64 {
 
 	return id
 }
+
+// Decode 使用Init设置的epoch和位数解析id，没有初始化时使用默认设置
+func Decode(id int64) (timestamp time.Time, workerID int64, sequence int64) {
+	w := iw
+	if w == nil {
+		w, _ = NewIDWorker(0)
+	}
+	return w.Decode(id)
+}
@@ -3,6 +3,9 @@ package snowflake
 import (
 	"fmt"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestNewID(t *testing.T) {
@@ -51,3 +54,57 @@ func BenchmarkNewID(b *testing.B) {
 		NewID()
 	}
 }
+
+func TestDecode(t *testing.T) {
+	epoch := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	w, err := NewIDWorker(5, WithEpoch(epoch), WithBits(8, 14))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(255), w.MaxWorkerID())
+
+	start := time.Now().Truncate(time.Millisecond)
+	id, err := w.NextID()
+	assert.NoError(t, err)
+	id2, err := w.NextID()
+	assert.NoError(t, err)
+	assert.Greater(t, id2, id)
+
+	ts, workerID, sequence := w.Decode(id)
+	assert.Equal(t, int64(5), workerID)
+	assert.Equal(t, int64(0), sequence)
+	assert.False(t, ts.Before(start))
+	assert.Less(t, ts.Sub(start), time.Second)
+
+	_ = Init(3)
+	_, workerID, _ = Decode(NewID())
+	assert.Equal(t, int64(3), workerID)
+
+	// 无效的设置
+	_, err = NewIDWorker(256, WithBits(8, 14))
+	assert.Error(t, err)
+	_, err = NewIDWorker(1, WithBits(40, 30))
+	assert.Error(t, err)
+	_, err = NewIDWorker(1, WithEpoch(time.Now().Add(time.Hour)))
+	assert.Error(t, err)
+}
+
+func TestClockDrift(t *testing.T) {
+	w, err := NewIDWorker(1, WithMaxClockDrift(time.Millisecond*50))
+	assert.NoError(t, err)
+
+	// 时钟回拨在容忍时间内，等待后生成id，生成的id大于回拨前最后生成的id
+	w.lastTimeStamp = w.genTimestamp() + 20
+	w.sequence = 5
+	lastID := (w.lastTimeStamp-w.epoch)<<w.timestampShift | w.workerID<<w.workerIDShift | w.sequence
+	start := time.Now()
+	id, err := w.NextID()
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), time.Millisecond*15)
+	assert.Greater(t, id, lastID)
+	_, workerID, _ := w.Decode(id)
+	assert.Equal(t, int64(1), workerID)
+
+	// 超过容忍时间，返回错误
+	w.lastTimeStamp = w.genTimestamp() + 1000
+	_, err = w.NextID()
+	assert.ErrorIs(t, err, ErrClockMovedBackwards)
+}
@@ -1,6 +1,8 @@
 package stat
 
 import (
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/zhufuyi/pkg/stat/cpu"
@@ -12,6 +14,8 @@ import (
 var (
 	printInfoInterval = time.Minute // minimum 1 second
 	zapLog, _         = zap.NewProduction()
+
+	collectors = sync.Map{} // 名称和统计函数映射，统计结果和系统信息一起打印
 )
 
 // Option set the options field.
@@ -64,6 +68,31 @@ func Init(opts ...Option) {
 	}()
 }
 
+// Register 注册统计函数，统计结果和系统、进程信息一起定时打印，名称相同时覆盖
+func Register(name string, fn func() interface{}) {
+	if name == "" || fn == nil {
+		return
+	}
+	collectors.Store(name, fn)
+}
+
+// Unregister 删除统计函数
+func Unregister(name string) {
+	collectors.Delete(name)
+}
+
+func collect() []zap.Field {
+	var fields []zap.Field
+	collectors.Range(func(key, value interface{}) bool {
+		fields = append(fields, zap.Any(key.(string), value.(func() interface{})()))
+		return true
+	})
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].Key < fields[j].Key
+	})
+	return fields
+}
+
 func printUsageInfo() {
 	defer func() { _ = recover() }()
 
@@ -93,10 +122,11 @@ func printUsageInfo() {
 		NumGc:      mProc.NumGc,
 	}
 
-	zapLog.Info("statistics",
+	fields := []zap.Field{
 		zap.Any("system", sys),
 		zap.Any("process", proc),
-	)
+	}
+	zapLog.Info("statistics", append(fields, collect()...)...)
 }
 
 type system struct {
@@ -20,3 +20,24 @@ func TestInit(t *testing.T) {
 
 	time.Sleep(time.Second * 2)
 }
+
+func TestRegister(t *testing.T) {
+	Register("", nil)
+	Register("foo", func() interface{} {
+		return map[string]int{"hits": 1}
+	})
+	Register("bar", func() interface{} {
+		return "bar"
+	})
+	fields := collect()
+	if len(fields) != 2 || fields[0].Key != "bar" {
+		t.Fatalf("collect fields error: %+v", fields)
+	}
+
+	Unregister("foo")
+	Unregister("bar")
+	if len(collect()) != 0 {
+		t.Fatal("unregister error")
+	}
+	printUsageInfo()
+}